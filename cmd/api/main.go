@@ -11,6 +11,7 @@ import (
 	"openbook/internal/middleware"
 	"openbook/internal/repository/postgres"
 	"openbook/internal/service"
+	"openbook/internal/storage"
 	"openbook/internal/usecase"
 
 	"github.com/gofiber/fiber/v2"
@@ -48,21 +49,36 @@ func main() {
 	// 4. Repositories
 	deploymentRepo := postgres.NewDeploymentRepository(db)
 	gitRepo := postgres.NewGitRepository(db)
-	// siteRepo := postgres.NewSiteRepository(db)
-	// domainRepo := postgres.NewDomainRepository(db)
+	siteRepo := postgres.NewSiteRepository(db)
+	domainRepo := postgres.NewDomainRepository(db)
 	auditRepo := postgres.NewAuditLogRepository(db)
+	environmentRepo := postgres.NewEnvironmentRepository(db)
 
 	// 5. Services
 	publisher := service.NewPublisher(rdb)
+	logStream := service.NewLogStream(rdb)
+	layout := storage.NewLayout(cfg.StoragePath)
 
 	// 6. UseCases
-	deploymentUC := usecase.NewDeploymentUseCase(deploymentRepo, auditRepo, publisher)
-	gitUC := usecase.NewGitUseCase(gitRepo)
+	deploymentUC := usecase.NewDeploymentUseCase(deploymentRepo, environmentRepo, gitRepo, auditRepo, publisher, logStream)
+	previewUC := usecase.NewPreviewUseCase(siteRepo, environmentRepo, deploymentRepo, layout, cfg.PreviewBaseDomain, cfg.PreviewTTL)
+	autoDeployUC := usecase.NewAutoDeployUseCase(environmentRepo, deploymentRepo, gitRepo, deploymentUC, publisher, cfg.AutoDeployWait)
+	// Previews must exist before auto-deploy looks up the environments of a branch
+	gitUC := usecase.NewGitUseCase(gitRepo, previewUC, autoDeployUC)
+	environmentUC := usecase.NewEnvironmentUseCase(environmentRepo, deploymentRepo, auditRepo, layout, service.NewSiteLocks(rdb))
+	queueUC := usecase.NewQueueUseCase(deploymentRepo, auditRepo, publisher)
+	siteUC := usecase.NewSiteUseCase(siteRepo, environmentRepo, auditRepo)
+	domainUC := usecase.NewDomainUseCase(domainRepo, siteRepo, auditRepo, service.NewResolver(cfg.DNSResolver), cfg.DomainCNAMETarget, cfg.DomainRecheck)
 
 	// 7. Handlers
 	deploymentHandler := handler.NewDeploymentHandler(deploymentUC)
 	branchHandler := handler.NewBranchHandler(gitUC)
 	mergeHandler := handler.NewMergeHandler(gitUC)
+	commitHandler := handler.NewCommitHandler(gitUC)
+	environmentHandler := handler.NewEnvironmentHandler(environmentUC)
+	adminHandler := handler.NewAdminHandler(queueUC)
+	siteHandler := handler.NewSiteHandler(siteUC)
+	domainHandler := handler.NewDomainHandler(domainUC)
 
 	// 8. Fiber App
 	app := fiber.New()
@@ -84,14 +100,44 @@ func main() {
 	api := app.Group("/api/v1")
 	api.Use(middleware.AuthMiddleware) // JWT + Workspace ID
 
+	// Site Routes
+	api.Post("/sites", siteHandler.Create)
+	api.Get("/sites", siteHandler.List)
+	api.Get("/sites/:id", siteHandler.Get)
+	api.Patch("/sites/:id", siteHandler.Update)
+	api.Delete("/sites/:id", siteHandler.Delete)
+
+	// Domain Routes
+	api.Post("/domains", domainHandler.Create)
+	api.Get("/domains", domainHandler.List)
+	api.Get("/domains/:id", domainHandler.Get)
+	api.Post("/domains/:id/verify", domainHandler.Verify)
+	api.Delete("/domains/:id", domainHandler.Delete)
+
 	// Git Engine Routes
 	api.Post("/branches", branchHandler.Create)
 	api.Get("/branches", branchHandler.Get)
+	api.Delete("/branches", branchHandler.Delete)
 	api.Post("/merge", mergeHandler.Merge)
+	api.Post("/commits", commitHandler.Create)
 
 	// Deployment Routes
 	api.Post("/deployments", deploymentHandler.Create)
+	api.Get("/deployments", deploymentHandler.List)
 	api.Get("/deployments/:id", deploymentHandler.GetByID)
+	api.Get("/deployments/:id/logs/stream", deploymentHandler.StreamLogs)
+	api.Post("/deployments/:id/cancel", deploymentHandler.Cancel)
+	api.Post("/deployments/:id/promote", deploymentHandler.Promote)
+	api.Get("/deployments/:id/artifact", deploymentHandler.Artifact)
+	api.Get("/deployments/:id/changelog", deploymentHandler.Changelog)
+
+	// Environment Routes
+	api.Post("/environments/:id/rollback", environmentHandler.Rollback)
+
+	// Admin Routes
+	admin := api.Group("/admin", middleware.AdminMiddleware(cfg.AdminToken))
+	admin.Get("/dead-letters", adminHandler.ListDeadLetters)
+	admin.Post("/dead-letters/:id/requeue", adminHandler.RequeueDeadLetter)
 
 	// Start Server
 	port := os.Getenv("APP_PORT")
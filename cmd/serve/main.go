@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"openbook/internal/bootstrap"
+	"openbook/internal/config"
+	"openbook/internal/repository/postgres"
+	"openbook/internal/service"
+	"openbook/internal/static"
+	"openbook/internal/storage"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/logger"
+)
+
+var version = "dev"
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "--version" {
+		fmt.Printf("OpenBook Ultimate Serve %s\n", version)
+		os.Exit(0)
+	}
+
+	log.Printf("Starting OpenBook Ultimate Serve %s...", version)
+
+	// 1. Load Config
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	// 2. Init DB
+	db, err := bootstrap.InitDB(cfg)
+	if err != nil {
+		log.Fatalf("Failed to init DB: %v", err)
+	}
+	defer db.Close()
+
+	// 3. Repositories
+	siteRepo := postgres.NewSiteRepository(db)
+	environmentRepo := postgres.NewEnvironmentRepository(db)
+	domainRepo := postgres.NewDomainRepository(db)
+	certRepo := postgres.NewCertificateRepository(db)
+
+	// 4. Static server
+	resolver := static.NewResolver(domainRepo, siteRepo, environmentRepo, storage.NewLayout(cfg.StoragePath))
+	server := static.NewServer(resolver, certRepo)
+
+	app := fiber.New()
+	app.Use(logger.New())
+	app.Use(server.Handle)
+
+	// 5. Start
+	go func() {
+		log.Printf("Serving sites on port %s", cfg.ServePort)
+		if err := app.Listen(":" + cfg.ServePort); err != nil {
+			log.Fatalf("Server error: %v", err)
+		}
+	}()
+
+	// HTTPS for custom domains, with the certificate picked by SNI
+	if cfg.TLSPort != "" {
+		cipher, err := service.NewCipher(cfg.CertEncryptionKey)
+		if err != nil {
+			log.Fatalf("Failed to init certificate cipher: %v", err)
+		}
+		certs := static.NewCertificates(certRepo, cipher)
+		ln, err := tls.Listen("tcp", ":"+cfg.TLSPort, &tls.Config{
+			GetCertificate: certs.GetCertificate,
+			MinVersion:     tls.VersionTLS12,
+		})
+		if err != nil {
+			log.Fatalf("Failed to listen on TLS port %s: %v", cfg.TLSPort, err)
+		}
+		go func() {
+			log.Printf("Serving custom domains over TLS on port %s", cfg.TLSPort)
+			if err := app.Listener(ln); err != nil {
+				log.Fatalf("TLS server error: %v", err)
+			}
+		}()
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	<-stop
+	log.Println("Shutting down server...")
+	if err := app.Shutdown(); err != nil {
+		log.Printf("Server shutdown error: %v", err)
+	}
+	log.Println("Server stopped gracefully")
+}
@@ -6,12 +6,17 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
 	"openbook/internal/bootstrap"
 	"openbook/internal/config"
+	"openbook/internal/repository"
 	"openbook/internal/repository/postgres"
+	"openbook/internal/service"
+	"openbook/internal/storage"
+	"openbook/internal/usecase"
 	"openbook/internal/worker"
 )
 
@@ -48,16 +53,48 @@ func main() {
 	// 4. Repositories
 	deploymentRepo := postgres.NewDeploymentRepository(db)
 	gitRepo := postgres.NewGitRepository(db)
+	siteRepo := postgres.NewSiteRepository(db)
+	environmentRepo := postgres.NewEnvironmentRepository(db)
+	domainRepo := postgres.NewDomainRepository(db)
+	auditRepo := postgres.NewAuditLogRepository(db)
 
 	// 5. Worker
-	w := worker.NewWorker(rdb, deploymentRepo, gitRepo, cfg)
+	w := worker.NewWorker(rdb, deploymentRepo, gitRepo, siteRepo, environmentRepo, domainRepo, cfg)
 
 	// Context for graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// 6. Start
+	// 6. Auto-deploy, preview expiry and domain verification
+	publisher := service.NewPublisher(rdb)
+	deploymentUC := usecase.NewDeploymentUseCase(deploymentRepo, environmentRepo, gitRepo, auditRepo, publisher, service.NewLogStream(rdb))
+	autoDeployUC := usecase.NewAutoDeployUseCase(environmentRepo, deploymentRepo, gitRepo, deploymentUC, publisher, cfg.AutoDeployWait)
+	previewUC := usecase.NewPreviewUseCase(siteRepo, environmentRepo, deploymentRepo, storage.NewLayout(cfg.StoragePath), cfg.PreviewBaseDomain, cfg.PreviewTTL)
+	domainUC := usecase.NewDomainUseCase(domainRepo, siteRepo, auditRepo, service.NewResolver(cfg.DNSResolver), cfg.DomainCNAMETarget, cfg.DomainRecheck)
+
+	// 7. Start. Background tasks use the worker's Redis client and database,
+	// so they have their own context and are awaited before the worker stops.
 	go w.Start(ctx)
+	tasksCtx, cancelTasks := context.WithCancel(ctx)
+	defer cancelTasks()
+	var tasks sync.WaitGroup
+	runTask := func(task func(context.Context)) {
+		tasks.Add(1)
+		go func() {
+			defer tasks.Done()
+			task(tasksCtx)
+		}()
+	}
+	runTask(autoDeployUC.Run)
+	runTask(func(ctx context.Context) { expirePreviews(ctx, previewUC) })
+	runTask(func(ctx context.Context) { verifyDomains(ctx, domainUC) })
+	if cfg.ACMEDirectoryURL != "" {
+		certificateUC, err := newCertificateUseCase(cfg, domainRepo, postgres.NewCertificateRepository(db))
+		if err != nil {
+			log.Fatalf("Failed to init ACME: %v", err)
+		}
+		runTask(func(ctx context.Context) { provisionCertificates(ctx, certificateUC) })
+	}
 
 	// Wait for interrupt signal
 	stop := make(chan os.Signal, 1)
@@ -66,12 +103,99 @@ func main() {
 	<-stop
 	log.Println("Shutting down worker...")
 
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
 	defer shutdownCancel()
 
+	cancelTasks()
+	tasksDone := make(chan struct{})
+	go func() {
+		tasks.Wait()
+		close(tasksDone)
+	}()
+	select {
+	case <-tasksDone:
+	case <-shutdownCtx.Done():
+		log.Println("Shutdown deadline reached before background tasks stopped")
+	}
+
 	if err := w.Stop(shutdownCtx); err != nil {
 		log.Printf("Worker shutdown error: %v", err)
 	}
 
 	log.Println("Worker stopped gracefully")
 }
+
+// previewExpiryInterval is how often inactive previews are looked for
+const previewExpiryInterval = time.Hour
+
+func expirePreviews(ctx context.Context, uc *usecase.PreviewUseCase) {
+	ticker := time.NewTicker(previewExpiryInterval)
+	defer ticker.Stop()
+
+	for {
+		expired, err := uc.ExpireInactive(ctx)
+		if err != nil {
+			log.Printf("Failed to expire previews: %v", err)
+		} else if expired > 0 {
+			log.Printf("Expired %d preview environments", expired)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// domainVerifyInterval is how often domains due for a DNS check are looked for
+const domainVerifyInterval = time.Minute
+
+func verifyDomains(ctx context.Context, uc *usecase.DomainUseCase) {
+	ticker := time.NewTicker(domainVerifyInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := uc.VerifyDue(ctx); err != nil {
+			log.Printf("Failed to verify domains: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// certificateInterval is how often domains needing a certificate are looked for
+const certificateInterval = time.Minute
+
+func newCertificateUseCase(cfg *config.Config, domainRepo repository.DomainRepository, certRepo repository.CertificateRepository) (*usecase.CertificateUseCase, error) {
+	client, err := service.NewACME(cfg.ACMEDirectoryURL, cfg.ACMEEmail, cfg.ACMECAFile)
+	if err != nil {
+		return nil, err
+	}
+	cipher, err := service.NewCipher(cfg.CertEncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	return usecase.NewCertificateUseCase(domainRepo, certRepo, client, cipher), nil
+}
+
+func provisionCertificates(ctx context.Context, uc *usecase.CertificateUseCase) {
+	ticker := time.NewTicker(certificateInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := uc.ProvisionDue(ctx); err != nil {
+			log.Printf("Failed to provision certificates: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
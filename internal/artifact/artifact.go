@@ -0,0 +1,247 @@
+// Package artifact packages the output of a deployment as a downloadable
+// archive. Archives are reproducible: the same output always yields the same
+// bytes, and each carries a manifest with the size and sha256 of every file.
+// Exports of the site as a book are stored alongside the archives.
+package artifact
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"openbook/internal/domain"
+)
+
+// Archive formats
+const (
+	FormatZip   = "zip"
+	FormatTarGz = "tar.gz"
+)
+
+// Export formats; the worker assembles them from the pages of a build, so
+// they can only be prebuilt
+const (
+	FormatEPUB = "epub"
+	FormatPDF  = "pdf"
+)
+
+// ManifestPath is where the file manifest is stored inside an archive
+const ManifestPath = ".openbook/checksums.json"
+
+// modTime is stamped on every archive entry so archives are reproducible.
+// It is the earliest time zip can represent.
+var modTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// variantSuffixes are the precompressed variants written for the static server
+var variantSuffixes = []string{".gz", ".br"}
+
+// File is an entry of the manifest
+type File struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest lists the files of an archive, ordered by path
+type Manifest struct {
+	Files []File `json:"files"`
+}
+
+// ValidateFormat reports whether format is a supported archive or export format
+func ValidateFormat(format string) error {
+	if format != FormatZip && format != FormatTarGz && !IsExport(format) {
+		return fmt.Errorf("%w: unsupported artifact format %q", domain.ErrInvalidInput, format)
+	}
+	return nil
+}
+
+// IsExport reports whether format is an export format rather than an archive
+func IsExport(format string) bool {
+	return format == FormatEPUB || format == FormatPDF
+}
+
+// ContentType returns the media type of an archive or export format
+func ContentType(format string) string {
+	switch format {
+	case FormatZip:
+		return "application/zip"
+	case FormatEPUB:
+		return "application/epub+zip"
+	case FormatPDF:
+		return "application/pdf"
+	}
+	return "application/gzip"
+}
+
+// IsVariant reports whether path is a precompressed variant of another output
+func IsVariant(path string) bool {
+	for _, suffix := range variantSuffixes {
+		if base, ok := strings.CutSuffix(path, suffix); ok {
+			if _, err := os.Stat(base); err == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Collect builds the manifest of a deployment output. Dot files, which are
+// never served, and precompressed variants are left out.
+func Collect(dir string) (*Manifest, error) {
+	manifest := &Manifest{Files: []File{}}
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+		if strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() || !entry.Type().IsRegular() || IsVariant(path) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		h := sha256.New()
+		size, err := io.Copy(h, f)
+		if err != nil {
+			return err
+		}
+		manifest.Files = append(manifest.Files, File{
+			Path:   filepath.ToSlash(rel),
+			Size:   size,
+			SHA256: hex.EncodeToString(h.Sum(nil)),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect artifact files: %w", err)
+	}
+	sort.Slice(manifest.Files, func(i, j int) bool { return manifest.Files[i].Path < manifest.Files[j].Path })
+	return manifest, nil
+}
+
+// Write streams an archive of the files of manifest, read from dir, followed
+// by the manifest itself
+func Write(w io.Writer, format, dir string, manifest *Manifest) error {
+	if err := ValidateFormat(format); err != nil {
+		return err
+	}
+	if IsExport(format) {
+		return fmt.Errorf("%w: %s is not an archive format", domain.ErrInvalidInput, format)
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if format == FormatZip {
+		return writeZip(w, dir, manifest, data)
+	}
+	return writeTarGz(w, dir, manifest, data)
+}
+
+func writeTarGz(w io.Writer, dir string, manifest *Manifest, manifestData []byte) error {
+	zw, err := gzip.NewWriterLevel(w, gzip.BestCompression)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(zw)
+
+	add := func(name string, size int64, content io.Reader) error {
+		header := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Size:     size,
+			Mode:     0644,
+			ModTime:  modTime,
+			Format:   tar.FormatPAX,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err := io.Copy(tw, content)
+		return err
+	}
+
+	for _, file := range manifest.Files {
+		if err := addFile(dir, file, func(r io.Reader) error { return add(file.Path, file.Size, r) }); err != nil {
+			return err
+		}
+	}
+	if err := add(ManifestPath, int64(len(manifestData)), strings.NewReader(string(manifestData))); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func writeZip(w io.Writer, dir string, manifest *Manifest, manifestData []byte) error {
+	zw := zip.NewWriter(w)
+
+	add := func(name string, content io.Reader) error {
+		header := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modTime}
+		header.SetMode(0644)
+		entry, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(entry, content)
+		return err
+	}
+
+	for _, file := range manifest.Files {
+		if err := addFile(dir, file, func(r io.Reader) error { return add(file.Path, r) }); err != nil {
+			return err
+		}
+	}
+	if err := add(ManifestPath, strings.NewReader(string(manifestData))); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// addFile hands the content of a manifest file to add, failing when the file
+// changed since the manifest was built
+func addFile(dir string, file File, add func(io.Reader) error) error {
+	f, err := os.Open(filepath.Join(dir, filepath.FromSlash(file.Path)))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() != file.Size {
+		return fmt.Errorf("file %s changed while archiving", file.Path)
+	}
+	return add(io.LimitReader(f, file.Size))
+}
@@ -0,0 +1,74 @@
+package artifact
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// storeDir holds the prebuilt archives of a deployment, next to its build
+// manifest. Dot directories are never served.
+const storeDir = ".openbook"
+
+// Path returns where the prebuilt archive or export of a deployment output
+// is stored
+func Path(dir, format string) string {
+	return filepath.Join(dir, storeDir, "artifact."+format)
+}
+
+// Store writes a prebuilt archive of each format into a deployment output,
+// together with its sha256 checksum. It returns the manifest the archives
+// were built from.
+func Store(dir string, formats []string) (*Manifest, error) {
+	manifest, err := Collect(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, format := range formats {
+		err := StoreFile(dir, format, func(w io.Writer) error {
+			return Write(w, format, dir, manifest)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to store %s artifact: %w", format, err)
+		}
+	}
+	return manifest, nil
+}
+
+// StoreFile writes a prebuilt file of the given format into a deployment
+// output, together with its sha256 checksum
+func StoreFile(dir, format string, write func(io.Writer) error) error {
+	path := Path(dir, format)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	if err := write(io.MultiWriter(f, h)); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.WriteFile(path+".sha256", []byte(hex.EncodeToString(h.Sum(nil))+"  "+filepath.Base(path)+"\n"), 0644)
+}
+
+// Checksum returns the sha256 checksum of the prebuilt archive or export of
+// a deployment output. It fails with os.ErrNotExist when none of the format
+// was built.
+func Checksum(dir, format string) (string, error) {
+	sum, err := os.ReadFile(Path(dir, format) + ".sha256")
+	if err != nil {
+		return "", err
+	}
+	checksum, _, _ := strings.Cut(string(sum), " ")
+	return checksum, nil
+}
@@ -0,0 +1,178 @@
+// Package changelog compares two builds of a site: the pages added, removed
+// and modified between them and the commits that lead from one to the other.
+package changelog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"openbook/internal/domain"
+
+	"github.com/google/uuid"
+)
+
+// manifestPath is where the worker records a deployment's source files
+const manifestPath = ".openbook/manifest.json"
+
+// Limits of the commit history walk
+const (
+	// maxCommits bounds the commits listed in a changelog
+	maxCommits = 100
+	// maxAncestors bounds the history of the older commit that is excluded
+	maxAncestors = 500
+)
+
+// Page is a page of a build
+type Page struct {
+	Path  string `json:"path"` // URL path
+	URL   string `json:"url,omitempty"`
+	Title string `json:"title"`
+}
+
+// Source is a source file of a build, keyed by tree path in a Build
+type Source struct {
+	BlobHash string `json:"blob_hash"`
+	Page     *Page  `json:"page,omitempty"`
+}
+
+// Build lists the source files of a build by tree path
+type Build map[string]Source
+
+// Changelog lists what changed from one build to another. Pages are ordered
+// by URL path, commits newest first.
+type Changelog struct {
+	Added    []Page           `json:"added"`
+	Removed  []Page           `json:"removed"`
+	Modified []Page           `json:"modified"`
+	Commits  []*domain.Commit `json:"commits"`
+	// Truncated is set when more commits lie between the builds than are listed
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// Empty reports whether no page changed
+func (c *Changelog) Empty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Modified) == 0
+}
+
+// ReadBuild reads the source files of a deployment output from its build
+// manifest
+func ReadBuild(dir string) (Build, error) {
+	data, err := os.ReadFile(filepath.Join(dir, manifestPath))
+	if err != nil {
+		return nil, err
+	}
+	var manifest struct {
+		Files Build `json:"files"`
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid build manifest: %w", err)
+	}
+	return manifest.Files, nil
+}
+
+// ComparePages returns the pages added, removed and modified from one build
+// to the other. A page is modified when its source file changed.
+func ComparePages(from, to Build) *Changelog {
+	c := &Changelog{Added: []Page{}, Removed: []Page{}, Modified: []Page{}, Commits: []*domain.Commit{}}
+	for path, src := range to {
+		if src.Page == nil {
+			continue
+		}
+		prev, ok := from[path]
+		switch {
+		case !ok || prev.Page == nil:
+			c.Added = append(c.Added, *src.Page)
+		case prev.BlobHash != src.BlobHash:
+			c.Modified = append(c.Modified, *src.Page)
+		}
+	}
+	for path, src := range from {
+		if src.Page == nil {
+			continue
+		}
+		if next, ok := to[path]; !ok || next.Page == nil {
+			c.Removed = append(c.Removed, *src.Page)
+		}
+	}
+	for _, pages := range [][]Page{c.Added, c.Removed, c.Modified} {
+		sort.Slice(pages, func(i, j int) bool { return pages[i].Path < pages[j].Path })
+	}
+	return c
+}
+
+// CommitReader reads commits of the commit graph
+type CommitReader interface {
+	GetCommit(ctx context.Context, id uuid.UUID) (*domain.Commit, error)
+}
+
+// Commits returns the commits reachable from to but not from from, newest
+// first, and whether the list was truncated. Merged branches are followed.
+func Commits(ctx context.Context, git CommitReader, from, to uuid.UUID) ([]*domain.Commit, bool, error) {
+	commits := []*domain.Commit{}
+	if from == to {
+		return commits, false, nil
+	}
+
+	known, err := ancestors(ctx, git, from)
+	if err != nil {
+		return nil, false, err
+	}
+	seen := make(map[uuid.UUID]bool)
+	queue := []uuid.UUID{to}
+	truncated := false
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if known[id] || seen[id] {
+			continue
+		}
+		seen[id] = true
+		if len(commits) == maxCommits {
+			truncated = true
+			break
+		}
+		c, err := git.GetCommit(ctx, id)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to get commit %s: %w", id, err)
+		}
+		commits = append(commits, c)
+		queue = append(queue, parents(c)...)
+	}
+	sort.SliceStable(commits, func(i, j int) bool { return commits[i].CreatedAt.After(commits[j].CreatedAt) })
+	return commits, truncated, nil
+}
+
+// ancestors returns a commit and its ancestors, up to maxAncestors of them
+func ancestors(ctx context.Context, git CommitReader, id uuid.UUID) (map[uuid.UUID]bool, error) {
+	known := make(map[uuid.UUID]bool)
+	queue := []uuid.UUID{id}
+	for len(queue) > 0 && len(known) < maxAncestors {
+		id := queue[0]
+		queue = queue[1:]
+		if known[id] {
+			continue
+		}
+		c, err := git.GetCommit(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get commit %s: %w", id, err)
+		}
+		known[id] = true
+		queue = append(queue, parents(c)...)
+	}
+	return known, nil
+}
+
+func parents(c *domain.Commit) []uuid.UUID {
+	var ids []uuid.UUID
+	if c.ParentHash != nil {
+		ids = append(ids, *c.ParentHash)
+	}
+	if c.MergeParentHash != nil {
+		ids = append(ids, *c.MergeParentHash)
+	}
+	return ids
+}
@@ -1,27 +1,60 @@
 package config
 
 import (
+	"encoding/base64"
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
+
+	"openbook/internal/artifact"
 )
 
 type Config struct {
-	DBDSN         string
-	RedisAddr     string
-	RedisPassword string
-	RedisDB       int
-	AppPort       string
-	StoragePath   string
+	DBDSN             string
+	RedisAddr         string
+	RedisPassword     string
+	RedisDB           int
+	AppPort           string
+	ServePort         string
+	StoragePath       string
+	AdminToken        string
+	WorkerName        string
+	MaxAttempts       int
+	Concurrency       int
+	ShutdownTimeout   time.Duration
+	PreviewBaseDomain string
+	PreviewTTL        time.Duration
+	AutoDeployWait    time.Duration
+	ArtifactFormats   []string
+	DNSResolver       string
+	DomainCNAMETarget string
+	DomainRecheck     time.Duration
+	ACMEDirectoryURL  string
+	ACMEEmail         string
+	ACMECAFile        string
+	CertEncryptionKey []byte
+	TLSPort           string
 }
 
 func Load() (*Config, error) {
 	cfg := &Config{
-		DBDSN:         os.Getenv("DB_DSN"),
-		RedisAddr:     os.Getenv("REDIS_ADDR"),
-		RedisPassword: os.Getenv("REDIS_PASSWORD"),
-		AppPort:       os.Getenv("APP_PORT"),
-		StoragePath:   os.Getenv("STORAGE_PATH"),
+		DBDSN:             os.Getenv("DB_DSN"),
+		RedisAddr:         os.Getenv("REDIS_ADDR"),
+		RedisPassword:     os.Getenv("REDIS_PASSWORD"),
+		AppPort:           os.Getenv("APP_PORT"),
+		ServePort:         os.Getenv("SERVE_PORT"),
+		StoragePath:       os.Getenv("STORAGE_PATH"),
+		AdminToken:        os.Getenv("ADMIN_TOKEN"),
+		WorkerName:        os.Getenv("WORKER_NAME"),
+		PreviewBaseDomain: os.Getenv("PREVIEW_BASE_DOMAIN"),
+		DNSResolver:       os.Getenv("DNS_RESOLVER"),
+		DomainCNAMETarget: os.Getenv("DOMAIN_CNAME_TARGET"),
+		ACMEDirectoryURL:  os.Getenv("ACME_DIRECTORY_URL"),
+		ACMEEmail:         os.Getenv("ACME_EMAIL"),
+		ACMECAFile:        os.Getenv("ACME_CA_FILE"),
+		TLSPort:           os.Getenv("TLS_PORT"),
 	}
 
 	// Default Storage Path
@@ -39,6 +72,9 @@ func Load() (*Config, error) {
 	if cfg.AppPort == "" {
 		cfg.AppPort = "8080"
 	}
+	if cfg.ServePort == "" {
+		cfg.ServePort = "8081"
+	}
 
 	// Redis DB
 	redisDBStr := os.Getenv("REDIS_DB")
@@ -52,5 +88,101 @@ func Load() (*Config, error) {
 		cfg.RedisDB = db
 	}
 
+	// Deployment attempts before a message is dead-lettered
+	maxAttemptsStr := os.Getenv("DEPLOY_MAX_ATTEMPTS")
+	if maxAttemptsStr == "" {
+		cfg.MaxAttempts = 5
+	} else {
+		n, err := strconv.Atoi(maxAttemptsStr)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid DEPLOY_MAX_ATTEMPTS: %q", maxAttemptsStr)
+		}
+		cfg.MaxAttempts = n
+	}
+
+	// Builds run concurrently by one worker process
+	concurrencyStr := os.Getenv("WORKER_CONCURRENCY")
+	if concurrencyStr == "" {
+		cfg.Concurrency = 4
+	} else {
+		n, err := strconv.Atoi(concurrencyStr)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid WORKER_CONCURRENCY: %q", concurrencyStr)
+		}
+		cfg.Concurrency = n
+	}
+
+	// Grace period for in-flight builds when a worker shuts down
+	shutdownTimeoutStr := os.Getenv("WORKER_SHUTDOWN_TIMEOUT")
+	if shutdownTimeoutStr == "" {
+		cfg.ShutdownTimeout = time.Minute
+	} else {
+		d, err := time.ParseDuration(shutdownTimeoutStr)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid WORKER_SHUTDOWN_TIMEOUT: %q", shutdownTimeoutStr)
+		}
+		cfg.ShutdownTimeout = d
+	}
+
+	// Previews without new commits for this long are expired
+	previewTTLStr := os.Getenv("PREVIEW_TTL")
+	if previewTTLStr == "" {
+		cfg.PreviewTTL = 7 * 24 * time.Hour
+	} else {
+		d, err := time.ParseDuration(previewTTLStr)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid PREVIEW_TTL: %q", previewTTLStr)
+		}
+		cfg.PreviewTTL = d
+	}
+
+	// Quiet period after a branch head moves before its environments deploy
+	autoDeployWaitStr := os.Getenv("AUTO_DEPLOY_DEBOUNCE")
+	if autoDeployWaitStr == "" {
+		cfg.AutoDeployWait = 10 * time.Second
+	} else {
+		d, err := time.ParseDuration(autoDeployWaitStr)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid AUTO_DEPLOY_DEBOUNCE: %q", autoDeployWaitStr)
+		}
+		cfg.AutoDeployWait = d
+	}
+
+	// Verified custom domains are checked again this often
+	domainRecheckStr := os.Getenv("DOMAIN_RECHECK_INTERVAL")
+	if domainRecheckStr == "" {
+		cfg.DomainRecheck = time.Hour
+	} else {
+		d, err := time.ParseDuration(domainRecheckStr)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid DOMAIN_RECHECK_INTERVAL: %q", domainRecheckStr)
+		}
+		cfg.DomainRecheck = d
+	}
+
+	// Certificates and ACME account keys are encrypted with this base64 key
+	if keyStr := os.Getenv("CERT_ENCRYPTION_KEY"); keyStr != "" {
+		key, err := base64.StdEncoding.DecodeString(keyStr)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("invalid CERT_ENCRYPTION_KEY: must be 32 bytes, base64 encoded")
+		}
+		cfg.CertEncryptionKey = key
+	}
+	if (cfg.ACMEDirectoryURL != "" || cfg.TLSPort != "") && cfg.CertEncryptionKey == nil {
+		return nil, fmt.Errorf("CERT_ENCRYPTION_KEY is required with ACME_DIRECTORY_URL or TLS_PORT")
+	}
+
+	// Archive and export formats prebuilt with every deployment, e.g. "tar.gz,zip,epub,pdf"
+	for _, format := range strings.Split(os.Getenv("BUILD_ARTIFACTS"), ",") {
+		format = strings.TrimSpace(format)
+		if format == "" {
+			continue
+		}
+		if err := artifact.ValidateFormat(format); err != nil {
+			return nil, fmt.Errorf("invalid BUILD_ARTIFACTS: %w", err)
+		}
+		cfg.ArtifactFormats = append(cfg.ArtifactFormats, format)
+	}
+
 	return cfg, nil
 }
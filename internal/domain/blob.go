@@ -0,0 +1,41 @@
+package domain
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"unicode/utf8"
+)
+
+// blobBinary is the stored form of a file that is not valid UTF-8 text
+type blobBinary struct {
+	Encoding string `json:"encoding"`
+	Data     string `json:"data"`
+}
+
+// EncodeBlobContent returns the JSON stored for a file. Text files are
+// stored as a JSON string; binary files such as images as a base64 object,
+// since a JSON string cannot carry arbitrary bytes.
+func EncodeBlobContent(content []byte) json.RawMessage {
+	if utf8.Valid(content) {
+		data, _ := json.Marshal(string(content))
+		return data
+	}
+	data, _ := json.Marshal(blobBinary{Encoding: "base64", Data: base64.StdEncoding.EncodeToString(content)})
+	return data
+}
+
+// DecodeBlobContent returns the file stored in a blob. Blobs that are neither
+// a JSON string nor a base64 object are raw JSON and are returned as is.
+func DecodeBlobContent(raw json.RawMessage) []byte {
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return []byte(text)
+	}
+	var binary blobBinary
+	if err := json.Unmarshal(raw, &binary); err == nil && binary.Encoding == "base64" {
+		if content, err := base64.StdEncoding.DecodeString(binary.Data); err == nil {
+			return content
+		}
+	}
+	return raw
+}
@@ -0,0 +1,105 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// deploymentTransitions lists the statuses a deployment may move to from
+// each status. A scheduled deployment becomes pending at its publishing
+// time. Moving to pending again requeues a deployment; a build may
+// restart itself when a reclaimed message is processed again, and goes back
+// to pending when it is retried or interrupted by a shutdown. A queued
+// deployment fails without building when its message is dead-lettered.
+// Success and cancelled are final.
+var deploymentTransitions = map[string][]string{
+	"scheduled": {"pending", "cancelled"},
+	"pending":   {"pending", "building", "failed", "cancelled"},
+	"building":  {"building", "success", "failed", "cancelled", "pending"},
+	"failed":    {"pending"},
+}
+
+// ValidateDeploymentTransition reports whether a deployment may move from one status to another
+func ValidateDeploymentTransition(from, to string) error {
+	for _, target := range deploymentTransitions[from] {
+		if target == to {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: deployment cannot go from %s to %s", ErrConflict, from, to)
+}
+
+// DeploymentSourceStatuses returns the statuses a deployment may move to the given status from
+func DeploymentSourceStatuses(to string) []string {
+	var from []string
+	for status, targets := range deploymentTransitions {
+		for _, target := range targets {
+			if target == to {
+				from = append(from, status)
+			}
+		}
+	}
+	return from
+}
+
+// DeploymentFilter selects deployments of one workspace.
+// Nil and empty fields do not filter.
+type DeploymentFilter struct {
+	WorkspaceID   uuid.UUID
+	SiteID        *uuid.UUID
+	EnvironmentID *uuid.UUID
+	Status        string
+	TriggeredBy   *uuid.UUID
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	// After continues a listing past the given deployment, in the listing's order
+	After     *DeploymentCursor
+	Ascending bool
+	Limit     int
+}
+
+// DeploymentCursor is a position in a deployment listing ordered by creation time
+type DeploymentCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+// IsValidDeploymentStatus reports whether s is a known deployment status
+func IsValidDeploymentStatus(s string) bool {
+	switch s {
+	case "scheduled", "pending", "building", "success", "failed", "cancelled":
+		return true
+	}
+	return false
+}
+
+// IsFinished reports whether the deployment reached a final status
+func (d *Deployment) IsFinished() bool {
+	return d.Status == "success" || d.Status == "failed" || d.Status == "cancelled"
+}
+
+// ValidateEnvironment reports whether the deployment may be published to env:
+// it must be an environment of the deployment's site and workspace
+func (d *Deployment) ValidateEnvironment(env *Environment) error {
+	if env.WorkspaceID != d.WorkspaceID {
+		return fmt.Errorf("environment %w", ErrNotFound)
+	}
+	if env.SiteID != d.SiteID {
+		return fmt.Errorf("%w: environment %s belongs to another site", ErrInvalidInput, env.ID)
+	}
+	return nil
+}
+
+// ValidateCommit reports whether the deployment may build c: it must be a
+// commit of the deployment's workspace and, when linked to one, of its site
+func (d *Deployment) ValidateCommit(c *Commit) error {
+	if c.WorkspaceID != d.WorkspaceID {
+		return fmt.Errorf("commit %w", ErrNotFound)
+	}
+	if c.SiteID != nil && *c.SiteID != d.SiteID {
+		return fmt.Errorf("%w: commit %s belongs to another site", ErrInvalidInput, c.ID)
+	}
+	return nil
+}
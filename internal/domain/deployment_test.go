@@ -0,0 +1,91 @@
+package domain
+
+import (
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateDeploymentTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		ok       bool
+	}{
+		{"scheduled", "pending", true},
+		{"scheduled", "cancelled", true},
+		{"scheduled", "building", false},
+		{"scheduled", "success", false},
+		{"pending", "pending", true},
+		{"pending", "building", true},
+		{"pending", "failed", true},
+		{"pending", "cancelled", true},
+		{"pending", "success", false},
+		{"pending", "scheduled", false},
+		{"building", "building", true},
+		{"building", "success", true},
+		{"building", "failed", true},
+		{"building", "cancelled", true},
+		{"building", "pending", true},
+		{"building", "scheduled", false},
+		{"failed", "pending", true},
+		{"failed", "building", false},
+		{"failed", "success", false},
+		{"success", "pending", false},
+		{"success", "failed", false},
+		{"cancelled", "pending", false},
+		{"cancelled", "building", false},
+		{"unknown", "pending", false},
+		{"pending", "unknown", false},
+	}
+	for _, tt := range tests {
+		err := ValidateDeploymentTransition(tt.from, tt.to)
+		if tt.ok {
+			assert.NoError(t, err, "%s -> %s", tt.from, tt.to)
+			continue
+		}
+		assert.True(t, errors.Is(err, ErrConflict), "%s -> %s: %v", tt.from, tt.to, err)
+	}
+}
+
+func TestDeploymentSourceStatuses(t *testing.T) {
+	tests := []struct {
+		to   string
+		from []string
+	}{
+		{"scheduled", nil},
+		{"pending", []string{"building", "failed", "pending", "scheduled"}},
+		{"building", []string{"building", "pending"}},
+		{"success", []string{"building"}},
+		{"failed", []string{"building", "pending"}},
+		{"cancelled", []string{"building", "pending", "scheduled"}},
+	}
+	for _, tt := range tests {
+		from := DeploymentSourceStatuses(tt.to)
+		sort.Strings(from)
+		assert.Equal(t, tt.from, from, tt.to)
+		for _, status := range from {
+			assert.NoError(t, ValidateDeploymentTransition(status, tt.to))
+		}
+	}
+}
+
+func TestDeployment_IsFinished(t *testing.T) {
+	tests := []struct {
+		status   string
+		finished bool
+	}{
+		{"scheduled", false},
+		{"pending", false},
+		{"building", false},
+		{"success", true},
+		{"failed", true},
+		{"cancelled", true},
+	}
+	for _, tt := range tests {
+		assert.True(t, IsValidDeploymentStatus(tt.status), tt.status)
+		assert.Equal(t, tt.finished, (&Deployment{Status: tt.status}).IsFinished(), tt.status)
+	}
+	assert.False(t, IsValidDeploymentStatus("queued"))
+}
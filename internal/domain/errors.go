@@ -0,0 +1,11 @@
+package domain
+
+import "errors"
+
+// Sentinel errors shared by repositories and use cases.
+// Wrap them with fmt.Errorf("...: %w", ...) and test with errors.Is.
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrInvalidInput = errors.New("invalid input")
+	ErrConflict     = errors.New("conflict")
+)
@@ -0,0 +1,30 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// BranchHeadMoved is raised when a commit, a merge or a new branch moves the
+// head of a branch
+type BranchHeadMoved struct {
+	WorkspaceID    uuid.UUID
+	SiteID         uuid.UUID
+	BranchID       uuid.UUID
+	BranchName     string
+	IsProtected    bool
+	PreviousHeadID *uuid.UUID
+	HeadCommitID   uuid.UUID
+	AuthorID       uuid.UUID
+	OccurredAt     time.Time
+}
+
+// BranchDeleted is raised after a branch was removed
+type BranchDeleted struct {
+	WorkspaceID uuid.UUID
+	SiteID      uuid.UUID
+	BranchID    uuid.UUID
+	BranchName  string
+	OccurredAt  time.Time
+}
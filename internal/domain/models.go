@@ -2,6 +2,7 @@ package domain
 
 import (
 	"encoding/json"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -99,14 +100,22 @@ type Deployment struct {
 	WorkspaceID   uuid.UUID  `json:"workspace_id" db:"workspace_id"`
 	SiteID        uuid.UUID  `json:"site_id" db:"site_id"`
 	EnvironmentID uuid.UUID  `json:"environment_id" db:"environment_id"`
-	Status        string     `json:"status" db:"status"` // pending, building, success, failed
+	Status        string     `json:"status" db:"status"` // scheduled, pending, building, success, failed, cancelled
 	CommitHash    string     `json:"commit_hash" db:"commit_hash"`
 	StoragePath   string     `json:"storage_path" db:"storage_path"`
 	URL           string     `json:"url" db:"url"`
 	Logs          string     `json:"logs" db:"logs"`
 	TriggeredBy   uuid.UUID  `json:"triggered_by" db:"triggered_by"`
+	ErrorMessage  string     `json:"error_message,omitempty" db:"error_message"`
 	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+	QueuedAt      *time.Time `json:"queued_at,omitempty" db:"queued_at"`
+	StartedAt     *time.Time `json:"started_at,omitempty" db:"started_at"`
 	FinishedAt    *time.Time `json:"finished_at,omitempty" db:"finished_at"`
+	// SourceDeploymentID is set on promotions: the deployment whose output is
+	// published instead of building the commit
+	SourceDeploymentID *uuid.UUID `json:"source_deployment_id,omitempty" db:"source_deployment_id"`
+	// ScheduledAt is when a scheduled deployment is queued for building
+	ScheduledAt *time.Time `json:"scheduled_at,omitempty" db:"scheduled_at"`
 }
 
 // AuditLog represents a system action record
@@ -140,11 +149,20 @@ type Site struct {
 	Plan               string     `json:"plan" db:"plan"`
 	DefaultEnvironment string     `json:"default_environment" db:"default_environment"`
 	IsPublic           bool       `json:"is_public" db:"is_public"`
+	BrokenLinks        string     `json:"broken_links" db:"broken_links"` // warn, fail
+	WhatsNew           bool       `json:"whats_new" db:"whats_new"`       // publish a "What's new" page with every build
 	CreatedAt          time.Time  `json:"created_at" db:"created_at"`
 	UpdatedAt          time.Time  `json:"updated_at" db:"updated_at"`
 	DeletedAt          *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
 }
 
+// Broken link policies of a site: report broken internal links in the
+// build log, or fail the deployment
+const (
+	BrokenLinksWarn = "warn"
+	BrokenLinksFail = "fail"
+)
+
 // Domain represents a custom domain
 type Domain struct {
 	ID                uuid.UUID `json:"id" db:"id"`
@@ -156,7 +174,58 @@ type Domain struct {
 	DNSVerified       bool      `json:"dns_verified" db:"dns_verified"`
 	SSLStatus         string    `json:"ssl_status" db:"ssl_status"`
 	VerificationToken string    `json:"verification_token" db:"verification_token"`
-	CreatedAt         time.Time `json:"created_at" db:"created_at"`
+	// VerificationError explains why the last DNS check failed
+	VerificationError string     `json:"verification_error,omitempty" db:"verification_error"`
+	VerifiedAt        *time.Time `json:"verified_at,omitempty" db:"verified_at"`
+	CheckedAt         *time.Time `json:"checked_at,omitempty" db:"checked_at"`
+	// SSLError explains why the last certificate request failed
+	SSLError     string     `json:"ssl_error,omitempty" db:"ssl_error"`
+	SSLCheckedAt *time.Time `json:"ssl_checked_at,omitempty" db:"ssl_checked_at"`
+	SSLExpiresAt *time.Time `json:"ssl_expires_at,omitempty" db:"ssl_expires_at"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+}
+
+// Host returns the host name a domain is served at. Subdirectory domains
+// are stored as the host followed by their path, like example.com/docs.
+func (d *Domain) Host() string {
+	host, _, _ := strings.Cut(d.Domain, "/")
+	return host
+}
+
+// Path returns the path a subdirectory domain is mounted at, like /docs,
+// and "" for a domain serving the whole host
+func (d *Domain) Path() string {
+	if i := strings.Index(d.Domain, "/"); i >= 0 {
+		return d.Domain[i:]
+	}
+	return ""
+}
+
+// Domain statuses: a pending domain waits for its DNS records, an active one
+// is served, and one in error failed verification or lost its records
+const (
+	DomainPending = "pending"
+	DomainActive  = "active"
+	DomainError   = "error"
+)
+
+// Certificate statuses of a domain: none until it is verified, provisioning
+// while a certificate is requested or renewed, active once one is served,
+// and error when none could be obtained
+const (
+	SSLNone         = "none"
+	SSLProvisioning = "provisioning"
+	SSLActive       = "active"
+	SSLError        = "error"
+)
+
+// Certificate is the TLS certificate of a domain. Data holds the PEM
+// certificate chain and private key, encrypted at rest.
+type Certificate struct {
+	DomainID  uuid.UUID `json:"domain_id" db:"domain_id"`
+	Data      []byte    `json:"-" db:"data"`
+	ExpiresAt time.Time `json:"expires_at" db:"expires_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
 }
 
 // Blob represents content storage (Git engine)
@@ -169,15 +238,15 @@ type Blob struct {
 
 // Commit represents a version snapshot (Git engine)
 type Commit struct {
-	ID          uuid.UUID  `json:"id" db:"id"`
-	WorkspaceID uuid.UUID  `json:"workspace_id" db:"workspace_id"`
-	SiteID      *uuid.UUID `json:"site_id,omitempty" db:"site_id"`
-	TreeHash    string     `json:"tree_hash" db:"tree_hash"`
-	ParentHash  *uuid.UUID `json:"parent_hash,omitempty" db:"parent_hash"`
+	ID              uuid.UUID  `json:"id" db:"id"`
+	WorkspaceID     uuid.UUID  `json:"workspace_id" db:"workspace_id"`
+	SiteID          *uuid.UUID `json:"site_id,omitempty" db:"site_id"`
+	TreeHash        string     `json:"tree_hash" db:"tree_hash"`
+	ParentHash      *uuid.UUID `json:"parent_hash,omitempty" db:"parent_hash"`
 	MergeParentHash *uuid.UUID `json:"merge_parent_hash,omitempty" db:"merge_parent_hash"`
-	Message     string     `json:"message" db:"message"`
-	AuthorID    uuid.UUID  `json:"author_id" db:"author_id"`
-	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	Message         string     `json:"message" db:"message"`
+	AuthorID        uuid.UUID  `json:"author_id" db:"author_id"`
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
 }
 
 // Tree represents a file structure snapshot (Git engine)
@@ -204,14 +273,17 @@ type Branch struct {
 
 // Environment represents a deployment target
 type Environment struct {
-	ID          uuid.UUID `json:"id" db:"id"`
-	WorkspaceID uuid.UUID `json:"workspace_id" db:"workspace_id"`
-	SiteID      uuid.UUID `json:"site_id" db:"site_id"`
-	Name        string    `json:"name" db:"name"`
-	BranchID    uuid.UUID `json:"branch_id" db:"branch_id"`
-	URL         string    `json:"url" db:"url"`
-	IsActive    bool      `json:"is_active" db:"is_active"`
-	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	ID               uuid.UUID  `json:"id" db:"id"`
+	WorkspaceID      uuid.UUID  `json:"workspace_id" db:"workspace_id"`
+	SiteID           uuid.UUID  `json:"site_id" db:"site_id"`
+	Name             string     `json:"name" db:"name"`
+	BranchID         uuid.UUID  `json:"branch_id" db:"branch_id"`
+	URL              string     `json:"url" db:"url"`
+	IsActive         bool       `json:"is_active" db:"is_active"`
+	LiveDeploymentID *uuid.UUID `json:"live_deployment_id,omitempty" db:"live_deployment_id"`
+	IsPreview        bool       `json:"is_preview" db:"is_preview"`
+	LastActivityAt   *time.Time `json:"last_activity_at,omitempty" db:"last_activity_at"`
+	CreatedAt        time.Time  `json:"created_at" db:"created_at"`
 }
 
 // Condition represents dynamic content rules
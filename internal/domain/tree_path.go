@@ -0,0 +1,61 @@
+package domain
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"unicode"
+)
+
+// Limits of the paths stored in commit trees
+const (
+	MaxTreePathLength = 512
+	MaxTreePathDepth  = 16
+)
+
+// treePathPunctuation are the characters besides letters and digits a tree
+// path segment may contain
+const treePathPunctuation = "-_.~+@() "
+
+// ValidateTreePath reports whether p may be stored in a commit tree and
+// written below a deployment directory. Paths are relative, normalized,
+// slash-separated and use a restricted character set. Segments starting with
+// a dot are rejected: they are never served and the build reserves them.
+func ValidateTreePath(p string) error {
+	invalid := func(reason string) error {
+		return fmt.Errorf("%w: invalid path %q: %s", ErrInvalidInput, p, reason)
+	}
+
+	switch {
+	case p == "":
+		return invalid("path is empty")
+	case len(p) > MaxTreePathLength:
+		return invalid(fmt.Sprintf("longer than %d bytes", MaxTreePathLength))
+	case strings.HasPrefix(p, "/"):
+		return invalid("path must be relative")
+	case path.Clean(p) != p:
+		return invalid("path is not normalized")
+	}
+
+	segments := strings.Split(p, "/")
+	if len(segments) > MaxTreePathDepth {
+		return invalid(fmt.Sprintf("deeper than %d levels", MaxTreePathDepth))
+	}
+	for _, segment := range segments {
+		if segment == ".." {
+			return invalid("path must not leave its root")
+		}
+		if strings.HasPrefix(segment, ".") {
+			return invalid("hidden files and directories are not allowed")
+		}
+		if strings.TrimSpace(segment) != segment {
+			return invalid("segments must not start or end with a space")
+		}
+		for _, r := range segment {
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune(treePathPunctuation, r) {
+				return invalid(fmt.Sprintf("character %q is not allowed", r))
+			}
+		}
+	}
+	return nil
+}
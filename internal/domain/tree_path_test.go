@@ -0,0 +1,52 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateTreePath(t *testing.T) {
+	accepted := []string{
+		"index.md",
+		"docs/getting-started.md",
+		"guides/v1.2/install_linux.md",
+		"images/logo@2x.png",
+		"notes/meeting (draft).md",
+		"über/ñandú.md",
+		strings.Repeat("a/", MaxTreePathDepth-1) + "b.md",
+		strings.Repeat("a", MaxTreePathLength),
+	}
+	for _, p := range accepted {
+		assert.NoError(t, ValidateTreePath(p), p)
+	}
+
+	rejected := []string{
+		"",
+		"/etc/passwd",
+		"../secret.md",
+		"docs/../../etc/x",
+		"docs/..",
+		"./index.md",
+		"docs//index.md",
+		"docs/",
+		"docs/./index.md",
+		".git/config",
+		"docs/.env",
+		" index.md",
+		"docs/index.md ",
+		`docs\index.md`,
+		"docs/index?.md",
+		"docs/in\x00dex.md",
+		"docs/*.md",
+		strings.Repeat("a/", MaxTreePathDepth) + "b.md",
+		strings.Repeat("a", MaxTreePathLength+1),
+	}
+	for _, p := range rejected {
+		err := ValidateTreePath(p)
+		if assert.Error(t, err, p) {
+			assert.ErrorIs(t, err, ErrInvalidInput, p)
+		}
+	}
+}
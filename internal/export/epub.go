@@ -0,0 +1,266 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+
+	xhtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// epubStyle is the stylesheet of every chapter
+const epubStyle = `body { font-family: serif; line-height: 1.5; }
+h1, h2, h3, h4, h5, h6 { font-family: sans-serif; line-height: 1.2; }
+pre { background: #f5f5f5; padding: 0.6em; white-space: pre-wrap; font-size: 0.85em; }
+code { font-family: monospace; }
+blockquote { margin-left: 1em; padding-left: 1em; border-left: 3px solid #ccc; color: #555; }
+img { max-width: 100%; height: auto; }
+`
+
+// xmlName matches the attribute names that are valid in XHTML
+var xmlName = regexp.MustCompile(`^[A-Za-z_][-A-Za-z0-9_.]*$`)
+
+// WriteEPUB writes a book as an EPUB 3 publication, with a navigation
+// document and an NCX table of contents for older readers. The output is
+// reproducible: the same book always yields the same bytes.
+func WriteEPUB(w io.Writer, book *Book) error {
+	index := newChapterIndex(book.Chapters)
+	images := newImageSet(book)
+	chapters := make([]string, len(book.Chapters))
+	for i, c := range book.Chapters {
+		root, err := content(c)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", c.Path, err)
+		}
+		epubNodes(root, c.Path, index, images)
+		var body bytes.Buffer
+		for n := root.FirstChild; n != nil; n = n.NextSibling {
+			if err := xhtml.Render(&body, n); err != nil {
+				return fmt.Errorf("failed to render %s: %w", c.Path, err)
+			}
+		}
+		chapters[i] = xhtmlDocument(book, c.Title, "../style.css", `<section epub:type="chapter">`+"\n"+body.String()+"\n</section>")
+	}
+
+	zw := zip.NewWriter(w)
+	// The mimetype comes first, stored uncompressed and without extra
+	// fields, so readers can identify the file from its first bytes
+	mimetype := []byte("application/epub+zip")
+	entry, err := zw.CreateRaw(&zip.FileHeader{
+		Name:               "mimetype",
+		Method:             zip.Store,
+		CRC32:              crc32.ChecksumIEEE(mimetype),
+		CompressedSize64:   uint64(len(mimetype)),
+		UncompressedSize64: uint64(len(mimetype)),
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := entry.Write(mimetype); err != nil {
+		return err
+	}
+
+	files := []epubFile{
+		{"META-INF/container.xml", []byte(containerXML)},
+		{"OEBPS/content.opf", []byte(packageDocument(book, images))},
+		{"OEBPS/nav.xhtml", []byte(navDocument(book))},
+		{"OEBPS/toc.ncx", []byte(ncxDocument(book))},
+		{"OEBPS/style.css", []byte(epubStyle)},
+	}
+	for i, c := range chapters {
+		files = append(files, epubFile{"OEBPS/text/" + chapterFile(i), []byte(c)})
+	}
+	for _, img := range images.list {
+		files = append(files, epubFile{"OEBPS/images/" + img.name, img.data})
+	}
+	for _, f := range files {
+		entry, err := zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate})
+		if err != nil {
+			return err
+		}
+		if _, err := entry.Write(f.data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// epubFile is an entry of the publication after the mimetype
+type epubFile struct {
+	name string
+	data []byte
+}
+
+func chapterFile(i int) string {
+	return fmt.Sprintf("chapter-%03d.xhtml", i+1)
+}
+
+// epubNodes prepares the content of a chapter for the book: links between
+// pages point to chapters, local images are embedded, and links to other
+// files of the site, which the book does not carry, are removed
+func epubNodes(n *xhtml.Node, from string, index chapterIndex, images *imageSet) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type != xhtml.ElementNode {
+			c = next
+			continue
+		}
+		attrs := c.Attr[:0]
+		for _, a := range c.Attr {
+			// Event handlers would make the chapter scripted content
+			if a.Namespace == "" && xmlName.MatchString(a.Key) && !strings.HasPrefix(a.Key, "on") {
+				attrs = append(attrs, a)
+			}
+		}
+		c.Attr = attrs
+
+		switch c.DataAtom {
+		case atom.A:
+			if href := attr(c, "href"); href != "" {
+				chapter, fragment, local, ok := index.resolve(from, href)
+				switch {
+				case ok:
+					target := chapterFile(chapter)
+					if fragment != "" {
+						target += "#" + fragment
+					}
+					setAttr(c, "href", target)
+				case local:
+					removeAttr(c, "href")
+				}
+			}
+			removeAttr(c, "target")
+		case atom.Img:
+			img := images.load(from, attr(c, "src"))
+			if img == nil {
+				n.InsertBefore(&xhtml.Node{Type: xhtml.TextNode, Data: attr(c, "alt")}, c)
+				n.RemoveChild(c)
+				c = next
+				continue
+			}
+			setAttr(c, "src", "../images/"+img.name)
+			if attr(c, "alt") == "" {
+				setAttr(c, "alt", "")
+			}
+			for _, key := range []string{"srcset", "sizes", "loading", "decoding"} {
+				removeAttr(c, key)
+			}
+		}
+		epubNodes(c, from, index, images)
+		c = next
+	}
+}
+
+func setAttr(n *xhtml.Node, key, val string) {
+	for i := range n.Attr {
+		if n.Attr[i].Key == key {
+			n.Attr[i].Val = val
+			return
+		}
+	}
+	n.Attr = append(n.Attr, xhtml.Attribute{Key: key, Val: val})
+}
+
+func removeAttr(n *xhtml.Node, key string) {
+	attrs := n.Attr[:0]
+	for _, a := range n.Attr {
+		if a.Key != key {
+			attrs = append(attrs, a)
+		}
+	}
+	n.Attr = attrs
+}
+
+func language(book *Book) string {
+	if book.Language == "" {
+		return "en"
+	}
+	return book.Language
+}
+
+func xhtmlDocument(book *Book, title, stylesheet, body string) string {
+	lang := html.EscapeString(language(book))
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="` + lang + `" lang="` + lang + `">
+<head>
+<title>` + html.EscapeString(title) + `</title>
+<link rel="stylesheet" type="text/css" href="` + stylesheet + `"/>
+</head>
+<body>
+` + body + `
+</body>
+</html>
+`
+}
+
+const containerXML = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+<rootfiles>
+<rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+</rootfiles>
+</container>
+`
+
+func packageDocument(book *Book, images *imageSet) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id">
+<metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+`)
+	fmt.Fprintf(&b, "<dc:identifier id=\"book-id\">%s</dc:identifier>\n", html.EscapeString(book.Identifier))
+	fmt.Fprintf(&b, "<dc:title>%s</dc:title>\n", html.EscapeString(book.Title))
+	fmt.Fprintf(&b, "<dc:language>%s</dc:language>\n", html.EscapeString(language(book)))
+	fmt.Fprintf(&b, "<meta property=\"dcterms:modified\">%s</meta>\n", book.Modified.UTC().Format("2006-01-02T15:04:05Z"))
+	b.WriteString(`</metadata>
+<manifest>
+<item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+<item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>
+<item id="style" href="style.css" media-type="text/css"/>
+`)
+	for i := range book.Chapters {
+		fmt.Fprintf(&b, "<item id=\"chapter-%03d\" href=\"text/%s\" media-type=\"application/xhtml+xml\"/>\n", i+1, chapterFile(i))
+	}
+	for i, img := range images.list {
+		fmt.Fprintf(&b, "<item id=\"image-%03d\" href=\"images/%s\" media-type=\"%s\"/>\n", i+1, img.name, imageTypes[img.format])
+	}
+	b.WriteString("</manifest>\n<spine toc=\"ncx\">\n")
+	for i := range book.Chapters {
+		fmt.Fprintf(&b, "<itemref idref=\"chapter-%03d\"/>\n", i+1)
+	}
+	b.WriteString("</spine>\n</package>\n")
+	return b.String()
+}
+
+func navDocument(book *Book) string {
+	var b strings.Builder
+	b.WriteString("<nav epub:type=\"toc\" id=\"toc\">\n<h1>Contents</h1>\n<ol>\n")
+	for i, c := range book.Chapters {
+		fmt.Fprintf(&b, "<li><a href=\"text/%s\">%s</a></li>\n", chapterFile(i), html.EscapeString(c.Title))
+	}
+	b.WriteString("</ol>\n</nav>")
+	return xhtmlDocument(book, book.Title, "style.css", b.String())
+}
+
+func ncxDocument(book *Book) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1">
+<head>
+`)
+	fmt.Fprintf(&b, "<meta name=\"dtb:uid\" content=\"%s\"/>\n", html.EscapeString(book.Identifier))
+	b.WriteString("</head>\n")
+	fmt.Fprintf(&b, "<docTitle><text>%s</text></docTitle>\n<navMap>\n", html.EscapeString(book.Title))
+	for i, c := range book.Chapters {
+		fmt.Fprintf(&b, "<navPoint id=\"nav-%03d\" playOrder=\"%d\"><navLabel><text>%s</text></navLabel><content src=\"text/%s\"/></navPoint>\n",
+			i+1, i+1, html.EscapeString(c.Title), chapterFile(i))
+	}
+	b.WriteString("</navMap>\n</ncx>\n")
+	return b.String()
+}
@@ -0,0 +1,180 @@
+// Package export assembles the pages of a site into offline books. Pages
+// become chapters in navigation order; links between pages become links
+// inside the book and local images are embedded.
+package export
+
+import (
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Book is the input of an export
+type Book struct {
+	Title      string
+	Identifier string // unique and stable for the exported content, e.g. a commit URN
+	Language   string
+	Modified   time.Time
+	Chapters   []Chapter
+	// Resource returns a file of the site by URL path; it is used to embed
+	// images. It may be nil.
+	Resource func(urlPath string) ([]byte, error)
+}
+
+// Chapter is one page of a book
+type Chapter struct {
+	Title string
+	Path  string // URL path the page is served at
+	HTML  string // page body or full HTML document
+}
+
+// bookHost is the host page paths are resolved against
+const bookHost = "book.invalid"
+
+// content returns the node holding the content of a chapter: its <main>
+// element if it has one, its <body> otherwise. Navigation, scripts and
+// styles are dropped.
+func content(c Chapter) (*html.Node, error) {
+	doc, err := html.Parse(strings.NewReader(c.HTML))
+	if err != nil {
+		return nil, err
+	}
+	root := find(doc, atom.Main)
+	if root == nil {
+		root = find(doc, atom.Body)
+	}
+	if root == nil {
+		root = doc
+	}
+	prune(root)
+	return root, nil
+}
+
+func find(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := find(c, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// prune removes the parts of a page that have no place in a book
+func prune(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		switch {
+		case c.Type == html.CommentNode:
+			n.RemoveChild(c)
+		case c.Type == html.ElementNode && (c.DataAtom == atom.Script || c.DataAtom == atom.Style ||
+			c.DataAtom == atom.Nav || c.DataAtom == atom.Template || c.DataAtom == atom.Noscript ||
+			c.DataAtom == atom.Iframe || c.DataAtom == atom.Form || c.DataAtom == atom.Source ||
+			c.DataAtom == atom.Link || c.DataAtom == atom.Meta):
+			n.RemoveChild(c)
+		case c.Type == html.ElementNode && c.DataAtom == atom.Aside && hasClass(c, "backlinks"):
+			n.RemoveChild(c)
+		default:
+			prune(c)
+		}
+		c = next
+	}
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasClass(n *html.Node, class string) bool {
+	for _, c := range strings.Fields(attr(n, "class")) {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// text returns the text content of a node
+func text(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return b.String()
+}
+
+// chapterIndex maps the URL paths of the chapters to their position
+type chapterIndex map[string]int
+
+func newChapterIndex(chapters []Chapter) chapterIndex {
+	index := make(chapterIndex, len(chapters))
+	for i, c := range chapters {
+		index[pageKey(c.Path)] = i
+	}
+	return index
+}
+
+// resolve resolves a link found in the chapter served at from. It returns
+// the linked chapter and fragment for links between chapters; local is set
+// for any other link to a path of the site.
+func (idx chapterIndex) resolve(from, href string) (chapter int, fragment string, local bool, ok bool) {
+	target, local := localPath(from, href)
+	if !local {
+		return 0, "", false, false
+	}
+	if i, ok := idx[pageKey(target)]; ok {
+		_, fragment, _ = strings.Cut(href, "#")
+		return i, fragment, true, true
+	}
+	return 0, "", true, false
+}
+
+// pageKey normalizes a URL path: /guide, /guide/, /guide.html and
+// /guide/index.html all reach the same page
+func pageKey(p string) string {
+	p = path.Clean("/" + p)
+	for _, ext := range []string{".html", ".htm", ".md"} {
+		if strings.HasSuffix(strings.ToLower(p), ext) {
+			p = p[:len(p)-len(ext)]
+			break
+		}
+	}
+	p = strings.TrimSuffix(p, "/index")
+	if p == "" || p == "/index" {
+		return "/"
+	}
+	return p
+}
+
+// localPath resolves a reference found in the chapter served at from to a
+// URL path of the site. ok is false for references to other hosts.
+func localPath(from, href string) (string, bool) {
+	base := &url.URL{Scheme: "https", Host: bookHost, Path: from}
+	ref, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return "", false
+	}
+	target := base.ResolveReference(ref)
+	if target.Host != bookHost {
+		return "", false
+	}
+	return target.Path, true
+}
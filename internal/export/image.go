@@ -0,0 +1,82 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"path"
+	"strings"
+
+	_ "golang.org/x/image/webp"
+)
+
+// imageTypes are the media types of the image formats embedded in books
+var imageTypes = map[string]string{
+	"png":  "image/png",
+	"jpeg": "image/jpeg",
+	"gif":  "image/gif",
+	"webp": "image/webp",
+	"svg":  "image/svg+xml",
+}
+
+// bookImage is an image embedded in a book
+type bookImage struct {
+	name   string // file name inside the book
+	data   []byte
+	format string // key of imageTypes
+	width  int
+	height int
+
+	// pdfData is the image converted for the PDF writer, see pdfImage
+	pdfData []byte
+	pdfType string
+}
+
+// imageSet loads the local images of a book once each, in order of first use
+type imageSet struct {
+	resource func(urlPath string) ([]byte, error)
+	byPath   map[string]*bookImage
+	list     []*bookImage
+}
+
+func newImageSet(book *Book) *imageSet {
+	return &imageSet{resource: book.Resource, byPath: make(map[string]*bookImage)}
+}
+
+// load returns the image referenced by src on the chapter served at from,
+// or nil if it is remote, missing or not a supported image
+func (s *imageSet) load(from, src string) *bookImage {
+	p, ok := localPath(from, src)
+	if !ok || s.resource == nil {
+		return nil
+	}
+	if img, ok := s.byPath[p]; ok {
+		return img
+	}
+	s.byPath[p] = nil
+
+	data, err := s.resource(p)
+	if err != nil {
+		return nil
+	}
+	img := &bookImage{data: data}
+	if cfg, format, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		img.format, img.width, img.height = format, cfg.Width, cfg.Height
+	} else if strings.EqualFold(path.Ext(p), ".svg") {
+		img.format = "svg"
+	}
+	if _, ok := imageTypes[img.format]; !ok {
+		return nil
+	}
+	ext := img.format
+	if ext == "jpeg" {
+		ext = "jpg"
+	}
+	img.name = fmt.Sprintf("image-%03d.%s", len(s.list)+1, ext)
+	s.byPath[p] = img
+	s.list = append(s.list, img)
+	return img
+}
@@ -0,0 +1,585 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/go-pdf/fpdf"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gobolditalic"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// PDF layout, in millimetres for distances and points for font sizes
+const (
+	pdfMargin     = 20.0
+	pdfLineHeight = 5.5
+	pdfCodeHeight = 4.2
+	pdfIndent     = 6.0
+	pdfBodySize   = 10.5
+	pdfCodeSize   = 8.5
+	pdfPixelMM    = 25.4 / 96 // size of a CSS pixel
+)
+
+var pdfHeadingSizes = [6]float64{20, 16, 13.5, 12, 11, 10.5}
+
+var whitespace = regexp.MustCompile(`[ \t\r\n\f]+`)
+
+// pdfBlocks are the elements laid out as blocks; everything else flows
+// inline
+var pdfBlocks = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Pre: true, atom.Ul: true, atom.Ol: true, atom.Li: true, atom.Blockquote: true, atom.Hr: true, atom.Table: true,
+	atom.Section: true, atom.Article: true, atom.Header: true, atom.Footer: true, atom.Figure: true, atom.Figcaption: true,
+	atom.Dl: true, atom.Dt: true, atom.Dd: true, atom.Aside: true, atom.Main: true, atom.Address: true, atom.Details: true,
+	atom.Summary: true,
+}
+
+// WritePDF writes a book as a print-ready A4 PDF: a title page, a table of
+// contents with page numbers, then every chapter starting on a new page.
+// Pages are numbered in their footer, links between chapters and to their
+// headings stay clickable and code blocks keep their line breaks.
+func WritePDF(w io.Writer, book *Book) error {
+	// The table of contents lists the page every chapter starts on, so the
+	// book is laid out twice: the first pass only measures
+	images := newImageSet(book)
+	measured, err := layoutPDF(book, images, nil)
+	if err != nil {
+		return err
+	}
+	final, err := layoutPDF(book, images, measured)
+	if err != nil {
+		return err
+	}
+	return final.pdf.Output(w)
+}
+
+// pdfStyle is the inline style text is written with
+type pdfStyle struct {
+	size   float64
+	bold   bool
+	italic bool
+	mono   bool
+	gray   bool
+	linkID int
+	linkTo string
+}
+
+type pdfRenderer struct {
+	pdf      *fpdf.Fpdf
+	book     *Book
+	index    chapterIndex
+	images   *imageSet
+	measured *pdfRenderer // first pass, nil while measuring
+
+	chapter      int
+	from         string
+	chapterPages []int
+	anchors      map[string]bool // chapter#fragment keys defined in the book
+	links        map[string]int  // link ids by chapter#fragment key
+	style        pdfStyle
+	lineStart    bool
+}
+
+func layoutPDF(book *Book, images *imageSet, measured *pdfRenderer) (*pdfRenderer, error) {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(pdfMargin, pdfMargin, pdfMargin)
+	pdf.SetAutoPageBreak(true, pdfMargin)
+	pdf.SetCompression(true)
+	pdf.SetCatalogSort(true)
+	pdf.SetCreationDate(book.Modified)
+	pdf.SetModificationDate(book.Modified)
+	pdf.SetTitle(book.Title, true)
+	pdf.SetCreator("OpenBook", true)
+	for _, font := range []struct {
+		family, style string
+		ttf           []byte
+	}{
+		{"go", "", goregular.TTF}, {"go", "B", gobold.TTF}, {"go", "I", goitalic.TTF}, {"go", "BI", gobolditalic.TTF},
+		{"gomono", "", gomono.TTF}, {"gomono", "B", gomonobold.TTF},
+	} {
+		pdf.AddUTF8FontFromBytes(font.family, font.style, font.ttf)
+	}
+
+	r := &pdfRenderer{
+		pdf:          pdf,
+		book:         book,
+		index:        newChapterIndex(book.Chapters),
+		images:       images,
+		measured:     measured,
+		chapterPages: make([]int, len(book.Chapters)),
+		anchors:      make(map[string]bool),
+		links:        make(map[string]int),
+		style:        pdfStyle{size: pdfBodySize},
+		lineStart:    true,
+	}
+	pdf.SetFooterFunc(r.footer)
+
+	r.titlePage()
+	r.contents()
+	for i, c := range book.Chapters {
+		root, err := content(c)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", c.Path, err)
+		}
+		r.chapter, r.from = i, c.Path
+		pdf.AddPage()
+		r.chapterPages[i] = pdf.PageNo()
+		r.define(anchorKey(i, ""))
+		pdf.Bookmark(c.Title, 0, -1)
+		if find(root, atom.H1) == nil {
+			r.heading(1, func() { r.write(c.Title) })
+		}
+		r.flow(root)
+		r.endLine()
+	}
+	if err := pdf.Error(); err != nil {
+		return nil, fmt.Errorf("failed to lay out PDF: %w", err)
+	}
+	return r, nil
+}
+
+func (r *pdfRenderer) titlePage() {
+	r.pdf.AddPage()
+	r.pdf.SetY(90)
+	r.pdf.SetFont("go", "B", 28)
+	r.pdf.MultiCell(0, 12, r.book.Title, "", "C", false)
+	r.pdf.Ln(6)
+	r.pdf.SetFont("go", "", 11)
+	r.pdf.SetTextColor(100, 100, 100)
+	r.pdf.CellFormat(0, 6, r.book.Modified.UTC().Format("January 2, 2006"), "", 1, "C", false, 0, "")
+	r.pdf.SetTextColor(0, 0, 0)
+}
+
+// contents writes the table of contents. Page numbers are left blank while
+// measuring; the layout does not depend on them.
+func (r *pdfRenderer) contents() {
+	r.pdf.AddPage()
+	r.pdf.SetFont("go", "B", pdfHeadingSizes[0])
+	r.pdf.CellFormat(0, 12, "Contents", "", 1, "L", false, 0, "")
+	r.pdf.Ln(4)
+	r.pdf.SetFont("go", "", pdfBodySize)
+	width, _ := r.pdf.GetPageSize()
+	numberWidth := 15.0
+	titleWidth := width - 2*pdfMargin - numberWidth
+	for i, c := range r.book.Chapters {
+		link := r.link(anchorKey(i, ""))
+		number := ""
+		if r.measured != nil {
+			number = fmt.Sprint(r.measured.chapterPages[i])
+		}
+		r.pdf.CellFormat(titleWidth, 7, r.fit(c.Title, titleWidth), "", 0, "L", false, link, "")
+		r.pdf.CellFormat(numberWidth, 7, number, "", 1, "R", false, link, "")
+	}
+}
+
+// fit shortens a text to the given width
+func (r *pdfRenderer) fit(s string, width float64) string {
+	if r.pdf.GetStringWidth(s) <= width {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 && r.pdf.GetStringWidth(string(runes)+"…") > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "…"
+}
+
+func (r *pdfRenderer) footer() {
+	page := r.pdf.PageNo()
+	if page == 1 {
+		return
+	}
+	label := fmt.Sprint(page)
+	if r.measured != nil {
+		label = fmt.Sprintf("%d / %d", page, r.measured.pdf.PageNo())
+	}
+	r.pdf.SetY(-pdfMargin + 5)
+	r.pdf.SetFont("go", "", 8)
+	r.pdf.SetTextColor(120, 120, 120)
+	r.pdf.CellFormat(0, 5, label, "", 0, "C", false, 0, "")
+	r.pdf.SetTextColor(0, 0, 0)
+	r.applyFont()
+}
+
+func anchorKey(chapter int, fragment string) string {
+	return fmt.Sprintf("%d#%s", chapter, fragment)
+}
+
+// link returns the link id of a link target, creating it on first use
+func (r *pdfRenderer) link(key string) int {
+	id, ok := r.links[key]
+	if !ok {
+		id = r.pdf.AddLink()
+		r.links[key] = id
+	}
+	return id
+}
+
+// define marks the current position as a link target
+func (r *pdfRenderer) define(key string) {
+	r.anchors[key] = true
+	if r.measured != nil && r.measured.anchors[key] {
+		r.pdf.SetLink(r.link(key), r.pdf.GetY(), r.pdf.PageNo())
+	}
+}
+
+// anchor defines the fragment identifiers of an element
+func (r *pdfRenderer) anchor(n *html.Node) {
+	if id := attr(n, "id"); id != "" {
+		r.define(anchorKey(r.chapter, id))
+	}
+	if n.DataAtom == atom.A {
+		if name := attr(n, "name"); name != "" {
+			r.define(anchorKey(r.chapter, name))
+		}
+	}
+}
+
+func (r *pdfRenderer) applyFont() {
+	family, style := "go", ""
+	if r.style.mono {
+		family = "gomono"
+	}
+	if r.style.bold {
+		style += "B"
+	}
+	if r.style.italic && !r.style.mono {
+		style += "I"
+	}
+	r.pdf.SetFont(family, style, r.style.size)
+	switch {
+	case r.style.linkID != 0 || r.style.linkTo != "":
+		r.pdf.SetTextColor(30, 80, 180)
+	case r.style.gray:
+		r.pdf.SetTextColor(90, 90, 90)
+	default:
+		r.pdf.SetTextColor(0, 0, 0)
+	}
+}
+
+// with runs fn with a changed inline style
+func (r *pdfRenderer) with(change func(*pdfStyle), fn func()) {
+	saved := r.style
+	change(&r.style)
+	r.applyFont()
+	fn()
+	r.style = saved
+	r.applyFont()
+}
+
+// write flows text in the current style, collapsing whitespace like HTML
+func (r *pdfRenderer) write(s string) {
+	s = whitespace.ReplaceAllString(s, " ")
+	if r.lineStart {
+		s = strings.TrimLeft(s, " ")
+	}
+	if s == "" {
+		return
+	}
+	r.applyFont()
+	height := r.lineHeight()
+	switch {
+	case r.style.linkID != 0:
+		r.pdf.WriteLinkID(height, s, r.style.linkID)
+	case r.style.linkTo != "":
+		r.pdf.WriteLinkString(height, s, r.style.linkTo)
+	default:
+		r.pdf.Write(height, s)
+	}
+	r.lineStart = false
+}
+
+func (r *pdfRenderer) lineHeight() float64 {
+	return max(pdfLineHeight, r.style.size*0.5)
+}
+
+// endLine moves to the start of the next line unless already there
+func (r *pdfRenderer) endLine() {
+	if !r.lineStart {
+		r.pdf.Ln(r.lineHeight())
+		r.lineStart = true
+	}
+}
+
+func (r *pdfRenderer) space(h float64) {
+	r.endLine()
+	r.pdf.Ln(h)
+}
+
+// flow lays out the children of a node
+func (r *pdfRenderer) flow(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && pdfBlocks[c.DataAtom] {
+			r.endLine()
+			r.block(c)
+		} else {
+			r.inline(c)
+		}
+	}
+}
+
+func (r *pdfRenderer) block(n *html.Node) {
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		r.heading(int(n.Data[1]-'0'), func() {
+			r.anchor(n)
+			r.flow(n)
+		})
+	case atom.Pre:
+		r.anchor(n)
+		r.code(text(n))
+	case atom.Ul, atom.Ol:
+		r.anchor(n)
+		r.list(n)
+	case atom.Blockquote:
+		r.anchor(n)
+		r.indented(pdfIndent, func() {
+			r.with(func(s *pdfStyle) { s.gray = true }, func() { r.flow(n) })
+		})
+		r.space(1.5)
+	case atom.Hr:
+		r.space(2)
+		width, _ := r.pdf.GetPageSize()
+		y := r.pdf.GetY()
+		r.pdf.SetDrawColor(180, 180, 180)
+		r.pdf.Line(pdfMargin, y, width-pdfMargin, y)
+		r.pdf.Ln(4)
+	case atom.Table:
+		r.anchor(n)
+		r.table(n)
+	case atom.P:
+		r.anchor(n)
+		r.flow(n)
+		r.space(2)
+	default:
+		r.anchor(n)
+		r.flow(n)
+		r.endLine()
+	}
+}
+
+func (r *pdfRenderer) heading(level int, fn func()) {
+	_, height := r.pdf.GetPageSize()
+	// Keep a heading together with the start of its section
+	if r.pdf.GetY() > height-pdfMargin-25 {
+		r.pdf.AddPage()
+	} else {
+		r.pdf.Ln(3)
+	}
+	r.with(func(s *pdfStyle) { s.size, s.bold = pdfHeadingSizes[level-1], true }, fn)
+	r.space(1.5)
+}
+
+// code writes a code block in a monospaced font on a shaded background,
+// keeping its line breaks and wrapping lines wider than the page
+func (r *pdfRenderer) code(src string) {
+	src = strings.TrimRight(strings.ReplaceAll(src, "\t", "    "), "\n")
+	r.pdf.Ln(1)
+	r.with(func(s *pdfStyle) { s.mono, s.size = true, pdfCodeSize }, func() {
+		r.pdf.SetFillColor(245, 245, 245)
+		r.pdf.MultiCell(0, pdfCodeHeight, src, "", "L", true)
+	})
+	r.lineStart = true
+	r.pdf.Ln(3)
+}
+
+func (r *pdfRenderer) list(n *html.Node) {
+	number := 0
+	for li := n.FirstChild; li != nil; li = li.NextSibling {
+		if li.Type != html.ElementNode || li.DataAtom != atom.Li {
+			continue
+		}
+		number++
+		marker := "•"
+		if n.DataAtom == atom.Ol {
+			marker = fmt.Sprintf("%d.", number)
+		}
+		left, _, _, _ := r.pdf.GetMargins()
+		r.pdf.SetX(left)
+		r.applyFont()
+		r.pdf.CellFormat(pdfIndent, r.lineHeight(), marker, "", 0, "L", false, 0, "")
+		r.indented(pdfIndent, func() {
+			r.lineStart = true
+			r.anchor(li)
+			r.flow(li)
+			r.endLine()
+		})
+	}
+	r.pdf.Ln(1.5)
+}
+
+// indented runs fn with the left margin moved right
+func (r *pdfRenderer) indented(by float64, fn func()) {
+	left, _, _, _ := r.pdf.GetMargins()
+	r.pdf.SetLeftMargin(left + by)
+	fn()
+	r.endLine()
+	r.pdf.SetLeftMargin(left)
+	r.pdf.SetX(left)
+}
+
+// table writes each row of a table as a line of cells
+func (r *pdfRenderer) table(n *html.Node) {
+	var rows func(*html.Node)
+	rows = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			if c.DataAtom != atom.Tr {
+				rows(c)
+				continue
+			}
+			first := true
+			for cell := c.FirstChild; cell != nil; cell = cell.NextSibling {
+				if cell.Type != html.ElementNode || (cell.DataAtom != atom.Td && cell.DataAtom != atom.Th) {
+					continue
+				}
+				if !first {
+					r.write(" | ")
+				}
+				first = false
+				r.with(func(s *pdfStyle) { s.bold = s.bold || cell.DataAtom == atom.Th }, func() { r.flow(cell) })
+			}
+			r.endLine()
+		}
+	}
+	rows(n)
+	r.space(2)
+}
+
+func (r *pdfRenderer) inline(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		r.write(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+
+	r.anchor(n)
+	switch n.DataAtom {
+	case atom.Strong, atom.B:
+		r.with(func(s *pdfStyle) { s.bold = true }, func() { r.flow(n) })
+	case atom.Em, atom.I, atom.Cite:
+		r.with(func(s *pdfStyle) { s.italic = true }, func() { r.flow(n) })
+	case atom.Code, atom.Kbd, atom.Samp, atom.Tt:
+		r.with(func(s *pdfStyle) { s.mono, s.size = true, s.size*0.9 }, func() { r.flow(n) })
+	case atom.A:
+		linkID, linkTo := r.target(attr(n, "href"))
+		r.with(func(s *pdfStyle) { s.linkID, s.linkTo = linkID, linkTo }, func() { r.flow(n) })
+	case atom.Br:
+		r.pdf.Ln(r.lineHeight())
+		r.lineStart = true
+	case atom.Img:
+		r.image(n)
+	default:
+		r.flow(n)
+	}
+}
+
+// target resolves the href of a link: links to a chapter or one of its
+// anchors become internal links, web and mail links stay external, links
+// to other files of the site are dropped
+func (r *pdfRenderer) target(href string) (int, string) {
+	if href == "" {
+		return 0, ""
+	}
+	if chapter, fragment, _, ok := r.index.resolve(r.from, href); ok {
+		key := anchorKey(chapter, fragment)
+		if r.measured == nil || !r.measured.anchors[key] {
+			key = anchorKey(chapter, "")
+		}
+		return r.link(key), ""
+	}
+	if u, err := url.Parse(href); err == nil && (u.Scheme == "http" || u.Scheme == "https" || u.Scheme == "mailto") {
+		return 0, href
+	}
+	return 0, ""
+}
+
+// image places an image on its own lines, scaled down to the page width.
+// Images that cannot be embedded are replaced by their alternative text.
+func (r *pdfRenderer) image(n *html.Node) {
+	img := r.images.load(r.from, attr(n, "src"))
+	data, imageType := pdfImage(img)
+	if data == nil {
+		if alt := attr(n, "alt"); alt != "" {
+			r.with(func(s *pdfStyle) { s.italic = true }, func() { r.write("[" + alt + "]") })
+		}
+		return
+	}
+
+	r.endLine()
+	pageWidth, pageHeight := r.pdf.GetPageSize()
+	left, _, right, _ := r.pdf.GetMargins()
+	width := float64(img.width) * pdfPixelMM
+	height := float64(img.height) * pdfPixelMM
+	if maxWidth := pageWidth - left - right; width > maxWidth {
+		width, height = maxWidth, height*maxWidth/width
+	}
+	if maxHeight := pageHeight - 2*pdfMargin; height > maxHeight {
+		width, height = width*maxHeight/height, maxHeight
+	}
+	if r.pdf.GetY()+height > pageHeight-pdfMargin {
+		r.pdf.AddPage()
+	}
+
+	options := fpdf.ImageOptions{ImageType: imageType}
+	if info := r.pdf.GetImageInfo(img.name); info == nil {
+		r.pdf.RegisterImageOptionsReader(img.name, options, bytes.NewReader(data))
+	}
+	y := r.pdf.GetY()
+	r.pdf.ImageOptions(img.name, left, y, width, height, false, options, 0, "")
+	r.pdf.SetY(y + height + 2)
+	r.lineStart = true
+}
+
+// pdfImage converts an image to a PNG or JPEG the PDF writer embeds. The
+// image is decoded and encoded again, so variants the writer cannot read
+// (interlaced or 16-bit PNGs, CMYK JPEGs, GIFs, WebP) are normalized.
+func pdfImage(img *bookImage) ([]byte, string) {
+	if img == nil || img.format == "svg" {
+		return nil, ""
+	}
+	if img.pdfData != nil {
+		return img.pdfData, img.pdfType
+	}
+	decoded, _, err := image.Decode(bytes.NewReader(img.data))
+	if err != nil {
+		return nil, ""
+	}
+	b := decoded.Bounds()
+	var buf bytes.Buffer
+	if img.format == "jpeg" {
+		rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(rgba, rgba.Bounds(), decoded, b.Min, draw.Src)
+		if err := jpeg.Encode(&buf, rgba, &jpeg.Options{Quality: 90}); err != nil {
+			return nil, ""
+		}
+		img.pdfData, img.pdfType = buf.Bytes(), "JPG"
+		return img.pdfData, img.pdfType
+	}
+	nrgba := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(nrgba, nrgba.Bounds(), decoded, b.Min, draw.Src)
+	if err := png.Encode(&buf, nrgba); err != nil {
+		return nil, ""
+	}
+	img.pdfData, img.pdfType = buf.Bytes(), "PNG"
+	return img.pdfData, img.pdfType
+}
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"openbook/internal/usecase"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type AdminHandler struct {
+	queueUC *usecase.QueueUseCase
+}
+
+func NewAdminHandler(queueUC *usecase.QueueUseCase) *AdminHandler {
+	return &AdminHandler{queueUC: queueUC}
+}
+
+func (h *AdminHandler) ListDeadLetters(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", 50)
+	if limit < 1 || limit > 500 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "limit must be between 1 and 500"})
+	}
+
+	letters, err := h.queueUC.ListDeadLetters(c.Context(), int64(limit))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(letters)
+}
+
+func (h *AdminHandler) RequeueDeadLetter(c *fiber.Ctx) error {
+	userIDStr, _ := c.Locals("user_id").(string)
+	userID, _ := uuid.Parse(userIDStr)
+
+	letter, err := h.queueUC.RequeueDeadLetter(c.Context(), c.Params("id"), userID)
+	if err != nil {
+		return c.Status(errorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(letter)
+}
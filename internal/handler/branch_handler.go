@@ -78,3 +78,33 @@ func (h *BranchHandler) Get(c *fiber.Ctx) error {
 
 	return c.JSON(branch)
 }
+
+func (h *BranchHandler) Delete(c *fiber.Ctx) error {
+	siteIDStr := c.Query("site_id")
+	name := c.Query("name")
+
+	if siteIDStr == "" || name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "site_id and name are required"})
+	}
+
+	workspaceIDStr, ok := c.Locals("workspace_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	workspaceID, err := uuid.Parse(workspaceIDStr)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid workspace ID"})
+	}
+
+	siteID, err := uuid.Parse(siteIDStr)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid site ID"})
+	}
+
+	if err := h.uc.DeleteBranch(c.Context(), workspaceID, siteID, name); err != nil {
+		return c.Status(errorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
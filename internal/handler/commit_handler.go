@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"openbook/internal/usecase"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type CommitHandler struct {
+	uc *usecase.GitUseCase
+}
+
+func NewCommitHandler(uc *usecase.GitUseCase) *CommitHandler {
+	return &CommitHandler{uc: uc}
+}
+
+func (h *CommitHandler) Create(c *fiber.Ctx) error {
+	var req struct {
+		SiteID  string                     `json:"site_id"`
+		Branch  string                     `json:"branch"`
+		Message string                     `json:"message"`
+		Files   map[string]json.RawMessage `json:"files"` // path -> content, see decodeCommitFile
+	}
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	workspaceIDStr, ok := c.Locals("workspace_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	workspaceID, err := uuid.Parse(workspaceIDStr)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid workspace ID"})
+	}
+
+	siteID, err := uuid.Parse(req.SiteID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid site ID"})
+	}
+
+	if req.Branch == "" || len(req.Files) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "branch and files are required"})
+	}
+
+	userIDStr, _ := c.Locals("user_id").(string)
+	userID, _ := uuid.Parse(userIDStr)
+
+	files := make(map[string][]byte, len(req.Files))
+	for path, raw := range req.Files {
+		content, err := decodeCommitFile(raw)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("Invalid content of %s: %v", path, err)})
+		}
+		files[path] = content
+	}
+
+	commit, err := h.uc.CommitChanges(c.Context(), workspaceID, siteID, req.Branch, req.Message, userID, files)
+	if err != nil {
+		return c.Status(errorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(commit)
+}
+
+// decodeCommitFile returns the content of a committed file. Text files are
+// given as a JSON string; JSON strings cannot carry arbitrary bytes, so
+// binary files, such as images, are given as
+// {"content": "<base64>", "encoding": "base64"}.
+func decodeCommitFile(raw json.RawMessage) ([]byte, error) {
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return []byte(text), nil
+	}
+	var file struct {
+		Content  string `json:"content"`
+		Encoding string `json:"encoding"`
+	}
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("expected a string or an object with content and encoding")
+	}
+	switch file.Encoding {
+	case "", "utf-8":
+		return []byte(file.Content), nil
+	case "base64":
+		content, err := base64.StdEncoding.DecodeString(file.Content)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64: %v", err)
+		}
+		return content, nil
+	default:
+		return nil, fmt.Errorf("unknown encoding %q", file.Encoding)
+	}
+}
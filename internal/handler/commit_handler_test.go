@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"openbook/internal/domain"
+	"openbook/internal/repository"
+	"openbook/internal/usecase"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommitHandler_Create_InvalidPath(t *testing.T) {
+	// Paths are validated before the repository is used
+	h := NewCommitHandler(usecase.NewGitUseCase(nil))
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("workspace_id", uuid.NewString())
+		c.Locals("user_id", uuid.NewString())
+		return c.Next()
+	})
+	app.Post("/commits", h.Create)
+
+	for _, path := range []string{"../../etc/x", "/etc/passwd", "docs/.env"} {
+		body, err := json.Marshal(fiber.Map{
+			"site_id": uuid.NewString(),
+			"branch":  "main",
+			"message": "update",
+			"files":   fiber.Map{"index.md": "# Home", path: "x"},
+		})
+		require.NoError(t, err)
+
+		req := httptest.NewRequest("POST", "/commits", strings.NewReader(string(body)))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+
+		var res struct {
+			Error string `json:"error"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+		resp.Body.Close()
+
+		assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode, path)
+		assert.Contains(t, res.Error, "invalid path", path)
+	}
+}
+
+// fakeGit stores what a commit writes
+type fakeGit struct {
+	repository.GitRepository
+	branch *domain.Branch
+	blobs  map[string]*domain.Blob
+	trees  []domain.Tree
+}
+
+func (f *fakeGit) GetBranch(ctx context.Context, siteID uuid.UUID, name string) (*domain.Branch, error) {
+	if f.branch.SiteID != siteID || f.branch.Name != name {
+		return nil, domain.ErrNotFound
+	}
+	return f.branch, nil
+}
+
+func (f *fakeGit) CreateBlob(ctx context.Context, blob *domain.Blob) error {
+	f.blobs[blob.Hash] = blob
+	return nil
+}
+
+func (f *fakeGit) CreateCommit(ctx context.Context, commit *domain.Commit) error { return nil }
+
+func (f *fakeGit) CreateTree(ctx context.Context, tree *domain.Tree) error {
+	f.trees = append(f.trees, *tree)
+	return nil
+}
+
+func (f *fakeGit) UpdateBranch(ctx context.Context, branch *domain.Branch) error { return nil }
+
+func testPNG(t *testing.T) []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 32))
+	for x := 0; x < 64; x++ {
+		for y := 0; y < 32; y++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x * 4), G: uint8(y * 8), B: 0x80, A: 0xff})
+		}
+	}
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+func TestCommitHandler_Create_BinaryFile(t *testing.T) {
+	workspaceID, siteID := uuid.New(), uuid.New()
+	git := &fakeGit{
+		branch: &domain.Branch{ID: uuid.New(), WorkspaceID: workspaceID, SiteID: siteID, Name: "main"},
+		blobs:  map[string]*domain.Blob{},
+	}
+	h := NewCommitHandler(usecase.NewGitUseCase(git))
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("workspace_id", workspaceID.String())
+		return c.Next()
+	})
+	app.Post("/commits", h.Create)
+
+	post := func(files fiber.Map) int {
+		body, err := json.Marshal(fiber.Map{"site_id": siteID, "branch": "main", "message": "add logo", "files": files})
+		require.NoError(t, err)
+		req := httptest.NewRequest("POST", "/commits", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	logo := testPNG(t)
+	require.Equal(t, fiber.StatusCreated, post(fiber.Map{
+		"index.md":      "![Logo](img/logo.png)",
+		"img/logo.png":  fiber.Map{"content": base64.StdEncoding.EncodeToString(logo), "encoding": "base64"},
+		"notes/todo.md": fiber.Map{"content": "- ship it"},
+	}))
+
+	stored := map[string][]byte{}
+	for _, tree := range git.trees {
+		stored[tree.Path] = domain.DecodeBlobContent(git.blobs[tree.BlobHash].ContentJSON)
+	}
+	assert.Equal(t, logo, stored["img/logo.png"], "binary content is stored byte for byte")
+	assert.Equal(t, "![Logo](img/logo.png)", string(stored["index.md"]))
+	assert.Equal(t, "- ship it", string(stored["notes/todo.md"]))
+
+	for _, file := range []interface{}{
+		fiber.Map{"content": "not base64!", "encoding": "base64"},
+		fiber.Map{"content": "x", "encoding": "gzip"},
+		42,
+	} {
+		assert.Equal(t, fiber.StatusBadRequest, post(fiber.Map{"img/logo.png": file}), file)
+	}
+}
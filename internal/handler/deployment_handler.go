@@ -1,6 +1,14 @@
 package handler
 
 import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
 	"openbook/internal/domain"
 	"openbook/internal/usecase"
 
@@ -21,6 +29,8 @@ func (h *DeploymentHandler) Create(c *fiber.Ctx) error {
 		SiteID        string `json:"site_id"`
 		EnvironmentID string `json:"environment_id"`
 		CommitHash    string `json:"commit_hash"`
+		// ScheduledAt, an RFC 3339 time, publishes the deployment later
+		ScheduledAt *time.Time `json:"scheduled_at"`
 	}
 
 	if err := c.BodyParser(&req); err != nil {
@@ -53,26 +63,330 @@ func (h *DeploymentHandler) Create(c *fiber.Ctx) error {
 		SiteID:        siteID,
 		EnvironmentID: envID,
 		CommitHash:    req.CommitHash,
+		ScheduledAt:   req.ScheduledAt,
 		// TriggeredBy: userID from context (TODO)
 	}
 
 	if err := h.uc.Create(c.Context(), deployment); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return c.Status(errorStatus(err)).JSON(fiber.Map{"error": err.Error()})
 	}
 
 	return c.Status(fiber.StatusCreated).JSON(deployment)
 }
 
 func (h *DeploymentHandler) GetByID(c *fiber.Ctx) error {
+	workspaceIDStr, ok := c.Locals("workspace_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	workspaceID, err := uuid.Parse(workspaceIDStr)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid workspace ID"})
+	}
+
 	id, err := uuid.Parse(c.Params("id"))
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
 	}
 
-	d, err := h.uc.GetByID(c.Context(), id)
-	if err != nil {
+	d, err := h.uc.GetByID(c.Context(), workspaceID, id)
+	if errors.Is(err, domain.ErrNotFound) {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Deployment not found"})
 	}
+	if err != nil {
+		return c.Status(errorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
 
 	return c.JSON(d)
 }
+
+// List returns a page of the workspace's deployments, newest first unless
+// sort=created_at. Filters: site_id, environment_id, status, triggered_by and
+// the RFC 3339 bounds from (inclusive) and to (exclusive).
+func (h *DeploymentHandler) List(c *fiber.Ctx) error {
+	workspaceIDStr, ok := c.Locals("workspace_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	workspaceID, err := uuid.Parse(workspaceIDStr)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid workspace ID"})
+	}
+
+	filter := domain.DeploymentFilter{
+		WorkspaceID: workspaceID,
+		Status:      c.Query("status"),
+		Limit:       c.QueryInt("limit", 0),
+	}
+
+	for param, dst := range map[string]**uuid.UUID{
+		"site_id":        &filter.SiteID,
+		"environment_id": &filter.EnvironmentID,
+		"triggered_by":   &filter.TriggeredBy,
+	} {
+		if v := c.Query(param); v != "" {
+			id, err := uuid.Parse(v)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid " + param})
+			}
+			*dst = &id
+		}
+	}
+
+	for param, dst := range map[string]**time.Time{
+		"from": &filter.CreatedAfter,
+		"to":   &filter.CreatedBefore,
+	} {
+		if v := c.Query(param); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid " + param + ", expected RFC 3339"})
+			}
+			*dst = &t
+		}
+	}
+
+	switch c.Query("sort", "-created_at") {
+	case "-created_at":
+	case "created_at":
+		filter.Ascending = true
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "sort must be created_at or -created_at"})
+	}
+
+	page, err := h.uc.List(c.Context(), filter, c.Query("cursor"))
+	if err != nil {
+		return c.Status(errorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(page)
+}
+
+// Cancel stops a scheduled, pending or building deployment. A building one is
+// answered with 202 since its worker finishes the cancellation.
+func (h *DeploymentHandler) Cancel(c *fiber.Ctx) error {
+	workspaceIDStr, ok := c.Locals("workspace_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	workspaceID, err := uuid.Parse(workspaceIDStr)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid workspace ID"})
+	}
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	userIDStr, _ := c.Locals("user_id").(string)
+	userID, _ := uuid.Parse(userIDStr)
+
+	d, err := h.uc.Cancel(c.Context(), workspaceID, id, userID)
+	if err != nil {
+		return c.Status(errorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if d.Status == "building" {
+		return c.Status(fiber.StatusAccepted).JSON(d)
+	}
+	return c.JSON(d)
+}
+
+func (h *DeploymentHandler) Promote(c *fiber.Ctx) error {
+	var req struct {
+		EnvironmentID string `json:"environment_id"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	workspaceIDStr, ok := c.Locals("workspace_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	workspaceID, err := uuid.Parse(workspaceIDStr)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid workspace ID"})
+	}
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	environmentID, err := uuid.Parse(req.EnvironmentID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid environment ID"})
+	}
+
+	userIDStr, _ := c.Locals("user_id").(string)
+	userID, _ := uuid.Parse(userIDStr)
+
+	d, err := h.uc.Promote(c.Context(), workspaceID, id, environmentID, userID)
+	if err != nil {
+		return c.Status(errorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(d)
+}
+
+func (h *DeploymentHandler) Artifact(c *fiber.Ctx) error {
+	workspaceIDStr, ok := c.Locals("workspace_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	workspaceID, err := uuid.Parse(workspaceIDStr)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid workspace ID"})
+	}
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	a, err := h.uc.Artifact(c.Context(), workspaceID, id, c.Query("format", "tar.gz"))
+	if err != nil {
+		return c.Status(errorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	c.Set(fiber.HeaderContentType, a.ContentType)
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, a.Filename))
+	if a.SHA256 != "" {
+		c.Set("X-Checksum-SHA256", a.SHA256)
+	}
+
+	// Headers are sent before the archive, so a failure midway can only cut
+	// the download short
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		if err := a.Write(w); err != nil {
+			log.Printf("Failed to stream artifact of deployment %s: %v", id, err)
+			return
+		}
+		_ = w.Flush()
+	})
+	return nil
+}
+
+// Changelog lists the pages added, removed and modified since the deployment
+// given by from, and the commits in between
+func (h *DeploymentHandler) Changelog(c *fiber.Ctx) error {
+	workspaceIDStr, ok := c.Locals("workspace_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	workspaceID, err := uuid.Parse(workspaceIDStr)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid workspace ID"})
+	}
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	fromID, err := uuid.Parse(c.Query("from"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid from deployment ID"})
+	}
+
+	changes, err := h.uc.Changelog(c.Context(), workspaceID, id, fromID)
+	if err != nil {
+		return c.Status(errorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(changes)
+}
+
+// logHeartbeat keeps idle log streams open through proxies and detects gone clients
+const logHeartbeat = 15 * time.Second
+
+// StreamLogs serves a deployment's build log as Server-Sent Events: the stored
+// log first, then live lines until the build reaches a final status.
+func (h *DeploymentHandler) StreamLogs(c *fiber.Ctx) error {
+	workspaceIDStr, ok := c.Locals("workspace_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	workspaceID, err := uuid.Parse(workspaceIDStr)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid workspace ID"})
+	}
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	// The stream outlives the handler, so it cannot use the request context
+	ctx, cancel := context.WithCancel(context.Background())
+	d, events, err := h.uc.StreamLogs(ctx, workspaceID, id)
+	if err != nil {
+		cancel()
+		return c.Status(errorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer cancel()
+
+		sent := 0
+		for _, line := range strings.Split(strings.TrimSuffix(d.Logs, "\n"), "\n") {
+			if line == "" {
+				continue
+			}
+			writeLogEvent(w, sent, line)
+			sent++
+		}
+		if d.IsFinished() {
+			fmt.Fprintf(w, "event: status\ndata: %s\n\n", d.Status)
+			_ = w.Flush()
+			return
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		heartbeat := time.NewTicker(logHeartbeat)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				if event.Status != "" {
+					fmt.Fprintf(w, "event: status\ndata: %s\n\n", event.Status)
+					_ = w.Flush()
+					return
+				}
+				if event.Seq < sent {
+					continue
+				}
+				writeLogEvent(w, event.Seq, event.Line)
+				sent = event.Seq + 1
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": ping\n\n")
+			}
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+	return nil
+}
+
+func writeLogEvent(w *bufio.Writer, seq int, line string) {
+	fmt.Fprintf(w, "id: %d\nevent: log\ndata: %s\n\n", seq, line)
+}
@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"openbook/internal/domain"
+	"openbook/internal/repository"
+	"openbook/internal/usecase"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeDeployments struct {
+	repository.DeploymentRepository
+	deployments map[uuid.UUID]*domain.Deployment
+}
+
+func (f *fakeDeployments) GetByID(ctx context.Context, id uuid.UUID) (*domain.Deployment, error) {
+	if d, ok := f.deployments[id]; ok {
+		return d, nil
+	}
+	return nil, domain.ErrNotFound
+}
+
+type fakeEnvironments struct {
+	repository.EnvironmentRepository
+	envs map[uuid.UUID]*domain.Environment
+}
+
+func (f *fakeEnvironments) GetByID(ctx context.Context, id uuid.UUID) (*domain.Environment, error) {
+	if env, ok := f.envs[id]; ok {
+		return env, nil
+	}
+	return nil, domain.ErrNotFound
+}
+
+type fakeCommits struct {
+	repository.GitRepository
+	commits map[uuid.UUID]*domain.Commit
+}
+
+func (f *fakeCommits) GetCommit(ctx context.Context, id uuid.UUID) (*domain.Commit, error) {
+	if c, ok := f.commits[id]; ok {
+		return c, nil
+	}
+	return nil, domain.ErrNotFound
+}
+
+func TestDeploymentHandler_Create_ForeignTargets(t *testing.T) {
+	workspaceID, siteID := uuid.New(), uuid.New()
+	otherWorkspaceID, otherSiteID := uuid.New(), uuid.New()
+
+	env := &domain.Environment{ID: uuid.New(), WorkspaceID: workspaceID, SiteID: siteID}
+	siblingEnv := &domain.Environment{ID: uuid.New(), WorkspaceID: workspaceID, SiteID: otherSiteID}
+	foreignEnv := &domain.Environment{ID: uuid.New(), WorkspaceID: otherWorkspaceID, SiteID: uuid.New()}
+	commit := &domain.Commit{ID: uuid.New(), WorkspaceID: workspaceID, SiteID: &siteID}
+	siblingCommit := &domain.Commit{ID: uuid.New(), WorkspaceID: workspaceID, SiteID: &otherSiteID}
+	foreignCommit := &domain.Commit{ID: uuid.New(), WorkspaceID: otherWorkspaceID, SiteID: &foreignEnv.SiteID}
+
+	envs := &fakeEnvironments{envs: map[uuid.UUID]*domain.Environment{}}
+	for _, e := range []*domain.Environment{env, siblingEnv, foreignEnv} {
+		envs.envs[e.ID] = e
+	}
+	commits := &fakeCommits{commits: map[uuid.UUID]*domain.Commit{}}
+	for _, c := range []*domain.Commit{commit, siblingCommit, foreignCommit} {
+		commits.commits[c.ID] = c
+	}
+
+	// Rejected deployments never reach the deployment repository or the queue
+	h := NewDeploymentHandler(usecase.NewDeploymentUseCase(nil, envs, commits, nil, nil, nil))
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("workspace_id", workspaceID.String())
+		return c.Next()
+	})
+	app.Post("/deployments", h.Create)
+
+	tests := []struct {
+		name   string
+		env    uuid.UUID
+		commit string
+		want   int
+	}{
+		{"foreign environment", foreignEnv.ID, commit.ID.String(), fiber.StatusNotFound},
+		{"environment of another site", siblingEnv.ID, commit.ID.String(), fiber.StatusBadRequest},
+		{"unknown environment", uuid.New(), commit.ID.String(), fiber.StatusNotFound},
+		{"foreign commit", env.ID, foreignCommit.ID.String(), fiber.StatusNotFound},
+		{"commit of another site", env.ID, siblingCommit.ID.String(), fiber.StatusBadRequest},
+		{"invalid commit", env.ID, "main", fiber.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := json.Marshal(fiber.Map{
+				"site_id":        siteID,
+				"environment_id": tt.env,
+				"commit_hash":    tt.commit,
+			})
+			require.NoError(t, err)
+
+			req := httptest.NewRequest("POST", "/deployments", strings.NewReader(string(body)))
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+
+			assert.Equal(t, tt.want, resp.StatusCode)
+		})
+	}
+}
+
+func TestDeploymentHandler_Artifact_ForeignCommit(t *testing.T) {
+	workspaceID, siteID := uuid.New(), uuid.New()
+	otherWorkspaceID := uuid.New()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "index.html"), []byte("<h1>Home</h1>"), 0644))
+
+	commit := &domain.Commit{ID: uuid.New(), WorkspaceID: workspaceID, SiteID: &siteID}
+	foreignCommit := &domain.Commit{ID: uuid.New(), WorkspaceID: otherWorkspaceID}
+	deployment := func(c *domain.Commit) *domain.Deployment {
+		return &domain.Deployment{
+			ID:          uuid.New(),
+			WorkspaceID: workspaceID,
+			SiteID:      siteID,
+			Status:      "success",
+			CommitHash:  c.ID.String(),
+			StoragePath: dir,
+		}
+	}
+	own, leaked := deployment(commit), deployment(foreignCommit)
+
+	deployments := &fakeDeployments{deployments: map[uuid.UUID]*domain.Deployment{own.ID: own, leaked.ID: leaked}}
+	commits := &fakeCommits{commits: map[uuid.UUID]*domain.Commit{commit.ID: commit, foreignCommit.ID: foreignCommit}}
+	h := NewDeploymentHandler(usecase.NewDeploymentUseCase(deployments, nil, commits, nil, nil, nil))
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("workspace_id", workspaceID.String())
+		return c.Next()
+	})
+	app.Get("/deployments/:id/artifact", h.Artifact)
+
+	for _, tt := range []struct {
+		d    *domain.Deployment
+		want int
+	}{
+		{own, fiber.StatusOK},
+		{leaked, fiber.StatusNotFound},
+	} {
+		resp, err := app.Test(httptest.NewRequest("GET", "/deployments/"+tt.d.ID.String()+"/artifact?format=zip", nil))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, tt.want, resp.StatusCode, tt.d.CommitHash)
+	}
+}
@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"openbook/internal/domain"
+	"openbook/internal/usecase"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type DomainHandler struct {
+	uc *usecase.DomainUseCase
+}
+
+func NewDomainHandler(uc *usecase.DomainUseCase) *DomainHandler {
+	return &DomainHandler{uc: uc}
+}
+
+// Create registers a custom domain; it is served once verified
+func (h *DomainHandler) Create(c *fiber.Ctx) error {
+	var req struct {
+		SiteID string `json:"site_id"`
+		Domain string `json:"domain"`
+		Type   string `json:"type"`
+	}
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	workspaceIDStr, ok := c.Locals("workspace_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	workspaceID, err := uuid.Parse(workspaceIDStr)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid workspace ID"})
+	}
+
+	siteID, err := uuid.Parse(req.SiteID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid site ID"})
+	}
+
+	userIDStr, _ := c.Locals("user_id").(string)
+	userID, _ := uuid.Parse(userIDStr)
+
+	d := &domain.Domain{
+		WorkspaceID: workspaceID,
+		SiteID:      siteID,
+		Domain:      req.Domain,
+		Type:        req.Type,
+	}
+
+	if err := h.uc.Create(c.Context(), d, userID); err != nil {
+		return c.Status(errorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(d)
+}
+
+// List returns the domains of the site given by the site_id query parameter
+func (h *DomainHandler) List(c *fiber.Ctx) error {
+	workspaceIDStr, ok := c.Locals("workspace_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	workspaceID, err := uuid.Parse(workspaceIDStr)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid workspace ID"})
+	}
+
+	siteID, err := uuid.Parse(c.Query("site_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid site ID"})
+	}
+
+	domains, err := h.uc.List(c.Context(), workspaceID, siteID)
+	if err != nil {
+		return c.Status(errorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(domains)
+}
+
+func (h *DomainHandler) Get(c *fiber.Ctx) error {
+	workspaceIDStr, ok := c.Locals("workspace_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	workspaceID, err := uuid.Parse(workspaceIDStr)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid workspace ID"})
+	}
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	d, err := h.uc.Get(c.Context(), workspaceID, id)
+	if err != nil {
+		return c.Status(errorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(d)
+}
+
+// Verify checks the DNS records of a domain without waiting for the next
+// periodic check
+func (h *DomainHandler) Verify(c *fiber.Ctx) error {
+	workspaceIDStr, ok := c.Locals("workspace_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	workspaceID, err := uuid.Parse(workspaceIDStr)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid workspace ID"})
+	}
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	d, err := h.uc.Verify(c.Context(), workspaceID, id)
+	if err != nil {
+		return c.Status(errorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(d)
+}
+
+func (h *DomainHandler) Delete(c *fiber.Ctx) error {
+	workspaceIDStr, ok := c.Locals("workspace_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	workspaceID, err := uuid.Parse(workspaceIDStr)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid workspace ID"})
+	}
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	userIDStr, _ := c.Locals("user_id").(string)
+	userID, _ := uuid.Parse(userIDStr)
+
+	if err := h.uc.Delete(c.Context(), workspaceID, id, userID); err != nil {
+		return c.Status(errorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
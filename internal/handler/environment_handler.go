@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"openbook/internal/usecase"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type EnvironmentHandler struct {
+	uc *usecase.EnvironmentUseCase
+}
+
+func NewEnvironmentHandler(uc *usecase.EnvironmentUseCase) *EnvironmentHandler {
+	return &EnvironmentHandler{uc: uc}
+}
+
+func (h *EnvironmentHandler) Rollback(c *fiber.Ctx) error {
+	var req struct {
+		DeploymentID string `json:"deployment_id"`
+	}
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	workspaceIDStr, ok := c.Locals("workspace_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	workspaceID, err := uuid.Parse(workspaceIDStr)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid workspace ID"})
+	}
+
+	envID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	deploymentID, err := uuid.Parse(req.DeploymentID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid deployment ID"})
+	}
+
+	userIDStr, _ := c.Locals("user_id").(string)
+	userID, _ := uuid.Parse(userIDStr)
+
+	env, err := h.uc.Rollback(c.Context(), workspaceID, envID, deploymentID, userID)
+	if err != nil {
+		return c.Status(errorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(env)
+}
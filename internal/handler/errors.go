@@ -0,0 +1,23 @@
+package handler
+
+import (
+	"errors"
+
+	"openbook/internal/domain"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// errorStatus maps domain errors returned by use cases to HTTP status codes
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, domain.ErrNotFound):
+		return fiber.StatusNotFound
+	case errors.Is(err, domain.ErrInvalidInput):
+		return fiber.StatusBadRequest
+	case errors.Is(err, domain.ErrConflict):
+		return fiber.StatusConflict
+	default:
+		return fiber.StatusInternalServerError
+	}
+}
@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"openbook/internal/domain"
+	"openbook/internal/usecase"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type SiteHandler struct {
+	uc *usecase.SiteUseCase
+}
+
+func NewSiteHandler(uc *usecase.SiteUseCase) *SiteHandler {
+	return &SiteHandler{uc: uc}
+}
+
+// Create creates a site with its main branch and production environment
+func (h *SiteHandler) Create(c *fiber.Ctx) error {
+	var req struct {
+		Name        string `json:"name"`
+		Slug        string `json:"slug"`
+		IsPublic    bool   `json:"is_public"`
+		BrokenLinks string `json:"broken_links"`
+		WhatsNew    bool   `json:"whats_new"`
+	}
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	workspaceIDStr, ok := c.Locals("workspace_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	workspaceID, err := uuid.Parse(workspaceIDStr)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid workspace ID"})
+	}
+
+	userIDStr, _ := c.Locals("user_id").(string)
+	userID, _ := uuid.Parse(userIDStr)
+
+	site := &domain.Site{
+		WorkspaceID: workspaceID,
+		Name:        req.Name,
+		Slug:        req.Slug,
+		IsPublic:    req.IsPublic,
+		BrokenLinks: req.BrokenLinks,
+		WhatsNew:    req.WhatsNew,
+	}
+
+	created, err := h.uc.Create(c.Context(), site, userID)
+	if err != nil {
+		return c.Status(errorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(created)
+}
+
+func (h *SiteHandler) List(c *fiber.Ctx) error {
+	workspaceIDStr, ok := c.Locals("workspace_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	workspaceID, err := uuid.Parse(workspaceIDStr)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid workspace ID"})
+	}
+
+	sites, err := h.uc.List(c.Context(), workspaceID)
+	if err != nil {
+		return c.Status(errorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(sites)
+}
+
+func (h *SiteHandler) Get(c *fiber.Ctx) error {
+	workspaceIDStr, ok := c.Locals("workspace_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	workspaceID, err := uuid.Parse(workspaceIDStr)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid workspace ID"})
+	}
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	site, err := h.uc.Get(c.Context(), workspaceID, id)
+	if err != nil {
+		return c.Status(errorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(site)
+}
+
+// Update changes the fields present in the request body
+func (h *SiteHandler) Update(c *fiber.Ctx) error {
+	var req struct {
+		Name               *string `json:"name"`
+		Slug               *string `json:"slug"`
+		DefaultEnvironment *string `json:"default_environment"`
+		IsPublic           *bool   `json:"is_public"`
+		BrokenLinks        *string `json:"broken_links"`
+		WhatsNew           *bool   `json:"whats_new"`
+	}
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	workspaceIDStr, ok := c.Locals("workspace_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	workspaceID, err := uuid.Parse(workspaceIDStr)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid workspace ID"})
+	}
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	userIDStr, _ := c.Locals("user_id").(string)
+	userID, _ := uuid.Parse(userIDStr)
+
+	site, err := h.uc.Update(c.Context(), workspaceID, id, usecase.SiteUpdate{
+		Name:               req.Name,
+		Slug:               req.Slug,
+		DefaultEnvironment: req.DefaultEnvironment,
+		IsPublic:           req.IsPublic,
+		BrokenLinks:        req.BrokenLinks,
+		WhatsNew:           req.WhatsNew,
+	}, userID)
+	if err != nil {
+		return c.Status(errorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(site)
+}
+
+// Delete soft-deletes a site
+func (h *SiteHandler) Delete(c *fiber.Ctx) error {
+	workspaceIDStr, ok := c.Locals("workspace_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	workspaceID, err := uuid.Parse(workspaceIDStr)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid workspace ID"})
+	}
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	userIDStr, _ := c.Locals("user_id").(string)
+	userID, _ := uuid.Parse(userIDStr)
+
+	if err := h.uc.Delete(c.Context(), workspaceID, id, userID); err != nil {
+		return c.Status(errorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"crypto/subtle"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// AdminMiddleware guards operator endpoints with a shared token sent in the
+// X-Admin-Token header. With no token configured, admin endpoints are disabled.
+func AdminMiddleware(token string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if token == "" {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Admin API is disabled"})
+		}
+		provided := c.Get("X-Admin-Token")
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Invalid admin token"})
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,80 @@
+package render
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+// ImageResolver maps an image source found in a page to the published image,
+// or nil when the image is emitted unchanged
+type ImageResolver func(src string) *Image
+
+// Image is a published image with its responsive variants
+type Image struct {
+	Src      string // URL of the full-size image
+	Type     string // MIME type of Src
+	Width    int
+	Height   int
+	Variants []ImageVariant // smaller or re-encoded versions, full size included
+}
+
+// ImageVariant is one rendition of an image
+type ImageVariant struct {
+	URL   string
+	Type  string
+	Width int
+}
+
+// imageHTML renders an image block. Variants of the image's own type become
+// its srcset; variants of other types, such as WebP, are offered as
+// <picture> sources the browser picks when it supports them. alt is
+// already escaped.
+func imageHTML(img *Image, alt string) string {
+	var own []ImageVariant
+	var types []string
+	others := make(map[string][]ImageVariant)
+	for _, v := range img.Variants {
+		if v.Type == img.Type {
+			own = append(own, v)
+			continue
+		}
+		if others[v.Type] == nil {
+			types = append(types, v.Type)
+		}
+		others[v.Type] = append(others[v.Type], v)
+	}
+
+	sizes := ""
+	if img.Width > 0 {
+		sizes = fmt.Sprintf(` sizes="(max-width: %dpx) 100vw, %dpx"`, img.Width, img.Width)
+	}
+	var b strings.Builder
+	tag := fmt.Sprintf(`<img src="%s"`, html.EscapeString(img.Src))
+	if len(own) > 0 {
+		tag += fmt.Sprintf(` srcset="%s"%s`, srcSet(own), sizes)
+	}
+	if img.Width > 0 && img.Height > 0 {
+		tag += fmt.Sprintf(` width="%d" height="%d"`, img.Width, img.Height)
+	}
+	tag += fmt.Sprintf(` alt="%s" loading="lazy" decoding="async">`, alt)
+
+	if len(types) == 0 {
+		return tag
+	}
+	b.WriteString("<picture>")
+	for _, t := range types {
+		fmt.Fprintf(&b, `<source type="%s" srcset="%s"%s>`, html.EscapeString(t), srcSet(others[t]), sizes)
+	}
+	b.WriteString(tag)
+	b.WriteString("</picture>")
+	return b.String()
+}
+
+func srcSet(variants []ImageVariant) string {
+	candidates := make([]string, 0, len(variants))
+	for _, v := range variants {
+		candidates = append(candidates, fmt.Sprintf("%s %dw", html.EscapeString(v.URL), v.Width))
+	}
+	return strings.Join(candidates, ", ")
+}
@@ -0,0 +1,260 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// Document is the result of rendering a single page source
+type Document struct {
+	Title   string
+	HTML    string
+	Text    string
+	Links   []Link
+	Anchors []string // fragment identifiers the page defines
+}
+
+// Link is a link found in a page source
+type Link struct {
+	Href  string
+	Block string // heading of the section the link is in, empty above the first heading
+	Image bool   // the source of an image rather than a link
+}
+
+// LinkRewriter maps a link target found in a source to the href emitted in HTML
+type LinkRewriter func(href string) string
+
+var (
+	headingPattern  = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	orderedPattern  = regexp.MustCompile(`^\d+[.)]\s+`)
+	imagePattern    = regexp.MustCompile(`!\[([^\]]*)\]\(([^)\s]+)\)`)
+	linkPattern     = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	codeSpanPattern = regexp.MustCompile("`([^`]+)`")
+	strongPattern   = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	emPattern       = regexp.MustCompile(`\*([^*]+)\*|\b_([^_]+)_\b`)
+	slugStrip       = regexp.MustCompile(`[^a-z0-9\s-]`)
+	slugSpaces      = regexp.MustCompile(`[\s-]+`)
+	titleTagPattern = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	h1TagPattern    = regexp.MustCompile(`(?is)<h1[^>]*>(.*?)</h1>`)
+	hrefPattern     = regexp.MustCompile(`(?i)<a\s[^>]*href="([^"]*)"`)
+	headingTag      = regexp.MustCompile(`(?is)<h[1-6][^>]*>(.*?)</h[1-6]>`)
+	idAttrPattern   = regexp.MustCompile(`(?i)<[a-z][^>]*\sid="([^"]*)"`)
+	nameAttrPattern = regexp.MustCompile(`(?i)<a\s[^>]*name="([^"]*)"`)
+	tagPattern      = regexp.MustCompile(`(?s)<[^>]*>`)
+	scriptPattern   = regexp.MustCompile(`(?is)<(script|style)[^>]*>.*?</(script|style)>`)
+)
+
+// Markdown renders a Markdown source into HTML.
+// It supports the subset used by the editor: ATX headings, paragraphs,
+// fenced code blocks, lists, blockquotes, rules, links, images and emphasis.
+// rewrite and images may be nil, in which case links and images are
+// emitted unchanged.
+func Markdown(src []byte, rewrite LinkRewriter, images ImageResolver) *Document {
+	r := &markdownRenderer{slugs: map[string]int{}, rewrite: rewrite, images: images}
+	r.render(strings.Split(strings.ReplaceAll(string(src), "\r\n", "\n"), "\n"))
+	return &Document{
+		Title:   r.title,
+		HTML:    r.out.String(),
+		Text:    string(src),
+		Links:   r.links,
+		Anchors: r.anchors,
+	}
+}
+
+// HTMLSource extracts metadata from a page that is already HTML
+func HTMLSource(src []byte) *Document {
+	doc := &Document{HTML: string(src)}
+	if m := titleTagPattern.FindSubmatch(src); m != nil {
+		doc.Title = strings.TrimSpace(html.UnescapeString(tagPattern.ReplaceAllString(string(m[1]), "")))
+	} else if m := h1TagPattern.FindSubmatch(src); m != nil {
+		doc.Title = strings.TrimSpace(html.UnescapeString(tagPattern.ReplaceAllString(string(m[1]), "")))
+	}
+	text := scriptPattern.ReplaceAllString(string(src), "")
+	text = tagPattern.ReplaceAllString(text, " ")
+	doc.Text = strings.Join(strings.Fields(html.UnescapeString(text)), " ")
+
+	headings := headingTag.FindAllSubmatchIndex(src, -1)
+	for _, m := range hrefPattern.FindAllSubmatchIndex(src, -1) {
+		block := ""
+		for _, h := range headings {
+			if h[0] > m[0] {
+				break
+			}
+			block = plainHTML(src[h[2]:h[3]])
+		}
+		doc.Links = append(doc.Links, Link{Href: html.UnescapeString(string(src[m[2]:m[3]])), Block: block})
+	}
+	for _, pattern := range []*regexp.Regexp{idAttrPattern, nameAttrPattern} {
+		for _, m := range pattern.FindAllSubmatch(src, -1) {
+			doc.Anchors = append(doc.Anchors, html.UnescapeString(string(m[1])))
+		}
+	}
+	return doc
+}
+
+// plainHTML returns the text of an HTML fragment
+func plainHTML(b []byte) string {
+	return strings.Join(strings.Fields(html.UnescapeString(tagPattern.ReplaceAllString(string(b), " "))), " ")
+}
+
+// Slugify turns a heading text into an anchor identifier
+func Slugify(s string) string {
+	s = slugStrip.ReplaceAllString(strings.ToLower(strings.TrimSpace(s)), "")
+	s = slugSpaces.ReplaceAllString(s, "-")
+	return strings.Trim(s, "-")
+}
+
+type markdownRenderer struct {
+	out     bytes.Buffer
+	title   string
+	slugs   map[string]int
+	links   []Link
+	anchors []string
+	section string // heading of the block being rendered
+	rewrite LinkRewriter
+	images  ImageResolver
+}
+
+func (r *markdownRenderer) render(lines []string) {
+	var paragraph []string
+	flush := func() {
+		if len(paragraph) > 0 {
+			r.out.WriteString("<p>" + r.inline(strings.Join(paragraph, " ")) + "</p>\n")
+			paragraph = nil
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "":
+			flush()
+
+		case strings.HasPrefix(trimmed, "```"):
+			flush()
+			lang := strings.TrimSpace(strings.TrimPrefix(trimmed, "```"))
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, lines[i])
+			}
+			class := ""
+			if lang != "" {
+				class = fmt.Sprintf(` class="language-%s"`, html.EscapeString(lang))
+			}
+			r.out.WriteString(fmt.Sprintf("<pre><code%s>%s</code></pre>\n", class, html.EscapeString(strings.Join(code, "\n"))))
+
+		case headingPattern.MatchString(trimmed):
+			flush()
+			m := headingPattern.FindStringSubmatch(trimmed)
+			level := len(m[1])
+			if level == 1 && r.title == "" {
+				r.title = plainText(m[2])
+			}
+			r.section = plainText(m[2])
+			id := r.anchor(r.section)
+			r.out.WriteString(fmt.Sprintf("<h%d id=\"%s\">%s</h%d>\n", level, id, r.inline(m[2]), level))
+
+		case trimmed == "---" || trimmed == "***" || trimmed == "___":
+			flush()
+			r.out.WriteString("<hr>\n")
+
+		case strings.HasPrefix(trimmed, ">"):
+			flush()
+			var quote []string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">"); i++ {
+				quote = append(quote, strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(lines[i]), ">"), " "))
+			}
+			i--
+			r.out.WriteString("<blockquote>\n")
+			r.render(quote)
+			r.out.WriteString("</blockquote>\n")
+
+		case isBullet(trimmed) || orderedPattern.MatchString(trimmed):
+			flush()
+			ordered := !isBullet(trimmed)
+			tag := "ul"
+			if ordered {
+				tag = "ol"
+			}
+			r.out.WriteString("<" + tag + ">\n")
+			for ; i < len(lines); i++ {
+				item := strings.TrimSpace(lines[i])
+				if ordered && orderedPattern.MatchString(item) {
+					item = orderedPattern.ReplaceAllString(item, "")
+				} else if !ordered && isBullet(item) {
+					item = item[2:]
+				} else {
+					break
+				}
+				r.out.WriteString("<li>" + r.inline(item) + "</li>\n")
+			}
+			i--
+			r.out.WriteString("</" + tag + ">\n")
+
+		default:
+			paragraph = append(paragraph, trimmed)
+		}
+	}
+	flush()
+}
+
+func (r *markdownRenderer) anchor(text string) string {
+	slug := Slugify(text)
+	if slug == "" {
+		slug = "section"
+	}
+	n := r.slugs[slug]
+	r.slugs[slug] = n + 1
+	if n > 0 {
+		slug = fmt.Sprintf("%s-%d", slug, n)
+	}
+	r.anchors = append(r.anchors, slug)
+	return slug
+}
+
+func (r *markdownRenderer) inline(s string) string {
+	s = html.EscapeString(s)
+	s = codeSpanPattern.ReplaceAllString(s, "<code>$1</code>")
+	s = imagePattern.ReplaceAllStringFunc(s, func(m string) string {
+		parts := imagePattern.FindStringSubmatch(m)
+		src := html.UnescapeString(parts[2])
+		r.links = append(r.links, Link{Href: src, Block: r.section, Image: true})
+		if r.images != nil {
+			if img := r.images(src); img != nil {
+				return imageHTML(img, parts[1])
+			}
+		}
+		return fmt.Sprintf(`<img src="%s" alt="%s">`, parts[2], parts[1])
+	})
+	s = linkPattern.ReplaceAllStringFunc(s, func(m string) string {
+		parts := linkPattern.FindStringSubmatch(m)
+		href := html.UnescapeString(parts[2])
+		r.links = append(r.links, Link{Href: href, Block: r.section})
+		if r.rewrite != nil {
+			href = r.rewrite(href)
+		}
+		return fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(href), parts[1])
+	})
+	s = strongPattern.ReplaceAllString(s, "<strong>$1</strong>")
+	s = emPattern.ReplaceAllStringFunc(s, func(m string) string {
+		return "<em>" + m[1:len(m)-1] + "</em>"
+	})
+	return s
+}
+
+func isBullet(s string) bool {
+	return len(s) > 1 && (s[0] == '-' || s[0] == '*' || s[0] == '+') && s[1] == ' '
+}
+
+// plainText strips inline Markdown syntax from a heading
+func plainText(s string) string {
+	s = imagePattern.ReplaceAllString(s, "$1")
+	s = linkPattern.ReplaceAllString(s, "$1")
+	s = codeSpanPattern.ReplaceAllString(s, "$1")
+	return strings.NewReplacer("**", "", "*", "", "_", "").Replace(s)
+}
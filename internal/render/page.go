@@ -0,0 +1,63 @@
+package render
+
+import (
+	"bytes"
+	"html/template"
+)
+
+// NavItem is a link rendered in the site navigation or backlink list
+type NavItem struct {
+	Title  string
+	URL    string
+	Active bool
+}
+
+// PageData is the input of the site page layout
+type PageData struct {
+	SiteName     string
+	Title        string
+	CanonicalURL string
+	Body         string
+	Navigation   []NavItem
+	Backlinks    []NavItem
+}
+
+var pageTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{if .Title}}{{.Title}} - {{end}}{{.SiteName}}</title>
+{{if .CanonicalURL}}<link rel="canonical" href="{{.CanonicalURL}}">
+{{end}}</head>
+<body>
+{{if .Navigation}}<nav>
+<ul>
+{{range .Navigation}}<li><a href="{{.URL}}"{{if .Active}} aria-current="page"{{end}}>{{.Title}}</a></li>
+{{end}}</ul>
+</nav>
+{{end}}<main>
+{{.Body}}
+{{if .Backlinks}}<aside class="backlinks">
+<h2>Pages linking here</h2>
+<ul>
+{{range .Backlinks}}<li><a href="{{.URL}}">{{.Title}}</a></li>
+{{end}}</ul>
+</aside>
+{{end}}</main>
+</body>
+</html>
+`))
+
+// Page wraps a rendered document body in the site layout
+func Page(data PageData) ([]byte, error) {
+	var buf bytes.Buffer
+	err := pageTemplate.Execute(&buf, struct {
+		PageData
+		Body template.HTML
+	}{data, template.HTML(data.Body)})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
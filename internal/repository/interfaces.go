@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"openbook/internal/domain"
 
@@ -26,8 +27,24 @@ type CollectionRepository interface {
 
 type DeploymentRepository interface {
 	Create(ctx context.Context, deployment *domain.Deployment) error
+	// UpdateStatus moves a deployment along its lifecycle; invalid transitions fail with domain.ErrConflict
 	UpdateStatus(ctx context.Context, id uuid.UUID, status string) error
+	// MarkSuccess finishes a build and records where its output lives and is served
+	MarkSuccess(ctx context.Context, id uuid.UUID, storagePath, url string) error
+	// MarkFailed finishes a build and records why it failed
+	MarkFailed(ctx context.Context, id uuid.UUID, message string) error
 	GetByID(ctx context.Context, id uuid.UUID) (*domain.Deployment, error)
+	GetLastSuccessful(ctx context.Context, siteID, environmentID uuid.UUID) (*domain.Deployment, error)
+	AppendLogs(ctx context.Context, id uuid.UUID, text string) error
+	// GetNewer returns the newest deployment of the same environment created
+	// after d that is pending, building or successful. Scheduled deployments
+	// count from their scheduled time, so a release scheduled in advance is
+	// not superseded by deployments made while it waited.
+	GetNewer(ctx context.Context, d *domain.Deployment) (*domain.Deployment, error)
+	ListByStatus(ctx context.Context, status string) ([]*domain.Deployment, error)
+	// List returns the deployments of filter.WorkspaceID matching the filter,
+	// without their logs
+	List(ctx context.Context, filter domain.DeploymentFilter) ([]*domain.Deployment, error)
 }
 
 type SpaceRepository interface {
@@ -37,8 +54,18 @@ type SpaceRepository interface {
 
 // New Ultimate Interfaces
 
+// SiteRepository stores sites. Deleted sites are kept with their deleted_at
+// set and are never returned.
 type SiteRepository interface {
+	// Create fails with domain.ErrConflict when the slug is taken in the workspace
 	Create(ctx context.Context, site *domain.Site) error
+	// CreateInitialized creates a site together with its initial commit,
+	// branch and environment in one transaction. It fails like Create.
+	CreateInitialized(ctx context.Context, site *domain.Site, commit *domain.Commit, branch *domain.Branch, env *domain.Environment) error
+	// Update saves the name, slug and settings of a site
+	Update(ctx context.Context, site *domain.Site) error
+	// Delete soft-deletes a site and removes its domains, releasing their names
+	Delete(ctx context.Context, id uuid.UUID) error
 	GetByID(ctx context.Context, id uuid.UUID) (*domain.Site, error)
 	GetBySlug(ctx context.Context, workspaceID uuid.UUID, slug string) (*domain.Site, error)
 	List(ctx context.Context, workspaceID uuid.UUID) ([]domain.Site, error)
@@ -46,8 +73,67 @@ type SiteRepository interface {
 
 type DomainRepository interface {
 	Create(ctx context.Context, domain *domain.Domain) error
+	// Update saves the verification state of a domain; activating a domain
+	// already active elsewhere fails with domain.ErrConflict
+	Update(ctx context.Context, domain *domain.Domain) error
+	// UpdateCertificate saves the certificate state of a domain
+	UpdateCertificate(ctx context.Context, domain *domain.Domain) error
+	// ClaimCertificate marks an active domain as provisioning unless another
+	// request started after staleBefore, and reports whether it did
+	ClaimCertificate(ctx context.Context, id uuid.UUID, staleBefore time.Time) (bool, error)
+	Delete(ctx context.Context, id uuid.UUID) error
 	GetByID(ctx context.Context, id uuid.UUID) (*domain.Domain, error)
 	ListBySite(ctx context.Context, siteID uuid.UUID) ([]domain.Domain, error)
+	// GetByDomain returns the claim of a name, the active one if any
+	GetByDomain(ctx context.Context, name string) (*domain.Domain, error)
+	// ListByHost returns the domains served at a host: the custom domain
+	// and the subdirectory domains below it
+	ListByHost(ctx context.Context, host string) ([]domain.Domain, error)
+	// ListForVerification returns the domains of live sites due for a DNS
+	// check: never checked, pending and checked before pendingBefore, or
+	// checked before recheckBefore otherwise
+	ListForVerification(ctx context.Context, pendingBefore, recheckBefore time.Time, limit int) ([]domain.Domain, error)
+	// ListForCertificates returns the active domains of live sites without a
+	// certificate, failed or stuck and last tried before retryBefore, or
+	// expiring before renewBefore
+	ListForCertificates(ctx context.Context, renewBefore, retryBefore time.Time, limit int) ([]domain.Domain, error)
+}
+
+// CertificateRepository stores TLS certificates, ACME account keys and the
+// pending HTTP-01 challenges of certificate requests
+type CertificateRepository interface {
+	// Save creates or replaces the certificate of a domain
+	Save(ctx context.Context, cert *domain.Certificate) error
+	// GetByHost returns the newest certificate of an active domain served at
+	// a host, including subdirectory domains
+	GetByHost(ctx context.Context, host string) (*domain.Certificate, error)
+	// GetAccountKey returns the encrypted account key for an ACME directory
+	GetAccountKey(ctx context.Context, directoryURL string) ([]byte, error)
+	// CreateAccountKey stores an account key unless one exists for the directory
+	CreateAccountKey(ctx context.Context, directoryURL string, key []byte) error
+	SaveChallenge(ctx context.Context, token, keyAuthorization string, expiresAt time.Time) error
+	// GetChallenge returns the key authorization of an unexpired challenge
+	GetChallenge(ctx context.Context, token string) (string, error)
+	DeleteChallenge(ctx context.Context, token string) error
+}
+
+type EnvironmentRepository interface {
+	Create(ctx context.Context, env *domain.Environment) error
+	// Update saves the branch, URL, active flag and last activity of an environment
+	Update(ctx context.Context, env *domain.Environment) error
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.Environment, error)
+	GetByName(ctx context.Context, siteID uuid.UUID, name string) (*domain.Environment, error)
+	// GetByHost returns the active environment of a live site whose URL has
+	// the given host name. A host used by several of them fails with
+	// domain.ErrConflict rather than serving either.
+	GetByHost(ctx context.Context, host string) (*domain.Environment, error)
+	SetLiveDeployment(ctx context.Context, id, deploymentID uuid.UUID) error
+	// ListExpiredPreviews returns the active previews whose branch is gone or
+	// that saw no activity since the given time
+	ListExpiredPreviews(ctx context.Context, inactiveSince time.Time) ([]*domain.Environment, error)
+	// ListByBranch returns the active environments of live sites tracking a
+	// branch
+	ListByBranch(ctx context.Context, branchID uuid.UUID) ([]*domain.Environment, error)
 }
 
 type GitRepository interface {
@@ -59,7 +145,9 @@ type GitRepository interface {
 	GetTree(ctx context.Context, commitID uuid.UUID) ([]domain.Tree, error)
 	CreateBranch(ctx context.Context, branch *domain.Branch) error
 	GetBranch(ctx context.Context, siteID uuid.UUID, name string) (*domain.Branch, error)
+	GetBranchByID(ctx context.Context, id uuid.UUID) (*domain.Branch, error)
 	UpdateBranch(ctx context.Context, branch *domain.Branch) error
+	DeleteBranch(ctx context.Context, id uuid.UUID) error
 }
 
 type AuditLogRepository interface {
@@ -0,0 +1,107 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"openbook/internal/domain"
+	"openbook/internal/repository"
+)
+
+type CertificateRepository struct {
+	db *sql.DB
+}
+
+func NewCertificateRepository(db *sql.DB) repository.CertificateRepository {
+	return &CertificateRepository{db: db}
+}
+
+func (r *CertificateRepository) Save(ctx context.Context, cert *domain.Certificate) error {
+	query := `
+		INSERT INTO certificates (domain_id, data, expires_at, updated_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (domain_id) DO UPDATE
+		SET data = EXCLUDED.data, expires_at = EXCLUDED.expires_at, updated_at = EXCLUDED.updated_at
+	`
+	if _, err := r.db.ExecContext(ctx, query, cert.DomainID, cert.Data, cert.ExpiresAt, cert.UpdatedAt); err != nil {
+		return fmt.Errorf("failed to save certificate: %w", err)
+	}
+	return nil
+}
+
+func (r *CertificateRepository) GetByHost(ctx context.Context, host string) (*domain.Certificate, error) {
+	query := `
+		SELECT c.domain_id, c.data, c.expires_at, c.updated_at
+		FROM certificates c
+		JOIN domains d ON d.id = c.domain_id
+		JOIN sites s ON s.id = d.site_id AND s.deleted_at IS NULL
+		WHERE lower(split_part(d.domain, '/', 1)) = lower($1) AND d.status = 'active'
+		ORDER BY c.expires_at DESC
+		LIMIT 1
+	`
+	cert := &domain.Certificate{}
+	err := r.db.QueryRowContext(ctx, query, host).Scan(&cert.DomainID, &cert.Data, &cert.ExpiresAt, &cert.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("certificate %w", domain.ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get certificate: %w", err)
+	}
+	return cert, nil
+}
+
+func (r *CertificateRepository) GetAccountKey(ctx context.Context, directoryURL string) ([]byte, error) {
+	var key []byte
+	err := r.db.QueryRowContext(ctx, `SELECT key_data FROM acme_accounts WHERE directory_url = $1`, directoryURL).Scan(&key)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("ACME account %w", domain.ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get ACME account: %w", err)
+	}
+	return key, nil
+}
+
+func (r *CertificateRepository) CreateAccountKey(ctx context.Context, directoryURL string, key []byte) error {
+	query := `INSERT INTO acme_accounts (directory_url, key_data) VALUES ($1, $2) ON CONFLICT (directory_url) DO NOTHING`
+	if _, err := r.db.ExecContext(ctx, query, directoryURL, key); err != nil {
+		return fmt.Errorf("failed to create ACME account: %w", err)
+	}
+	return nil
+}
+
+func (r *CertificateRepository) SaveChallenge(ctx context.Context, token, keyAuthorization string, expiresAt time.Time) error {
+	query := `
+		INSERT INTO acme_challenges (token, key_authorization, expires_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (token) DO UPDATE
+		SET key_authorization = EXCLUDED.key_authorization, expires_at = EXCLUDED.expires_at
+	`
+	if _, err := r.db.ExecContext(ctx, query, token, keyAuthorization, expiresAt); err != nil {
+		return fmt.Errorf("failed to save ACME challenge: %w", err)
+	}
+	return nil
+}
+
+func (r *CertificateRepository) GetChallenge(ctx context.Context, token string) (string, error) {
+	var keyAuthorization string
+	query := `SELECT key_authorization FROM acme_challenges WHERE token = $1 AND expires_at > NOW()`
+	err := r.db.QueryRowContext(ctx, query, token).Scan(&keyAuthorization)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", fmt.Errorf("ACME challenge %w", domain.ErrNotFound)
+		}
+		return "", fmt.Errorf("failed to get ACME challenge: %w", err)
+	}
+	return keyAuthorization, nil
+}
+
+// DeleteChallenge removes a challenge along with any expired one
+func (r *CertificateRepository) DeleteChallenge(ctx context.Context, token string) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM acme_challenges WHERE token = $1 OR expires_at < NOW()`, token); err != nil {
+		return fmt.Errorf("failed to delete ACME challenge: %w", err)
+	}
+	return nil
+}
@@ -4,12 +4,13 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"time"
+	"strings"
 
 	"openbook/internal/domain"
 	"openbook/internal/repository"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 type DeploymentRepository struct {
@@ -20,52 +21,250 @@ func NewDeploymentRepository(db *sql.DB) repository.DeploymentRepository {
 	return &DeploymentRepository{db: db}
 }
 
+// Create inserts a deployment. Scheduled deployments are only queued once
+// their publishing time is reached.
 func (r *DeploymentRepository) Create(ctx context.Context, d *domain.Deployment) error {
 	query := `
-		INSERT INTO deployments (id, workspace_id, site_id, environment_id, status, commit_hash, triggered_by, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		INSERT INTO deployments (id, workspace_id, site_id, environment_id, status, commit_hash, triggered_by, created_at, queued_at, source_deployment_id, scheduled_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, CASE WHEN $5 = 'scheduled' THEN NULL ELSE $8 END, $9, $10)
 	`
 	_, err := r.db.ExecContext(ctx, query,
-		d.ID, d.WorkspaceID, d.SiteID, d.EnvironmentID, d.Status, d.CommitHash, d.TriggeredBy, d.CreatedAt,
+		d.ID, d.WorkspaceID, d.SiteID, d.EnvironmentID, d.Status, d.CommitHash, d.TriggeredBy, d.CreatedAt, d.SourceDeploymentID, d.ScheduledAt,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to create deployment: %w", err)
 	}
+	if d.Status != "scheduled" {
+		d.QueuedAt = &d.CreatedAt
+	}
 	return nil
 }
 
 func (r *DeploymentRepository) UpdateStatus(ctx context.Context, id uuid.UUID, status string) error {
-	query := `UPDATE deployments SET status = $1, finished_at = $2 WHERE id = $3`
-	var finishedAt *time.Time
-	if status == "success" || status == "failed" {
-		now := time.Now()
-		finishedAt = &now
-	}
-	_, err := r.db.ExecContext(ctx, query, status, finishedAt, id)
+	return r.transition(ctx, id, status, nil, nil, nil)
+}
+
+func (r *DeploymentRepository) MarkSuccess(ctx context.Context, id uuid.UUID, storagePath, url string) error {
+	return r.transition(ctx, id, "success", &storagePath, &url, nil)
+}
+
+func (r *DeploymentRepository) MarkFailed(ctx context.Context, id uuid.UUID, message string) error {
+	return r.transition(ctx, id, "failed", nil, nil, &message)
+}
+
+// transition moves a deployment to a new status and stamps the matching
+// lifecycle timestamp. The update only applies when the current status may
+// move to the new one, so concurrent writers cannot skip a state.
+func (r *DeploymentRepository) transition(ctx context.Context, id uuid.UUID, status string, storagePath, url, errorMessage *string) error {
+	query := `
+		UPDATE deployments SET
+			status = $2,
+			queued_at = CASE WHEN $2 = 'pending' THEN NOW() ELSE queued_at END,
+			started_at = CASE WHEN $2 = 'building' THEN NOW() ELSE started_at END,
+			finished_at = CASE WHEN $2 IN ('success', 'failed', 'cancelled') THEN NOW() ELSE NULL END,
+			storage_path = COALESCE($3, storage_path),
+			url = COALESCE($4, url),
+			error_message = CASE WHEN $2 = 'success' THEN NULL ELSE COALESCE($5, error_message) END
+		WHERE id = $1 AND status = ANY($6)
+	`
+	res, err := r.db.ExecContext(ctx, query, id, status, storagePath, url, errorMessage, pq.Array(domain.DeploymentSourceStatuses(status)))
 	if err != nil {
 		return fmt.Errorf("failed to update deployment status: %w", err)
 	}
-	return nil
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+
+	current, err := r.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := domain.ValidateDeploymentTransition(current.Status, status); err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: deployment status changed concurrently", domain.ErrConflict)
 }
 
-func (r *DeploymentRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Deployment, error) {
-	query := `
-		SELECT id, workspace_id, site_id, environment_id, status, commit_hash, storage_path, url, logs, triggered_by, created_at, finished_at
-		FROM deployments WHERE id = $1
-	`
+// deploymentColumns is the column list read by scanDeployment
+const deploymentColumns = `id, workspace_id, site_id, environment_id, status, commit_hash, storage_path, url, logs, error_message,
+		triggered_by, created_at, queued_at, started_at, finished_at, source_deployment_id, scheduled_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanDeployment(row rowScanner) (*domain.Deployment, error) {
 	d := &domain.Deployment{}
-	var storagePath, url, logs sql.NullString
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&d.ID, &d.WorkspaceID, &d.SiteID, &d.EnvironmentID, &d.Status, &d.CommitHash, &storagePath, &url, &logs, &d.TriggeredBy, &d.CreatedAt, &d.FinishedAt,
+	var storagePath, url, logs, errorMessage sql.NullString
+	var sourceDeploymentID uuid.NullUUID
+	err := row.Scan(
+		&d.ID, &d.WorkspaceID, &d.SiteID, &d.EnvironmentID, &d.Status, &d.CommitHash, &storagePath, &url, &logs, &errorMessage,
+		&d.TriggeredBy, &d.CreatedAt, &d.QueuedAt, &d.StartedAt, &d.FinishedAt, &sourceDeploymentID, &d.ScheduledAt,
 	)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("deployment not found")
-		}
-		return nil, fmt.Errorf("failed to get deployment: %w", err)
+		return nil, err
+	}
+	if sourceDeploymentID.Valid {
+		d.SourceDeploymentID = &sourceDeploymentID.UUID
 	}
 	d.StoragePath = storagePath.String
 	d.URL = url.String
 	d.Logs = logs.String
+	d.ErrorMessage = errorMessage.String
+	return d, nil
+}
+
+func (r *DeploymentRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Deployment, error) {
+	query := `SELECT ` + deploymentColumns + ` FROM deployments WHERE id = $1`
+	d, err := scanDeployment(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("deployment %w", domain.ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get deployment: %w", err)
+	}
 	return d, nil
 }
+
+func (r *DeploymentRepository) GetLastSuccessful(ctx context.Context, siteID, environmentID uuid.UUID) (*domain.Deployment, error) {
+	query := `
+		SELECT ` + deploymentColumns + `
+		FROM deployments
+		WHERE site_id = $1 AND environment_id = $2 AND status = 'success'
+		ORDER BY finished_at DESC NULLS LAST, created_at DESC
+		LIMIT 1
+	`
+	d, err := scanDeployment(r.db.QueryRowContext(ctx, query, siteID, environmentID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("deployment %w", domain.ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get last successful deployment: %w", err)
+	}
+	return d, nil
+}
+
+func (r *DeploymentRepository) AppendLogs(ctx context.Context, id uuid.UUID, text string) error {
+	query := `UPDATE deployments SET logs = COALESCE(logs, '') || $1 WHERE id = $2`
+	_, err := r.db.ExecContext(ctx, query, text, id)
+	if err != nil {
+		return fmt.Errorf("failed to append deployment logs: %w", err)
+	}
+	return nil
+}
+
+func (r *DeploymentRepository) GetNewer(ctx context.Context, d *domain.Deployment) (*domain.Deployment, error) {
+	since := d.CreatedAt
+	if d.ScheduledAt != nil {
+		since = *d.ScheduledAt
+	}
+	query := `
+		SELECT ` + deploymentColumns + `
+		FROM deployments
+		WHERE environment_id = $1 AND COALESCE(scheduled_at, created_at) > $2 AND id <> $3
+		  AND status IN ('pending', 'building', 'success')
+		ORDER BY COALESCE(scheduled_at, created_at) DESC
+		LIMIT 1
+	`
+	n, err := scanDeployment(r.db.QueryRowContext(ctx, query, d.EnvironmentID, since, d.ID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("deployment %w", domain.ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get newer deployment: %w", err)
+	}
+	return n, nil
+}
+
+func (r *DeploymentRepository) ListByStatus(ctx context.Context, status string) ([]*domain.Deployment, error) {
+	query := `
+		SELECT ` + deploymentColumns + `
+		FROM deployments
+		WHERE status = $1
+		ORDER BY created_at ASC
+	`
+	rows, err := r.db.QueryContext(ctx, query, status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deployments: %w", err)
+	}
+	defer rows.Close()
+
+	var deployments []*domain.Deployment
+	for rows.Next() {
+		d, err := scanDeployment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan deployment: %w", err)
+		}
+		deployments = append(deployments, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list deployments: %w", err)
+	}
+	return deployments, nil
+}
+
+func (r *DeploymentRepository) List(ctx context.Context, filter domain.DeploymentFilter) ([]*domain.Deployment, error) {
+	conditions := []string{"workspace_id = $1"}
+	args := []interface{}{filter.WorkspaceID}
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.SiteID != nil {
+		add("site_id = $%d", *filter.SiteID)
+	}
+	if filter.EnvironmentID != nil {
+		add("environment_id = $%d", *filter.EnvironmentID)
+	}
+	if filter.Status != "" {
+		add("status = $%d", filter.Status)
+	}
+	if filter.TriggeredBy != nil {
+		add("triggered_by = $%d", *filter.TriggeredBy)
+	}
+	if filter.CreatedAfter != nil {
+		add("created_at >= $%d", *filter.CreatedAfter)
+	}
+	if filter.CreatedBefore != nil {
+		add("created_at < $%d", *filter.CreatedBefore)
+	}
+
+	order, cmp := "DESC", "<"
+	if filter.Ascending {
+		order, cmp = "ASC", ">"
+	}
+	if filter.After != nil {
+		args = append(args, filter.After.CreatedAt, filter.After.ID)
+		conditions = append(conditions, fmt.Sprintf("(created_at, id) %s ($%d, $%d)", cmp, len(args)-1, len(args)))
+	}
+	args = append(args, filter.Limit)
+
+	// Logs are left out of listings; they are read per deployment
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM deployments
+		WHERE %s
+		ORDER BY created_at %s, id %s
+		LIMIT $%d
+	`, strings.Replace(deploymentColumns, "logs", "NULL", 1), strings.Join(conditions, " AND "), order, order, len(args))
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deployments: %w", err)
+	}
+	defer rows.Close()
+
+	deployments := []*domain.Deployment{}
+	for rows.Next() {
+		d, err := scanDeployment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan deployment: %w", err)
+		}
+		deployments = append(deployments, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list deployments: %w", err)
+	}
+	return deployments, nil
+}
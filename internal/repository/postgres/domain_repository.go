@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"time"
 
 	"openbook/internal/domain"
 	"openbook/internal/repository"
@@ -27,24 +28,107 @@ func (r *DomainRepository) Create(ctx context.Context, d *domain.Domain) error {
 	_, err := r.db.ExecContext(ctx, query,
 		d.ID, d.WorkspaceID, d.SiteID, d.Domain, d.Type, d.Status, d.DNSVerified, d.SSLStatus, d.VerificationToken, d.CreatedAt,
 	)
+	if isUniqueViolation(err) {
+		return fmt.Errorf("%w: domain %s is already registered in the workspace", domain.ErrConflict, d.Domain)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to create domain: %w", err)
 	}
 	return nil
 }
 
-func (r *DomainRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Domain, error) {
+// Update saves the verification state of a domain. Activating a domain
+// that is already active elsewhere fails with domain.ErrConflict.
+func (r *DomainRepository) Update(ctx context.Context, d *domain.Domain) error {
+	query := `
+		UPDATE domains
+		SET status = $2, dns_verified = $3, verification_error = $4, verified_at = $5, checked_at = $6
+		WHERE id = $1
+	`
+	res, err := r.db.ExecContext(ctx, query,
+		d.ID, d.Status, d.DNSVerified, d.VerificationError, d.VerifiedAt, d.CheckedAt,
+	)
+	if isUniqueViolation(err) {
+		return fmt.Errorf("%w: domain %s is already active for another site", domain.ErrConflict, d.Domain)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update domain: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("domain %w", domain.ErrNotFound)
+	}
+	return nil
+}
+
+// UpdateCertificate saves the certificate state of a domain
+func (r *DomainRepository) UpdateCertificate(ctx context.Context, d *domain.Domain) error {
 	query := `
-		SELECT id, workspace_id, site_id, domain, type, status, dns_verified, ssl_status, verification_token, created_at
-		FROM domains WHERE id = $1
+		UPDATE domains
+		SET ssl_status = $2, ssl_error = $3, ssl_checked_at = $4, ssl_expires_at = $5
+		WHERE id = $1
 	`
+	res, err := r.db.ExecContext(ctx, query, d.ID, d.SSLStatus, d.SSLError, d.SSLCheckedAt, d.SSLExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to update domain certificate: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("domain %w", domain.ErrNotFound)
+	}
+	return nil
+}
+
+// ClaimCertificate marks an active domain as provisioning unless another
+// request started after staleBefore. It reports whether the caller owns the
+// request.
+func (r *DomainRepository) ClaimCertificate(ctx context.Context, id uuid.UUID, staleBefore time.Time) (bool, error) {
+	query := `
+		UPDATE domains
+		SET ssl_status = 'provisioning', ssl_checked_at = NOW()
+		WHERE id = $1 AND status = 'active'
+			AND (ssl_status <> 'provisioning' OR ssl_checked_at IS NULL OR ssl_checked_at < $2)
+	`
+	res, err := r.db.ExecContext(ctx, query, id, staleBefore)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim domain certificate: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to claim domain certificate: %w", err)
+	}
+	return n == 1, nil
+}
+
+func (r *DomainRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM domains WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete domain: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("domain %w", domain.ErrNotFound)
+	}
+	return nil
+}
+
+// domainColumns is the column list read by scanDomain
+const domainColumns = `d.id, d.workspace_id, d.site_id, d.domain, d.type, d.status, d.dns_verified, d.ssl_status, d.verification_token, d.verification_error, d.verified_at, d.checked_at, d.ssl_error, d.ssl_checked_at, d.ssl_expires_at, d.created_at`
+
+func scanDomain(row rowScanner) (*domain.Domain, error) {
 	d := &domain.Domain{}
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&d.ID, &d.WorkspaceID, &d.SiteID, &d.Domain, &d.Type, &d.Status, &d.DNSVerified, &d.SSLStatus, &d.VerificationToken, &d.CreatedAt,
+	err := row.Scan(
+		&d.ID, &d.WorkspaceID, &d.SiteID, &d.Domain, &d.Type, &d.Status, &d.DNSVerified, &d.SSLStatus, &d.VerificationToken, &d.VerificationError, &d.VerifiedAt, &d.CheckedAt, &d.SSLError, &d.SSLCheckedAt, &d.SSLExpiresAt, &d.CreatedAt,
 	)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (r *DomainRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Domain, error) {
+	query := `SELECT ` + domainColumns + ` FROM domains d WHERE d.id = $1`
+	d, err := scanDomain(r.db.QueryRowContext(ctx, query, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("domain not found")
+			return nil, fmt.Errorf("domain %w", domain.ErrNotFound)
 		}
 		return nil, fmt.Errorf("failed to get domain: %w", err)
 	}
@@ -52,23 +136,87 @@ func (r *DomainRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.D
 }
 
 func (r *DomainRepository) ListBySite(ctx context.Context, siteID uuid.UUID) ([]domain.Domain, error) {
+	query := `SELECT ` + domainColumns + ` FROM domains d WHERE d.site_id = $1 ORDER BY d.created_at, d.id`
+	return r.list(ctx, query, siteID)
+}
+
+func (r *DomainRepository) ListByHost(ctx context.Context, host string) ([]domain.Domain, error) {
+	query := `SELECT ` + domainColumns + ` FROM domains d WHERE lower(split_part(d.domain, '/', 1)) = lower($1) ORDER BY d.created_at, d.id`
+	return r.list(ctx, query, host)
+}
+
+// ListForVerification returns the domains of live sites due for a DNS check:
+// never checked, pending and last checked before pendingBefore, or verified
+// or failed and last checked before recheckBefore. Least recently checked
+// domains come first.
+func (r *DomainRepository) ListForVerification(ctx context.Context, pendingBefore, recheckBefore time.Time, limit int) ([]domain.Domain, error) {
+	query := `
+		SELECT ` + domainColumns + `
+		FROM domains d
+		JOIN sites s ON s.id = d.site_id AND s.deleted_at IS NULL
+		WHERE d.checked_at IS NULL
+			OR (d.status = 'pending' AND d.checked_at < $1)
+			OR (d.status <> 'pending' AND d.checked_at < $2)
+		ORDER BY d.checked_at NULLS FIRST, d.id
+		LIMIT $3
+	`
+	return r.list(ctx, query, pendingBefore, recheckBefore, limit)
+}
+
+// ListForCertificates returns the active domains of live sites that need a
+// certificate: without one, failed or stuck provisioning and last tried
+// before retryBefore, or expiring before renewBefore
+func (r *DomainRepository) ListForCertificates(ctx context.Context, renewBefore, retryBefore time.Time, limit int) ([]domain.Domain, error) {
 	query := `
-		SELECT id, workspace_id, site_id, domain, type, status, dns_verified, ssl_status, verification_token, created_at
-		FROM domains WHERE site_id = $1
+		SELECT ` + domainColumns + `
+		FROM domains d
+		JOIN sites s ON s.id = d.site_id AND s.deleted_at IS NULL
+		WHERE d.status = 'active' AND (
+			d.ssl_status = 'none'
+			OR (d.ssl_status IN ('provisioning', 'error') AND (d.ssl_checked_at IS NULL OR d.ssl_checked_at < $2))
+			OR (d.ssl_status = 'active' AND (d.ssl_expires_at IS NULL OR d.ssl_expires_at < $1))
+		)
+		ORDER BY d.ssl_checked_at NULLS FIRST, d.id
+		LIMIT $3
 	`
-	rows, err := r.db.QueryContext(ctx, query, siteID)
+	return r.list(ctx, query, renewBefore, retryBefore, limit)
+}
+
+func (r *DomainRepository) list(ctx context.Context, query string, args ...interface{}) ([]domain.Domain, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list domains: %w", err)
 	}
 	defer rows.Close()
 
-	var domains []domain.Domain
+	domains := []domain.Domain{}
 	for rows.Next() {
-		var d domain.Domain
-		if err := rows.Scan(&d.ID, &d.WorkspaceID, &d.SiteID, &d.Domain, &d.Type, &d.Status, &d.DNSVerified, &d.SSLStatus, &d.VerificationToken, &d.CreatedAt); err != nil {
+		d, err := scanDomain(rows)
+		if err != nil {
 			return nil, err
 		}
-		domains = append(domains, d)
+		domains = append(domains, *d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list domains: %w", err)
 	}
 	return domains, nil
 }
+
+func (r *DomainRepository) GetByDomain(ctx context.Context, name string) (*domain.Domain, error) {
+	// Several workspaces may claim a name; the active claim comes first
+	query := `
+		SELECT ` + domainColumns + ` FROM domains d
+		WHERE lower(d.domain) = lower($1)
+		ORDER BY d.status = 'active' DESC, d.created_at, d.id
+		LIMIT 1
+	`
+	d, err := scanDomain(r.db.QueryRowContext(ctx, query, name))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("domain %w", domain.ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get domain: %w", err)
+	}
+	return d, nil
+}
@@ -0,0 +1,204 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"openbook/internal/domain"
+	"openbook/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+type EnvironmentRepository struct {
+	db *sql.DB
+}
+
+func NewEnvironmentRepository(db *sql.DB) repository.EnvironmentRepository {
+	return &EnvironmentRepository{db: db}
+}
+
+// previewHostIndex keeps the hosts of active previews unique
+const previewHostIndex = "idx_environments_preview_host"
+
+func (r *EnvironmentRepository) Create(ctx context.Context, e *domain.Environment) error {
+	return createEnvironment(ctx, r.db, e)
+}
+
+func createEnvironment(ctx context.Context, db execer, e *domain.Environment) error {
+	query := `
+		INSERT INTO environments (id, workspace_id, site_id, name, branch_id, url, is_active, is_preview, last_activity_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`
+	_, err := db.ExecContext(ctx, query,
+		e.ID, e.WorkspaceID, e.SiteID, e.Name, nullUUID(e.BranchID), e.URL, e.IsActive, e.IsPreview, e.LastActivityAt, e.CreatedAt,
+	)
+	if isUniqueViolationOf(err, previewHostIndex) {
+		return fmt.Errorf("%w: preview host %s is already in use", domain.ErrConflict, e.URL)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create environment: %w", err)
+	}
+	return nil
+}
+
+func (r *EnvironmentRepository) Update(ctx context.Context, e *domain.Environment) error {
+	query := `
+		UPDATE environments SET branch_id = $1, url = $2, is_active = $3, last_activity_at = $4
+		WHERE id = $5
+	`
+	_, err := r.db.ExecContext(ctx, query, nullUUID(e.BranchID), e.URL, e.IsActive, e.LastActivityAt, e.ID)
+	if isUniqueViolationOf(err, previewHostIndex) {
+		return fmt.Errorf("%w: preview host %s is already in use", domain.ErrConflict, e.URL)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update environment: %w", err)
+	}
+	return nil
+}
+
+// nullUUID stores the zero UUID as NULL
+func nullUUID(id uuid.UUID) uuid.NullUUID {
+	return uuid.NullUUID{UUID: id, Valid: id != uuid.Nil}
+}
+
+const environmentColumns = `id, workspace_id, site_id, name, branch_id, url, is_active, live_deployment_id, is_preview, last_activity_at, created_at`
+
+// liveSite restricts environments to those of sites that are not deleted
+const liveSite = `EXISTS (SELECT 1 FROM sites s WHERE s.id = environments.site_id AND s.deleted_at IS NULL)`
+
+func scanEnvironment(row rowScanner) (*domain.Environment, error) {
+	e := &domain.Environment{}
+	var url sql.NullString
+	var branchID, liveDeploymentID uuid.NullUUID
+	err := row.Scan(
+		&e.ID, &e.WorkspaceID, &e.SiteID, &e.Name, &branchID, &url, &e.IsActive, &liveDeploymentID, &e.IsPreview, &e.LastActivityAt, &e.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	e.BranchID = branchID.UUID
+	e.URL = url.String
+	if liveDeploymentID.Valid {
+		e.LiveDeploymentID = &liveDeploymentID.UUID
+	}
+	return e, nil
+}
+
+func (r *EnvironmentRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Environment, error) {
+	query := `SELECT ` + environmentColumns + ` FROM environments WHERE id = $1`
+	e, err := scanEnvironment(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("environment %w", domain.ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get environment: %w", err)
+	}
+	return e, nil
+}
+
+func (r *EnvironmentRepository) GetByName(ctx context.Context, siteID uuid.UUID, name string) (*domain.Environment, error) {
+	query := `SELECT ` + environmentColumns + ` FROM environments WHERE site_id = $1 AND name = $2`
+	e, err := scanEnvironment(r.db.QueryRowContext(ctx, query, siteID, name))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("environment %w", domain.ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get environment: %w", err)
+	}
+	return e, nil
+}
+
+func (r *EnvironmentRepository) GetByHost(ctx context.Context, host string) (*domain.Environment, error) {
+	// URLs are stored with or without scheme, port and path; compare the host part only
+	query := `
+		SELECT ` + environmentColumns + `
+		FROM environments
+		WHERE is_active AND url IS NOT NULL
+		  AND ` + liveSite + `
+		  AND lower(regexp_replace(url, '^[A-Za-z][A-Za-z0-9+.-]*://|[:/].*$', '', 'g')) = lower($1)
+		LIMIT 2
+	`
+	envs, err := r.list(ctx, query, host)
+	if err != nil {
+		return nil, err
+	}
+	switch len(envs) {
+	case 0:
+		return nil, fmt.Errorf("environment %w", domain.ErrNotFound)
+	case 1:
+		return envs[0], nil
+	default:
+		// Serving either one could show a site to another site's visitors
+		return nil, fmt.Errorf("%w: host %s is used by several environments", domain.ErrConflict, host)
+	}
+}
+
+func (r *EnvironmentRepository) SetLiveDeployment(ctx context.Context, id, deploymentID uuid.UUID) error {
+	query := `UPDATE environments SET live_deployment_id = $1 WHERE id = $2`
+	_, err := r.db.ExecContext(ctx, query, deploymentID, id)
+	if err != nil {
+		return fmt.Errorf("failed to set live deployment: %w", err)
+	}
+	return nil
+}
+
+func (r *EnvironmentRepository) ListExpiredPreviews(ctx context.Context, inactiveSince time.Time) ([]*domain.Environment, error) {
+	query := `
+		SELECT ` + environmentColumns + `
+		FROM environments
+		WHERE is_preview AND is_active
+		  AND (branch_id IS NULL OR last_activity_at IS NULL OR last_activity_at < $1)
+	`
+	rows, err := r.db.QueryContext(ctx, query, inactiveSince)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list expired previews: %w", err)
+	}
+	defer rows.Close()
+
+	var envs []*domain.Environment
+	for rows.Next() {
+		e, err := scanEnvironment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan environment: %w", err)
+		}
+		envs = append(envs, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list expired previews: %w", err)
+	}
+	return envs, nil
+}
+
+// ListByBranch returns the active environments of live sites tracking a branch
+func (r *EnvironmentRepository) ListByBranch(ctx context.Context, branchID uuid.UUID) ([]*domain.Environment, error) {
+	query := `
+		SELECT ` + environmentColumns + `
+		FROM environments
+		WHERE branch_id = $1 AND is_active AND ` + liveSite + `
+	`
+	return r.list(ctx, query, branchID)
+}
+
+func (r *EnvironmentRepository) list(ctx context.Context, query string, args ...interface{}) ([]*domain.Environment, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list environments: %w", err)
+	}
+	defer rows.Close()
+
+	var envs []*domain.Environment
+	for rows.Next() {
+		e, err := scanEnvironment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan environment: %w", err)
+		}
+		envs = append(envs, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list environments: %w", err)
+	}
+	return envs, nil
+}
@@ -40,7 +40,7 @@ func (r *GitRepository) GetBlob(ctx context.Context, hash string) (*domain.Blob,
 	err := r.db.QueryRowContext(ctx, query, hash).Scan(&b.Hash, &contentJSON, &b.SizeBytes, &b.CreatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("blob not found")
+			return nil, fmt.Errorf("blob %w", domain.ErrNotFound)
 		}
 		return nil, fmt.Errorf("failed to get blob: %w", err)
 	}
@@ -49,11 +49,15 @@ func (r *GitRepository) GetBlob(ctx context.Context, hash string) (*domain.Blob,
 }
 
 func (r *GitRepository) CreateCommit(ctx context.Context, commit *domain.Commit) error {
+	return createCommit(ctx, r.db, commit)
+}
+
+func createCommit(ctx context.Context, db execer, commit *domain.Commit) error {
 	query := `
 		INSERT INTO commits (id, workspace_id, site_id, tree_hash, parent_hash, merge_parent_hash, message, author_id, created_at)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 	`
-	_, err := r.db.ExecContext(ctx, query,
+	_, err := db.ExecContext(ctx, query,
 		commit.ID, commit.WorkspaceID, commit.SiteID, commit.TreeHash, commit.ParentHash, commit.MergeParentHash, commit.Message, commit.AuthorID, commit.CreatedAt,
 	)
 	if err != nil {
@@ -76,7 +80,7 @@ func (r *GitRepository) GetCommit(ctx context.Context, id uuid.UUID) (*domain.Co
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("commit not found")
+			return nil, fmt.Errorf("commit %w", domain.ErrNotFound)
 		}
 		return nil, fmt.Errorf("failed to get commit: %w", err)
 	}
@@ -129,11 +133,15 @@ func (r *GitRepository) GetTree(ctx context.Context, commitID uuid.UUID) ([]doma
 }
 
 func (r *GitRepository) CreateBranch(ctx context.Context, branch *domain.Branch) error {
+	return createBranch(ctx, r.db, branch)
+}
+
+func createBranch(ctx context.Context, db execer, branch *domain.Branch) error {
 	query := `
 		INSERT INTO branches (id, workspace_id, site_id, name, head_commit_id, is_protected, created_at, updated_at)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 	`
-	_, err := r.db.ExecContext(ctx, query,
+	_, err := db.ExecContext(ctx, query,
 		branch.ID, branch.WorkspaceID, branch.SiteID, branch.Name, branch.HeadCommitID, branch.IsProtected, branch.CreatedAt, branch.UpdatedAt,
 	)
 	if err != nil {
@@ -147,14 +155,26 @@ func (r *GitRepository) GetBranch(ctx context.Context, siteID uuid.UUID, name st
 		SELECT id, workspace_id, site_id, name, head_commit_id, is_protected, created_at, updated_at
 		FROM branches WHERE site_id = $1 AND name = $2
 	`
+	return scanBranch(r.db.QueryRowContext(ctx, query, siteID, name))
+}
+
+func (r *GitRepository) GetBranchByID(ctx context.Context, id uuid.UUID) (*domain.Branch, error) {
+	query := `
+		SELECT id, workspace_id, site_id, name, head_commit_id, is_protected, created_at, updated_at
+		FROM branches WHERE id = $1
+	`
+	return scanBranch(r.db.QueryRowContext(ctx, query, id))
+}
+
+func scanBranch(row rowScanner) (*domain.Branch, error) {
 	b := &domain.Branch{}
 	var headCommitID uuid.NullUUID
-	err := r.db.QueryRowContext(ctx, query, siteID, name).Scan(
+	err := row.Scan(
 		&b.ID, &b.WorkspaceID, &b.SiteID, &b.Name, &headCommitID, &b.IsProtected, &b.CreatedAt, &b.UpdatedAt,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("branch not found")
+			return nil, fmt.Errorf("branch %w", domain.ErrNotFound)
 		}
 		return nil, fmt.Errorf("failed to get branch: %w", err)
 	}
@@ -174,3 +194,15 @@ func (r *GitRepository) UpdateBranch(ctx context.Context, branch *domain.Branch)
 	}
 	return nil
 }
+
+func (r *GitRepository) DeleteBranch(ctx context.Context, id uuid.UUID) error {
+	query := `DELETE FROM branches WHERE id = $1`
+	res, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete branch: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("branch %w", domain.ErrNotFound)
+	}
+	return nil
+}
@@ -3,12 +3,14 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 
 	"openbook/internal/domain"
 	"openbook/internal/repository"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 type SiteRepository struct {
@@ -19,32 +21,131 @@ func NewSiteRepository(db *sql.DB) repository.SiteRepository {
 	return &SiteRepository{db: db}
 }
 
+// execer runs statements on the database or within a transaction
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
 func (r *SiteRepository) Create(ctx context.Context, site *domain.Site) error {
+	return createSite(ctx, r.db, site)
+}
+
+// CreateInitialized creates a site together with its initial commit, branch
+// and environment, all or none of them
+func (r *SiteRepository) CreateInitialized(ctx context.Context, site *domain.Site, commit *domain.Commit, branch *domain.Branch, env *domain.Environment) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := createSite(ctx, tx, site); err != nil {
+		return err
+	}
+	if err := createCommit(ctx, tx, commit); err != nil {
+		return err
+	}
+	if err := createBranch(ctx, tx, branch); err != nil {
+		return err
+	}
+	if err := createEnvironment(ctx, tx, env); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to create site: %w", err)
+	}
+	return nil
+}
+
+func createSite(ctx context.Context, db execer, site *domain.Site) error {
+	if site.BrokenLinks == "" {
+		site.BrokenLinks = domain.BrokenLinksWarn
+	}
 	query := `
-		INSERT INTO sites (id, workspace_id, name, slug, plan, default_environment, is_public, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		INSERT INTO sites (id, workspace_id, name, slug, plan, default_environment, is_public, broken_links, whats_new, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 	`
-	_, err := r.db.ExecContext(ctx, query,
-		site.ID, site.WorkspaceID, site.Name, site.Slug, site.Plan, site.DefaultEnvironment, site.IsPublic, site.CreatedAt, site.UpdatedAt,
+	_, err := db.ExecContext(ctx, query,
+		site.ID, site.WorkspaceID, site.Name, site.Slug, site.Plan, site.DefaultEnvironment, site.IsPublic, site.BrokenLinks, site.WhatsNew, site.CreatedAt, site.UpdatedAt,
 	)
+	if isUniqueViolation(err) {
+		return fmt.Errorf("%w: slug %s is already used in the workspace", domain.ErrConflict, site.Slug)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to create site: %w", err)
 	}
 	return nil
 }
 
-func (r *SiteRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Site, error) {
+// Update saves the editable settings of a site
+func (r *SiteRepository) Update(ctx context.Context, site *domain.Site) error {
 	query := `
-		SELECT id, workspace_id, name, slug, plan, default_environment, is_public, created_at, updated_at
-		FROM sites WHERE id = $1
+		UPDATE sites SET name = $1, slug = $2, default_environment = $3, is_public = $4, broken_links = $5, whats_new = $6, updated_at = $7
+		WHERE id = $8 AND deleted_at IS NULL
 	`
+	res, err := r.db.ExecContext(ctx, query,
+		site.Name, site.Slug, site.DefaultEnvironment, site.IsPublic, site.BrokenLinks, site.WhatsNew, site.UpdatedAt, site.ID,
+	)
+	if isUniqueViolation(err) {
+		return fmt.Errorf("%w: slug %s is already used in the workspace", domain.ErrConflict, site.Slug)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update site: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("site %w", domain.ErrNotFound)
+	}
+	return nil
+}
+
+// Delete soft-deletes a site; deleted sites are no longer returned
+// Delete soft-deletes a site and removes its domains, so that their names
+// can be claimed again
+func (r *SiteRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE sites SET deleted_at = NOW(), updated_at = NOW() WHERE id = $1 AND deleted_at IS NULL`
+	res, err := tx.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete site: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("site %w", domain.ErrNotFound)
+	}
+	// Certificates go with their domains
+	if _, err := tx.ExecContext(ctx, `DELETE FROM domains WHERE site_id = $1`, id); err != nil {
+		return fmt.Errorf("failed to delete site domains: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to delete site: %w", err)
+	}
+	return nil
+}
+
+// siteColumns is the column list read by scanSite
+const siteColumns = `id, workspace_id, name, slug, plan, default_environment, is_public, broken_links, whats_new, created_at, updated_at`
+
+func scanSite(row rowScanner) (*domain.Site, error) {
 	s := &domain.Site{}
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&s.ID, &s.WorkspaceID, &s.Name, &s.Slug, &s.Plan, &s.DefaultEnvironment, &s.IsPublic, &s.CreatedAt, &s.UpdatedAt,
+	err := row.Scan(
+		&s.ID, &s.WorkspaceID, &s.Name, &s.Slug, &s.Plan, &s.DefaultEnvironment, &s.IsPublic, &s.BrokenLinks, &s.WhatsNew, &s.CreatedAt, &s.UpdatedAt,
 	)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (r *SiteRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Site, error) {
+	query := `SELECT ` + siteColumns + ` FROM sites WHERE id = $1 AND deleted_at IS NULL`
+	s, err := scanSite(r.db.QueryRowContext(ctx, query, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("site not found")
+			return nil, fmt.Errorf("site %w", domain.ErrNotFound)
 		}
 		return nil, fmt.Errorf("failed to get site: %w", err)
 	}
@@ -52,17 +153,11 @@ func (r *SiteRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Sit
 }
 
 func (r *SiteRepository) GetBySlug(ctx context.Context, workspaceID uuid.UUID, slug string) (*domain.Site, error) {
-	query := `
-		SELECT id, workspace_id, name, slug, plan, default_environment, is_public, created_at, updated_at
-		FROM sites WHERE workspace_id = $1 AND slug = $2
-	`
-	s := &domain.Site{}
-	err := r.db.QueryRowContext(ctx, query, workspaceID, slug).Scan(
-		&s.ID, &s.WorkspaceID, &s.Name, &s.Slug, &s.Plan, &s.DefaultEnvironment, &s.IsPublic, &s.CreatedAt, &s.UpdatedAt,
-	)
+	query := `SELECT ` + siteColumns + ` FROM sites WHERE workspace_id = $1 AND slug = $2 AND deleted_at IS NULL`
+	s, err := scanSite(r.db.QueryRowContext(ctx, query, workspaceID, slug))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("site not found")
+			return nil, fmt.Errorf("site %w", domain.ErrNotFound)
 		}
 		return nil, fmt.Errorf("failed to get site: %w", err)
 	}
@@ -70,23 +165,35 @@ func (r *SiteRepository) GetBySlug(ctx context.Context, workspaceID uuid.UUID, s
 }
 
 func (r *SiteRepository) List(ctx context.Context, workspaceID uuid.UUID) ([]domain.Site, error) {
-	query := `
-		SELECT id, workspace_id, name, slug, plan, default_environment, is_public, created_at, updated_at
-		FROM sites WHERE workspace_id = $1
-	`
+	query := `SELECT ` + siteColumns + ` FROM sites WHERE workspace_id = $1 AND deleted_at IS NULL ORDER BY created_at, id`
 	rows, err := r.db.QueryContext(ctx, query, workspaceID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list sites: %w", err)
 	}
 	defer rows.Close()
 
-	var sites []domain.Site
+	sites := []domain.Site{}
 	for rows.Next() {
-		var s domain.Site
-		if err := rows.Scan(&s.ID, &s.WorkspaceID, &s.Name, &s.Slug, &s.Plan, &s.DefaultEnvironment, &s.IsPublic, &s.CreatedAt, &s.UpdatedAt); err != nil {
+		s, err := scanSite(rows)
+		if err != nil {
 			return nil, err
 		}
-		sites = append(sites, s)
+		sites = append(sites, *s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list sites: %w", err)
 	}
 	return sites, nil
 }
+
+// isUniqueViolation reports whether err is a unique constraint violation
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// isUniqueViolationOf reports whether err violates the named unique constraint or index
+func isUniqueViolationOf(err error, constraint string) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == constraint
+}
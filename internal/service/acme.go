@@ -0,0 +1,217 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+// ChallengeSolver publishes the key authorization of an HTTP-01 challenge at
+// http://<domain>/.well-known/acme-challenge/<token> while it is validated
+type ChallengeSolver interface {
+	Present(ctx context.Context, token, keyAuthorization string) error
+	CleanUp(ctx context.Context, token string) error
+}
+
+// IssuedCertificate is a certificate chain and its private key, PEM encoded
+type IssuedCertificate struct {
+	PEM      []byte
+	NotAfter time.Time
+}
+
+// ACME obtains certificates from an ACME directory, such as Let's Encrypt or
+// a local Pebble server, answering HTTP-01 challenges
+type ACME struct {
+	directoryURL string
+	email        string
+	httpClient   *http.Client
+
+	mu     sync.Mutex
+	client *acme.Client
+}
+
+// NewACME returns a client of the directory. caFile optionally names PEM
+// certificates trusted for the directory's HTTPS endpoint in addition to
+// the system roots.
+func NewACME(directoryURL, email, caFile string) (*ACME, error) {
+	httpClient := &http.Client{Timeout: 30 * time.Second}
+	if caFile != "" {
+		data, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ACME CA file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates in ACME CA file %s", caFile)
+		}
+		httpClient.Transport = &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{RootCAs: pool},
+		}
+	}
+	return &ACME{directoryURL: directoryURL, email: email, httpClient: httpClient}, nil
+}
+
+func (a *ACME) DirectoryURL() string {
+	return a.directoryURL
+}
+
+// NewAccountKey generates an account key, PEM encoded
+func NewAccountKey() ([]byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
+
+// ParseAccountKey decodes an account key made by NewAccountKey
+func ParseAccountKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "EC PRIVATE KEY" {
+		return nil, errors.New("invalid ACME account key")
+	}
+	return x509.ParseECPrivateKey(block.Bytes)
+}
+
+// Issue obtains a certificate for host with a new private key, registering
+// the account on first use
+func (a *ACME) Issue(ctx context.Context, accountKey crypto.Signer, host string, solver ChallengeSolver) (*IssuedCertificate, error) {
+	client, err := a.account(ctx, accountKey)
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := client.AuthorizeOrder(ctx, acme.DomainIDs(host))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create order: %w", err)
+	}
+	for _, authzURL := range order.AuthzURLs {
+		if err := a.authorize(ctx, client, authzURL, solver); err != nil {
+			return nil, err
+		}
+	}
+	if order, err = client.WaitOrder(ctx, order.URI); err != nil {
+		return nil, fmt.Errorf("order failed: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: host},
+		DNSNames: []string{host},
+	}, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate request: %w", err)
+	}
+	chain, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to finalize order: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(chain[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate: %w", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	var out []byte
+	for _, der := range chain {
+		out = append(out, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	out = append(out, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})...)
+	return &IssuedCertificate{PEM: out, NotAfter: leaf.NotAfter}, nil
+}
+
+// authorize fulfills the HTTP-01 challenge of a pending authorization
+func (a *ACME) authorize(ctx context.Context, client *acme.Client, authzURL string, solver ChallengeSolver) error {
+	authz, err := client.GetAuthorization(ctx, authzURL)
+	if err != nil {
+		return fmt.Errorf("failed to get authorization: %w", err)
+	}
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+
+	var challenge *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == "http-01" {
+			challenge = c
+			break
+		}
+	}
+	if challenge == nil {
+		return fmt.Errorf("no http-01 challenge offered for %s", authz.Identifier.Value)
+	}
+
+	keyAuthorization, err := client.HTTP01ChallengeResponse(challenge.Token)
+	if err != nil {
+		return err
+	}
+	if err := solver.Present(ctx, challenge.Token, keyAuthorization); err != nil {
+		return err
+	}
+	defer func() {
+		if err := solver.CleanUp(context.WithoutCancel(ctx), challenge.Token); err != nil {
+			fmt.Printf("failed to clean up ACME challenge: %v\n", err)
+		}
+	}()
+
+	if _, err := client.Accept(ctx, challenge); err != nil {
+		return fmt.Errorf("failed to accept challenge: %w", err)
+	}
+	if _, err := client.WaitAuthorization(ctx, authz.URI); err != nil {
+		return fmt.Errorf("authorization of %s failed: %w", authz.Identifier.Value, err)
+	}
+	return nil
+}
+
+// account returns a client registered with the directory
+func (a *ACME) account(ctx context.Context, key crypto.Signer) (*acme.Client, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.client != nil && a.client.Key == key {
+		return a.client, nil
+	}
+
+	client := &acme.Client{
+		Key:          key,
+		DirectoryURL: a.directoryURL,
+		HTTPClient:   a.httpClient,
+		UserAgent:    "openbook",
+	}
+	account := &acme.Account{}
+	if a.email != "" {
+		account.Contact = []string{"mailto:" + a.email}
+	}
+	if _, err := client.Register(ctx, account, acme.AcceptTOS); err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return nil, fmt.Errorf("failed to register ACME account: %w", err)
+	}
+	a.client = client
+	return client, nil
+}
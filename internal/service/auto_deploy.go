@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// AutoDeploySet holds the environments waiting for an automatic deployment,
+// scored by the unix time in milliseconds their debounce window ends
+const AutoDeploySet = "deployments_auto"
+
+// claimDueAutoDeploys atomically removes and returns the due environments
+var claimDueAutoDeploys = redis.NewScript(`
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, 100)
+if #due > 0 then
+	redis.call('ZREM', KEYS[1], unpack(due))
+end
+return due
+`)
+
+// ScheduleAutoDeploy queues an automatic deployment of an environment at the
+// given time. Scheduling an environment that is already waiting pushes its
+// deployment back, so a burst of changes produces a single build.
+func (p *Publisher) ScheduleAutoDeploy(ctx context.Context, environmentID uuid.UUID, at time.Time) error {
+	err := p.redis.ZAdd(ctx, AutoDeploySet, redis.Z{Score: float64(at.UnixMilli()), Member: environmentID.String()}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to schedule auto deploy: %w", err)
+	}
+	return nil
+}
+
+// ClaimDueAutoDeploys removes the environments whose debounce window ended
+// and returns them. Each environment is claimed by a single caller.
+func (p *Publisher) ClaimDueAutoDeploys(ctx context.Context, now time.Time) ([]uuid.UUID, error) {
+	members, err := claimDueAutoDeploys.Run(ctx, p.redis, []string{AutoDeploySet}, strconv.FormatInt(now.UnixMilli(), 10)).StringSlice()
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim auto deploys: %w", err)
+	}
+	ids := make([]uuid.UUID, 0, len(members))
+	for _, member := range members {
+		id, err := uuid.Parse(member)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,34 @@
+package service
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// dnsTimeout bounds a single query to a configured name server
+const dnsTimeout = 5 * time.Second
+
+// Resolver looks up the DNS records checked when verifying a custom domain.
+// *net.Resolver implements it.
+type Resolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+	LookupCNAME(ctx context.Context, host string) (string, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// NewResolver returns the system resolver, or one that sends every query to
+// the name server at addr (host:port) when it is set, such as a local DNS
+// stand-in
+func NewResolver(addr string) Resolver {
+	if addr == "" {
+		return net.DefaultResolver
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			d := net.Dialer{Timeout: dnsTimeout}
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+}
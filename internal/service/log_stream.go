@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// LogEvent is a single message on a deployment's log channel
+type LogEvent struct {
+	Seq    int    `json:"seq"`              // zero-based line number within the deployment log
+	Line   string `json:"line,omitempty"`   // log line, without trailing newline
+	Status string `json:"status,omitempty"` // final status, set on the last event of a build
+}
+
+// LogStream fans deployment build logs out to API instances through Redis pub/sub
+type LogStream struct {
+	redis *redis.Client
+}
+
+func NewLogStream(r *redis.Client) *LogStream {
+	return &LogStream{redis: r}
+}
+
+func logChannel(deploymentID uuid.UUID) string {
+	return "deployment_logs:" + deploymentID.String()
+}
+
+func (s *LogStream) Publish(ctx context.Context, deploymentID uuid.UUID, event LogEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if err := s.redis.Publish(ctx, logChannel(deploymentID), payload).Err(); err != nil {
+		return fmt.Errorf("failed to publish log event: %w", err)
+	}
+	return nil
+}
+
+// Subscribe returns the live log events of a deployment until ctx is done.
+// The subscription is established before Subscribe returns, so no event
+// published afterwards is missed.
+func (s *LogStream) Subscribe(ctx context.Context, deploymentID uuid.UUID) (<-chan LogEvent, error) {
+	sub := s.redis.Subscribe(ctx, logChannel(deploymentID))
+	if _, err := sub.Receive(ctx); err != nil {
+		sub.Close()
+		return nil, fmt.Errorf("failed to subscribe to deployment logs: %w", err)
+	}
+
+	events := make(chan LogEvent)
+	go func() {
+		defer close(events)
+		defer sub.Close()
+		messages := sub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				var event LogEvent
+				if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+					continue
+				}
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return events, nil
+}
@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
@@ -18,9 +19,10 @@ func NewPublisher(r *redis.Client) *Publisher {
 
 func (p *Publisher) PublishDeployment(ctx context.Context, deploymentID uuid.UUID) error {
 	err := p.redis.XAdd(ctx, &redis.XAddArgs{
-		Stream: "deployments_stream",
+		Stream: DeploymentsStream,
 		Values: map[string]interface{}{
 			"deployment_id": deploymentID.String(),
+			"attempt":       0,
 		},
 	}).Err()
 	if err != nil {
@@ -28,3 +30,29 @@ func (p *Publisher) PublishDeployment(ctx context.Context, deploymentID uuid.UUI
 	}
 	return nil
 }
+
+// ScheduleDeployment queues a deployment onto the deployments stream at the
+// given time. The worker scheduler moves it once the time is reached.
+func (p *Publisher) ScheduleDeployment(ctx context.Context, deploymentID uuid.UUID, at time.Time) error {
+	err := p.redis.ZAdd(ctx, ScheduleSet, redis.Z{Score: float64(at.Unix()), Member: deploymentID.String()}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to schedule deployment: %w", err)
+	}
+	return nil
+}
+
+// UnscheduleDeployment removes a scheduled deployment that was not queued yet
+func (p *Publisher) UnscheduleDeployment(ctx context.Context, deploymentID uuid.UUID) error {
+	if err := p.redis.ZRem(ctx, ScheduleSet, deploymentID.String()).Err(); err != nil {
+		return fmt.Errorf("failed to unschedule deployment: %w", err)
+	}
+	return nil
+}
+
+// PublishCancel asks the worker building a deployment to abort it
+func (p *Publisher) PublishCancel(ctx context.Context, deploymentID uuid.UUID) error {
+	if err := p.redis.Publish(ctx, CancelChannel, deploymentID.String()).Err(); err != nil {
+		return fmt.Errorf("failed to publish cancel signal: %w", err)
+	}
+	return nil
+}
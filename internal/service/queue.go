@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis keys of the deployment queue
+const (
+	DeploymentsStream = "deployments_stream"
+	DeploymentsGroup  = "deployment_group"
+	DeadLetterStream  = "deployments_dead_letter"
+	RetrySet          = "deployments_retry"
+	// ScheduleSet holds scheduled deployment IDs scored by their publishing time
+	ScheduleSet = "deployments_scheduled"
+	// ReleasedSet holds scheduled deployment IDs moved onto the stream that
+	// no worker has picked up yet; they still have the scheduled status
+	ReleasedSet = "deployments_released"
+	// CancelChannel carries the IDs of deployments whose build must stop
+	CancelChannel = "deployment_cancel"
+)
+
+// DeadLetter is a deployment message that exhausted its attempts
+type DeadLetter struct {
+	ID           string    `json:"id"`
+	DeploymentID uuid.UUID `json:"deployment_id"`
+	Attempts     int       `json:"attempts"`
+	Error        string    `json:"error"`
+	Consumer     string    `json:"consumer"`
+	FailedAt     time.Time `json:"failed_at"`
+}
+
+// ListDeadLetters returns the oldest dead-lettered deployment messages
+func (p *Publisher) ListDeadLetters(ctx context.Context, count int64) ([]DeadLetter, error) {
+	msgs, err := p.redis.XRangeN(ctx, DeadLetterStream, "-", "+", count).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dead letters: %w", err)
+	}
+	letters := make([]DeadLetter, 0, len(msgs))
+	for _, msg := range msgs {
+		letters = append(letters, parseDeadLetter(msg))
+	}
+	return letters, nil
+}
+
+// GetDeadLetter returns a single dead-lettered message, or nil if it does not exist
+func (p *Publisher) GetDeadLetter(ctx context.Context, id string) (*DeadLetter, error) {
+	msgs, err := p.redis.XRange(ctx, DeadLetterStream, id, id).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dead letter: %w", err)
+	}
+	if len(msgs) == 0 {
+		return nil, nil
+	}
+	letter := parseDeadLetter(msgs[0])
+	return &letter, nil
+}
+
+// RequeueDeadLetter moves a dead-lettered message back onto the deployments
+// stream with a fresh attempt counter
+func (p *Publisher) RequeueDeadLetter(ctx context.Context, letter *DeadLetter) error {
+	pipe := p.redis.TxPipeline()
+	pipe.XAdd(ctx, &redis.XAddArgs{
+		Stream: DeploymentsStream,
+		Values: map[string]interface{}{
+			"deployment_id": letter.DeploymentID.String(),
+			"attempt":       0,
+		},
+	})
+	pipe.XDel(ctx, DeadLetterStream, letter.ID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to requeue dead letter: %w", err)
+	}
+	return nil
+}
+
+func parseDeadLetter(msg redis.XMessage) DeadLetter {
+	letter := DeadLetter{ID: msg.ID}
+	if s, ok := msg.Values["deployment_id"].(string); ok {
+		letter.DeploymentID, _ = uuid.Parse(s)
+	}
+	if s, ok := msg.Values["attempts"].(string); ok {
+		letter.Attempts, _ = strconv.Atoi(s)
+	}
+	if s, ok := msg.Values["failed_at"].(string); ok {
+		letter.FailedAt, _ = time.Parse(time.RFC3339, s)
+	}
+	letter.Error, _ = msg.Values["error"].(string)
+	letter.Consumer, _ = msg.Values["consumer"].(string)
+	return letter
+}
@@ -0,0 +1,101 @@
+package static
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"time"
+
+	"openbook/internal/domain"
+	"openbook/internal/repository"
+	"openbook/internal/service"
+)
+
+const (
+	// certificateTTL is how long a loaded certificate is cached; no entry
+	// outlives the certificate itself
+	certificateTTL = 5 * time.Minute
+	// maxCachedCertificates bounds the certificates kept in memory
+	maxCachedCertificates = 1024
+	// unknownNameTTL is how long a server name without certificate is
+	// remembered
+	unknownNameTTL = 5 * time.Second
+	// maxUnknownNames bounds the server names without certificate that are
+	// remembered; any client can send such names
+	maxUnknownNames = 256
+)
+
+// certificateLookupTimeout bounds the lookup made during a TLS handshake
+const certificateLookupTimeout = 5 * time.Second
+
+// Certificates picks the certificate of a custom domain by the server name
+// a TLS client asks for
+type Certificates struct {
+	certRepo repository.CertificateRepository
+	cipher   *service.Cipher
+
+	certs   *lruCache[*tls.Certificate]
+	unknown *lruCache[struct{}]
+}
+
+func NewCertificates(certRepo repository.CertificateRepository, cipher *service.Cipher) *Certificates {
+	return &Certificates{
+		certRepo: certRepo,
+		cipher:   cipher,
+		certs:    newLRUCache[*tls.Certificate](maxCachedCertificates),
+		unknown:  newLRUCache[struct{}](maxUnknownNames),
+	}
+}
+
+// GetCertificate implements tls.Config.GetCertificate
+func (c *Certificates) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	host := normalizeHost(hello.ServerName)
+	if host == "" {
+		return nil, errors.New("no server name")
+	}
+
+	if cert, ok := c.certs.Get(host); ok {
+		return cert, nil
+	}
+	if _, ok := c.unknown.Get(host); ok {
+		return nil, fmt.Errorf("no certificate for %s", host)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), certificateLookupTimeout)
+	defer cancel()
+	cert, err := c.load(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if cert == nil {
+		c.unknown.Add(host, struct{}{}, unknownNameTTL)
+		return nil, fmt.Errorf("no certificate for %s", host)
+	}
+	ttl := certificateTTL
+	if cert.Leaf != nil {
+		ttl = min(ttl, time.Until(cert.Leaf.NotAfter))
+	}
+	c.certs.Add(host, cert, ttl)
+	return cert, nil
+}
+
+// load reads and decrypts the certificate of host; a missing one is nil
+func (c *Certificates) load(ctx context.Context, host string) (*tls.Certificate, error) {
+	stored, err := c.certRepo.GetByHost(ctx, host)
+	if errors.Is(err, domain.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, err := c.cipher.Open(stored.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt certificate of %s: %w", host, err)
+	}
+	cert, err := tls.X509KeyPair(data, data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate of %s: %w", host, err)
+	}
+	return &cert, nil
+}
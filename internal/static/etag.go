@@ -0,0 +1,120 @@
+package static
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// manifestPath is where the worker records a deployment's source files
+const manifestPath = ".openbook/manifest.json"
+
+// maxCachedDeployments bounds the number of deployments whose tags are kept
+const maxCachedDeployments = 64
+
+// buildManifest is the subset of the worker's build manifest used for tags
+type buildManifest struct {
+	Files map[string]struct {
+		BlobHash   string `json:"blob_hash"`
+		OutputPath string `json:"output_path"`
+		Page       *struct {
+			Templated bool `json:"templated"`
+		} `json:"page"`
+		Assets []struct {
+			Path   string `json:"path"`
+			SHA256 string `json:"sha256"`
+		} `json:"assets"`
+	} `json:"files"`
+}
+
+// deploymentTags are the known tags of a deployment's files
+type deploymentTags struct {
+	tags      map[string]string // output path -> tag
+	immutable map[string]bool   // fingerprinted output paths
+}
+
+// etagCache computes strong ETags of deployment files. Deployment
+// directories never change once published, so tags are cached per
+// directory for as long as it is served.
+type etagCache struct {
+	mu          sync.Mutex
+	deployments map[string]*deploymentTags // keyed by deployment dir
+}
+
+func newETagCache() *etagCache {
+	return &etagCache{deployments: make(map[string]*deploymentTags)}
+}
+
+// Tag returns the ETag of a file of a deployment and whether the file is a
+// fingerprinted asset, whose content never changes under its name. Files
+// copied verbatim from the commit are tagged with their blob hash; rendered
+// and generated files with the hash of their content.
+func (c *etagCache) Tag(dir, rel string) (string, bool, error) {
+	c.mu.Lock()
+	d, ok := c.deployments[dir]
+	if !ok {
+		if len(c.deployments) >= maxCachedDeployments {
+			c.deployments = make(map[string]*deploymentTags)
+		}
+		d = blobTags(dir)
+		c.deployments[dir] = d
+	}
+	tag, ok := d.tags[rel]
+	immutable := d.immutable[rel]
+	c.mu.Unlock()
+	if ok {
+		return tag, immutable, nil
+	}
+
+	tag, err := contentTag(filepath.Join(dir, filepath.FromSlash(rel)))
+	if err != nil {
+		return "", false, err
+	}
+	c.mu.Lock()
+	d.tags[rel] = tag
+	c.mu.Unlock()
+	return tag, false, nil
+}
+
+// blobTags reads the tags of the untransformed files and fingerprinted
+// assets from the build manifest. A deployment without manifest falls back
+// to content hashes.
+func blobTags(dir string) *deploymentTags {
+	d := &deploymentTags{tags: make(map[string]string), immutable: make(map[string]bool)}
+	data, err := os.ReadFile(filepath.Join(dir, manifestPath))
+	if err != nil {
+		return d
+	}
+	var manifest buildManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return d
+	}
+	for _, file := range manifest.Files {
+		for _, asset := range file.Assets {
+			d.tags[asset.Path] = `"` + asset.SHA256 + `"`
+			d.immutable[asset.Path] = true
+		}
+		if file.Page != nil && file.Page.Templated {
+			continue
+		}
+		d.tags[filepath.ToSlash(file.OutputPath)] = `"` + file.BlobHash + `"`
+	}
+	return d
+}
+
+func contentTag(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return `"` + hex.EncodeToString(h.Sum(nil)) + `"`, nil
+}
@@ -0,0 +1,114 @@
+package static
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestFile(t *testing.T, dir, rel, content string) {
+	path := filepath.Join(dir, filepath.FromSlash(rel))
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+}
+
+func sumTag(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func TestETagCache_Tag(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "guide/index.html", "<h1>Guide</h1>")
+	writeTestFile(t, dir, "raw.html", "<p>raw</p>")
+	writeTestFile(t, dir, "img/hero.png", "png")
+	writeTestFile(t, dir, "img/hero.0123456789ab.png", "png")
+	writeTestFile(t, dir, "sitemap.xml", "<urlset/>")
+	writeTestFile(t, dir, manifestPath, `{"files": {
+		"guide.md": {"blob_hash": "guideblob", "output_path": "guide/index.html", "page": {"templated": true}},
+		"raw.html": {"blob_hash": "rawblob", "output_path": "raw.html", "page": {"templated": false}},
+		"img/hero.png": {"blob_hash": "heroblob", "output_path": "img/hero.png", "assets": [
+			{"path": "img/hero.0123456789ab.png", "sha256": "herosum"}
+		]}
+	}}`)
+
+	tests := []struct {
+		rel       string
+		tag       string
+		immutable bool
+	}{
+		{"raw.html", `"rawblob"`, false},
+		{"img/hero.png", `"heroblob"`, false},
+		{"img/hero.0123456789ab.png", `"herosum"`, true},
+		{"guide/index.html", sumTag("<h1>Guide</h1>"), false},
+		{"sitemap.xml", sumTag("<urlset/>"), false},
+	}
+	cache := newETagCache()
+	for _, tt := range tests {
+		tag, immutable, err := cache.Tag(dir, tt.rel)
+		require.NoError(t, err, tt.rel)
+		assert.Equal(t, tt.tag, tag, tt.rel)
+		assert.Equal(t, tt.immutable, immutable, tt.rel)
+	}
+
+	_, _, err := cache.Tag(dir, "missing.html")
+	assert.Error(t, err)
+}
+
+func TestETagCache_Tag_WithoutManifest(t *testing.T) {
+	for name, manifest := range map[string]string{"missing": "", "invalid": "{"} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTestFile(t, dir, "index.html", "<h1>Home</h1>")
+			if manifest != "" {
+				writeTestFile(t, dir, manifestPath, manifest)
+			}
+			tag, immutable, err := newETagCache().Tag(dir, "index.html")
+			require.NoError(t, err)
+			assert.Equal(t, sumTag("<h1>Home</h1>"), tag)
+			assert.False(t, immutable)
+		})
+	}
+}
+
+func TestMatchesETag(t *testing.T) {
+	tests := []struct {
+		header string
+		match  bool
+	}{
+		{`"abc"`, true},
+		{`W/"abc"`, true},
+		{`"x", "abc"`, true},
+		{`"x",W/"abc"`, true},
+		{`*`, true},
+		{`"abcd"`, false},
+		{`abc`, false},
+		{``, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.match, matchesETag(tt.header, `"abc"`), tt.header)
+	}
+}
+
+func TestAcceptsEncoding(t *testing.T) {
+	tests := []struct {
+		header string
+		accept bool
+	}{
+		{"gzip, br", true},
+		{"GZIP", true},
+		{"br;q=1.0, gzip;q=0.5", true},
+		{"gzip;q=0", false},
+		{"gzip; q=0.000", false},
+		{"deflate", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.accept, acceptsEncoding(tt.header, "gzip"), tt.header)
+	}
+}
@@ -0,0 +1,198 @@
+package static
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"openbook/internal/domain"
+	"openbook/internal/repository"
+	"openbook/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// routeTTL is how long the route of a served host is cached
+	routeTTL = 30 * time.Second
+	// maxCachedRoutes bounds the served hosts whose route is cached
+	maxCachedRoutes = 1024
+	// unknownHostTTL is how long a host serving nothing is remembered
+	unknownHostTTL = 5 * time.Second
+	// maxUnknownHosts bounds the hosts serving nothing that are remembered;
+	// any client can send such hosts
+	maxUnknownHosts = 256
+)
+
+// mount is an environment served at a path prefix of a host; the prefix is
+// "" for the whole host
+type mount struct {
+	prefix        string
+	workspaceID   uuid.UUID
+	siteID        uuid.UUID
+	environmentID uuid.UUID
+}
+
+// route lists the mounts of a host, longest prefix first
+type route struct {
+	mounts []mount
+}
+
+// Resolver maps request hosts and paths to the live deployment directory
+// they serve. Active custom domains serve their site's default environment
+// at the whole host and subdirectory domains at their path, the longest
+// matching path winning; other hosts are matched against the environments'
+// URLs.
+type Resolver struct {
+	domainRepo      repository.DomainRepository
+	siteRepo        repository.SiteRepository
+	environmentRepo repository.EnvironmentRepository
+	layout          storage.Layout
+
+	routes  *lruCache[route]
+	unknown *lruCache[struct{}]
+}
+
+func NewResolver(domRepo repository.DomainRepository, sRepo repository.SiteRepository, eRepo repository.EnvironmentRepository, layout storage.Layout) *Resolver {
+	return &Resolver{
+		domainRepo:      domRepo,
+		siteRepo:        sRepo,
+		environmentRepo: eRepo,
+		layout:          layout,
+		routes:          newLRUCache[route](maxCachedRoutes),
+		unknown:         newLRUCache[struct{}](maxUnknownHosts),
+	}
+}
+
+// Resolve returns the deployment directory currently live for a request and
+// the path of the request within that site. The site path is "" when the
+// request names the mount path of a subdirectory domain without its
+// trailing slash. It fails with domain.ErrNotFound when no site is served
+// there or the environment has no published deployment yet.
+func (r *Resolver) Resolve(ctx context.Context, host, urlPath string) (string, string, error) {
+	host = normalizeHost(host)
+
+	if _, ok := r.unknown.Get(host); ok {
+		return "", "", fmt.Errorf("site for host %s %w", host, domain.ErrNotFound)
+	}
+	rt, ok := r.routes.Get(host)
+	if !ok {
+		var err error
+		if rt, err = r.lookup(ctx, host); err != nil {
+			return "", "", err
+		}
+		if len(rt.mounts) == 0 {
+			r.unknown.Add(host, struct{}{}, unknownHostTTL)
+		} else {
+			r.routes.Add(host, rt, routeTTL)
+		}
+	}
+
+	for _, m := range rt.mounts {
+		sitePath, ok := matchMount(m.prefix, urlPath)
+		if !ok {
+			continue
+		}
+		dir, err := r.layout.LiveDir(m.workspaceID, m.siteID, m.environmentID)
+		if err != nil {
+			return "", "", fmt.Errorf("live deployment %w", domain.ErrNotFound)
+		}
+		return dir, sitePath, nil
+	}
+	return "", "", fmt.Errorf("site for host %s %w", host, domain.ErrNotFound)
+}
+
+// matchMount returns the path of a request within the mount at prefix
+func matchMount(prefix, urlPath string) (string, bool) {
+	if prefix == "" {
+		return urlPath, true
+	}
+	if urlPath == prefix {
+		return "", true
+	}
+	if rest, ok := strings.CutPrefix(urlPath, prefix); ok && strings.HasPrefix(rest, "/") {
+		return rest, true
+	}
+	return "", false
+}
+
+func (r *Resolver) lookup(ctx context.Context, host string) (route, error) {
+	var rt route
+
+	domains, err := r.domainRepo.ListByHost(ctx, host)
+	if err != nil {
+		return rt, err
+	}
+	root := false
+	for i := range domains {
+		d := &domains[i]
+		if d.Status != domain.DomainActive || (d.Type != "custom" && d.Type != "subdirectory") {
+			continue
+		}
+		env, err := r.domainEnvironment(ctx, d)
+		if err != nil {
+			return rt, err
+		}
+		if env == nil {
+			continue
+		}
+		rt.mounts = append(rt.mounts, mount{
+			prefix:        d.Path(),
+			workspaceID:   env.WorkspaceID,
+			siteID:        env.SiteID,
+			environmentID: env.ID,
+		})
+		root = root || d.Path() == ""
+	}
+
+	if !root {
+		env, err := r.environmentRepo.GetByHost(ctx, host)
+		if err != nil && !errors.Is(err, domain.ErrNotFound) {
+			return rt, err
+		}
+		if err == nil {
+			rt.mounts = append(rt.mounts, mount{
+				workspaceID:   env.WorkspaceID,
+				siteID:        env.SiteID,
+				environmentID: env.ID,
+			})
+		}
+	}
+
+	sort.SliceStable(rt.mounts, func(i, j int) bool {
+		return len(rt.mounts[i].prefix) > len(rt.mounts[j].prefix)
+	})
+	return rt, nil
+}
+
+// domainEnvironment returns the default environment of the site an active
+// domain points at, or nil when the site or environment is gone
+func (r *Resolver) domainEnvironment(ctx context.Context, d *domain.Domain) (*domain.Environment, error) {
+	site, err := r.siteRepo.GetByID(ctx, d.SiteID)
+	if errors.Is(err, domain.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get site: %w", err)
+	}
+	env, err := r.environmentRepo.GetByName(ctx, site.ID, site.DefaultEnvironment)
+	if errors.Is(err, domain.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+// normalizeHost lower-cases a Host header and strips its port
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
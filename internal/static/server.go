@@ -0,0 +1,220 @@
+package static
+
+import (
+	"errors"
+	"log"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"openbook/internal/domain"
+	"openbook/internal/repository"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// notFoundPage is served with status 404 when a deployment provides it
+const notFoundPage = "404.html"
+
+// encodings are the precompressed variants written next to text outputs,
+// in order of preference
+var encodings = []struct {
+	name   string
+	suffix string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// acmeChallengePath prefixes the HTTP-01 challenges of certificate requests
+const acmeChallengePath = "/.well-known/acme-challenge/"
+
+// Server serves the live deployments of all sites, picking the site from
+// the request's Host header and, for subdirectory domains, its path. It also answers the HTTP-01 challenges of
+// pending certificate requests.
+type Server struct {
+	resolver *Resolver
+	certRepo repository.CertificateRepository
+	etags    *etagCache
+}
+
+func NewServer(resolver *Resolver, certRepo repository.CertificateRepository) *Server {
+	return &Server{resolver: resolver, certRepo: certRepo, etags: newETagCache()}
+}
+
+// Handle serves a request from the live deployment of the requested host.
+// Pretty URLs resolve /guide to guide.html or guide/index.html. The mount
+// path of a subdirectory domain redirects to itself with a trailing slash,
+// so that relative URLs in its index page resolve below it.
+func (s *Server) Handle(c *fiber.Ctx) error {
+	if c.Method() != fiber.MethodGet && c.Method() != fiber.MethodHead {
+		c.Set(fiber.HeaderAllow, "GET, HEAD")
+		return c.SendStatus(fiber.StatusMethodNotAllowed)
+	}
+
+	if token, ok := strings.CutPrefix(c.Path(), acmeChallengePath); ok {
+		return s.acmeChallenge(c, token)
+	}
+
+	dir, sitePath, err := s.resolver.Resolve(c.Context(), string(c.Request().Host()), c.Path())
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return c.Status(fiber.StatusNotFound).SendString("Site not found")
+		}
+		log.Printf("Failed to resolve host %s: %v", c.Hostname(), err)
+		return c.Status(fiber.StatusBadGateway).SendString("Site unavailable")
+	}
+
+	if sitePath == "" {
+		target := c.Path() + "/"
+		if query := c.Request().URI().QueryString(); len(query) > 0 {
+			target += "?" + string(query)
+		}
+		return c.Redirect(target, fiber.StatusMovedPermanently)
+	}
+
+	rel, ok := lookup(dir, sitePath)
+	if !ok {
+		return s.notFound(c, dir)
+	}
+	return s.sendFile(c, dir, rel, fiber.StatusOK)
+}
+
+// acmeChallenge answers an HTTP-01 challenge with its key authorization
+func (s *Server) acmeChallenge(c *fiber.Ctx, token string) error {
+	keyAuthorization, err := s.certRepo.GetChallenge(c.Context(), token)
+	if errors.Is(err, domain.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).SendString("Challenge not found")
+	}
+	if err != nil {
+		log.Printf("Failed to get ACME challenge: %v", err)
+		return c.Status(fiber.StatusBadGateway).SendString("Challenge unavailable")
+	}
+	c.Set(fiber.HeaderContentType, fiber.MIMETextPlain)
+	return c.SendString(keyAuthorization)
+}
+
+// lookup finds the file a URL path refers to, relative to the deployment dir
+func lookup(dir, urlPath string) (string, bool) {
+	clean := path.Clean("/" + urlPath)
+	for _, segment := range strings.Split(clean, "/") {
+		// Dot files, including the build manifest, are never served
+		if strings.HasPrefix(segment, ".") {
+			return "", false
+		}
+	}
+
+	var candidates []string
+	if strings.HasSuffix(urlPath, "/") || clean == "/" {
+		candidates = []string{path.Join(clean, "index.html")}
+	} else {
+		candidates = []string{clean, clean + ".html", clean + "/index.html"}
+	}
+	for _, candidate := range candidates {
+		info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(candidate)))
+		if err == nil && info.Mode().IsRegular() {
+			return strings.TrimPrefix(candidate, "/"), true
+		}
+	}
+	return "", false
+}
+
+func (s *Server) notFound(c *fiber.Ctx, dir string) error {
+	if info, err := os.Stat(filepath.Join(dir, notFoundPage)); err == nil && info.Mode().IsRegular() {
+		return s.sendFile(c, dir, notFoundPage, fiber.StatusNotFound)
+	}
+	return c.Status(fiber.StatusNotFound).SendString("Not Found")
+}
+
+// sendFile writes a deployment file, preferring a precompressed variant the
+// client accepts, and answers conditional requests with 304
+func (s *Server) sendFile(c *fiber.Ctx, dir, rel string, status int) error {
+	full := filepath.Join(dir, filepath.FromSlash(rel))
+
+	contentType := mime.TypeByExtension(path.Ext(rel))
+	if contentType == "" {
+		contentType = fiber.MIMEOctetStream
+	}
+
+	tag, immutable, err := s.etags.Tag(dir, rel)
+	if err != nil {
+		log.Printf("Failed to compute ETag of %s: %v", full, err)
+		return c.Status(fiber.StatusInternalServerError).SendString("Internal Server Error")
+	}
+
+	encoding := ""
+	for _, enc := range encodings {
+		if _, err := os.Stat(full + enc.suffix); err != nil {
+			continue
+		}
+		c.Vary(fiber.HeaderAcceptEncoding)
+		if acceptsEncoding(c.Get(fiber.HeaderAcceptEncoding), enc.name) && encoding == "" {
+			encoding = enc.name
+			full += enc.suffix
+			tag = strings.TrimSuffix(tag, `"`) + "-" + enc.name + `"`
+		}
+	}
+
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderETag, tag)
+	if immutable {
+		c.Set(fiber.HeaderCacheControl, "public, max-age=31536000, immutable")
+	} else {
+		c.Set(fiber.HeaderCacheControl, "public, max-age=0, must-revalidate")
+	}
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	if encoding != "" {
+		c.Set(fiber.HeaderContentEncoding, encoding)
+	}
+
+	if status == fiber.StatusOK && matchesETag(c.Get(fiber.HeaderIfNoneMatch), tag) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	f, err := os.Open(full)
+	if err != nil {
+		return s.notFound(c, dir)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return c.Status(fiber.StatusInternalServerError).SendString("Internal Server Error")
+	}
+
+	c.Status(status)
+	if c.Method() == fiber.MethodHead {
+		f.Close()
+		c.Set(fiber.HeaderContentLength, strconv.FormatInt(info.Size(), 10))
+		return nil
+	}
+	// The body stream closes the file once it has been sent
+	c.Response().SetBodyStream(f, int(info.Size()))
+	return nil
+}
+
+// acceptsEncoding reports whether an Accept-Encoding header allows encoding
+func acceptsEncoding(header, encoding string) bool {
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(name), encoding) {
+			continue
+		}
+		q := strings.ReplaceAll(params, " ", "")
+		return q != "q=0" && q != "q=0.0" && q != "q=0.00" && q != "q=0.000"
+	}
+	return false
+}
+
+// matchesETag reports whether an If-None-Match header matches tag
+func matchesETag(header, tag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == tag {
+			return true
+		}
+	}
+	return false
+}
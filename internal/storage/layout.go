@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"openbook/internal/domain"
+
+	"github.com/google/uuid"
+)
+
+// Layout maps deployments and environments to paths below the storage root:
+//
+//	<root>/<workspace>/<site>/.staging/<deployment>      build in progress
+//	<root>/<workspace>/<site>/deployments/<deployment>   finished build output
+//	<root>/<workspace>/<site>/environments/<env>/current symlink to the live build
+type Layout struct {
+	Root string
+}
+
+func NewLayout(root string) Layout {
+	return Layout{Root: root}
+}
+
+func (l Layout) SiteDir(workspaceID, siteID uuid.UUID) string {
+	return filepath.Join(l.Root, workspaceID.String(), siteID.String())
+}
+
+// StagingDir is where a deployment is written while it builds
+func (l Layout) StagingDir(d *domain.Deployment) string {
+	return filepath.Join(l.SiteDir(d.WorkspaceID, d.SiteID), ".staging", d.ID.String())
+}
+
+// DeploymentDir is the immutable output of a finished deployment
+func (l Layout) DeploymentDir(d *domain.Deployment) string {
+	return filepath.Join(l.SiteDir(d.WorkspaceID, d.SiteID), "deployments", d.ID.String())
+}
+
+// LiveLink is the symlink pointing at the deployment an environment serves
+func (l Layout) LiveLink(workspaceID, siteID, environmentID uuid.UUID) string {
+	return filepath.Join(l.SiteDir(workspaceID, siteID), "environments", environmentID.String(), "current")
+}
+
+// Finalize moves a completed staging directory to its deployment directory
+func (l Layout) Finalize(d *domain.Deployment) error {
+	final := l.DeploymentDir(d)
+	if err := os.MkdirAll(filepath.Dir(final), 0755); err != nil {
+		return fmt.Errorf("failed to create deployments dir: %w", err)
+	}
+	if err := os.RemoveAll(final); err != nil {
+		return fmt.Errorf("failed to clear deployment dir: %w", err)
+	}
+	if err := os.Rename(l.StagingDir(d), final); err != nil {
+		return fmt.Errorf("failed to finalize deployment: %w", err)
+	}
+	return nil
+}
+
+// Activate makes a finished deployment the live one of its environment.
+// The symlink is replaced with a rename, so readers always see either the
+// previous or the new deployment, never a partial one.
+func (l Layout) Activate(d *domain.Deployment) error {
+	target := l.DeploymentDir(d)
+	if _, err := os.Stat(target); err != nil {
+		return fmt.Errorf("deployment output is not available: %w", err)
+	}
+
+	link := l.LiveLink(d.WorkspaceID, d.SiteID, d.EnvironmentID)
+	if err := os.MkdirAll(filepath.Dir(link), 0755); err != nil {
+		return fmt.Errorf("failed to create environment dir: %w", err)
+	}
+	rel, err := filepath.Rel(filepath.Dir(link), target)
+	if err != nil {
+		return fmt.Errorf("failed to resolve deployment dir: %w", err)
+	}
+
+	tmp := link + ".tmp-" + uuid.NewString()
+	if err := os.Symlink(rel, tmp); err != nil {
+		return fmt.Errorf("failed to create live link: %w", err)
+	}
+	if err := os.Rename(tmp, link); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to swap live link: %w", err)
+	}
+	return nil
+}
+
+// LiveDir resolves the directory currently served by an environment
+func (l Layout) LiveDir(workspaceID, siteID, environmentID uuid.UUID) (string, error) {
+	link := l.LiveLink(workspaceID, siteID, environmentID)
+	target, err := os.Readlink(link)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(link), target)
+	}
+	return target, nil
+}
@@ -60,9 +60,10 @@ func TestIntegration_FullFlow(t *testing.T) {
 	auditRepo := postgres.NewAuditLogRepository(db)
 	deployRepo := postgres.NewDeploymentRepository(db)
 	gitRepo := postgres.NewGitRepository(db)
+	environmentRepo := postgres.NewEnvironmentRepository(db)
 	publisher := service.NewPublisher(rdb)
 
-	deployUC := usecase.NewDeploymentUseCase(deployRepo, auditRepo, publisher)
+	deployUC := usecase.NewDeploymentUseCase(deployRepo, environmentRepo, gitRepo, auditRepo, publisher, service.NewLogStream(rdb))
 	gitUC := usecase.NewGitUseCase(gitRepo)
 
 	// 5. Run Scenario:
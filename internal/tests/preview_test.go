@@ -0,0 +1,60 @@
+package tests
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"openbook/internal/domain"
+	"openbook/internal/repository/postgres"
+	"openbook/internal/storage"
+	"openbook/internal/usecase"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Sites of two workspaces may share a slug; their previews of a branch with
+// the same name are served at distinct hosts
+func TestIntegration_PreviewHostsOfSameSlug(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+
+	siteRepo := postgres.NewSiteRepository(db)
+	gitRepo := postgres.NewGitRepository(db)
+	environmentRepo := postgres.NewEnvironmentRepository(db)
+	siteUC := usecase.NewSiteUseCase(siteRepo, environmentRepo, postgres.NewAuditLogRepository(db))
+	gitUC := usecase.NewGitUseCase(gitRepo)
+	previewUC := usecase.NewPreviewUseCase(siteRepo, environmentRepo, postgres.NewDeploymentRepository(db), storage.NewLayout(t.TempDir()), "example.test", time.Hour)
+
+	var previews []*domain.Environment
+	for i := 0; i < 2; i++ {
+		workspaceID, ownerID := createTestWorkspace(t, db)
+		site, err := siteUC.Create(ctx, &domain.Site{WorkspaceID: workspaceID, Name: "Docs", Slug: "docs"}, ownerID)
+		require.NoError(t, err)
+		branch, err := gitUC.CreateBranch(ctx, workspaceID, site.ID, "feature", nil)
+		require.NoError(t, err)
+
+		require.NoError(t, previewUC.BranchHeadMoved(ctx, domain.BranchHeadMoved{
+			WorkspaceID: workspaceID,
+			SiteID:      site.ID,
+			BranchID:    branch.ID,
+			BranchName:  branch.Name,
+			AuthorID:    ownerID,
+			OccurredAt:  time.Now(),
+		}))
+		preview, err := environmentRepo.GetByName(ctx, site.ID, "preview/feature")
+		require.NoError(t, err)
+		previews = append(previews, preview)
+	}
+
+	assert.NotEqual(t, previews[0].URL, previews[1].URL)
+	for _, preview := range previews {
+		u, err := url.Parse(preview.URL)
+		require.NoError(t, err)
+		served, err := environmentRepo.GetByHost(ctx, u.Host)
+		require.NoError(t, err)
+		assert.Equal(t, preview.ID, served.ID, u.Host)
+	}
+}
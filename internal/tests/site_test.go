@@ -0,0 +1,166 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"openbook/internal/domain"
+	"openbook/internal/repository/postgres"
+	"openbook/internal/static"
+	"openbook/internal/storage"
+	"openbook/internal/usecase"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// openTestDB connects to the test database, skipping the test without one
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dbDSN := os.Getenv("TEST_DB_DSN")
+	if dbDSN == "" {
+		t.Skip("Skipping integration test: TEST_DB_DSN not set")
+	}
+	db, err := sql.Open("postgres", dbDSN)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	require.NoError(t, db.Ping())
+	return db
+}
+
+// createTestWorkspace inserts a user and a workspace owned by them
+func createTestWorkspace(t *testing.T, db *sql.DB) (workspaceID, ownerID uuid.UUID) {
+	t.Helper()
+	ownerID = uuid.New()
+	_, err := db.Exec(`
+		INSERT INTO users (id, email, password_hash, full_name, created_at, updated_at)
+		VALUES ($1, $2, 'hash', 'Test User', NOW(), NOW())
+	`, ownerID, ownerID.String()+"@openbook.dev")
+	require.NoError(t, err)
+
+	workspaceID = uuid.New()
+	_, err = db.Exec(`
+		INSERT INTO workspaces (id, name, slug, settings, owner_id, created_at, updated_at)
+		VALUES ($1, 'Test Workspace', $2, '{}', $3, NOW(), NOW())
+	`, workspaceID, "ws-"+workspaceID.String()[:8], ownerID)
+	require.NoError(t, err)
+	return workspaceID, ownerID
+}
+
+// A deleted site stops being served at its environments' hosts
+func TestIntegration_DeletedSiteIsNotServed(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	workspaceID, ownerID := createTestWorkspace(t, db)
+
+	siteRepo := postgres.NewSiteRepository(db)
+	environmentRepo := postgres.NewEnvironmentRepository(db)
+	domainRepo := postgres.NewDomainRepository(db)
+	siteUC := usecase.NewSiteUseCase(siteRepo, environmentRepo, postgres.NewAuditLogRepository(db))
+
+	created, err := siteUC.Create(ctx, &domain.Site{WorkspaceID: workspaceID, Name: "Deleted Site"}, ownerID)
+	require.NoError(t, err)
+	host := "deleted-" + created.ID.String()[:8] + ".example.test"
+	_, err = db.Exec(`UPDATE environments SET url = $1 WHERE id = $2`, "https://"+host, created.Environment.ID)
+	require.NoError(t, err)
+
+	// Publish a deployment of the environment
+	layout := storage.NewLayout(t.TempDir())
+	deployment := &domain.Deployment{
+		ID:            uuid.New(),
+		WorkspaceID:   workspaceID,
+		SiteID:        created.ID,
+		EnvironmentID: created.Environment.ID,
+	}
+	require.NoError(t, os.MkdirAll(layout.StagingDir(deployment), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(layout.StagingDir(deployment), "index.html"), []byte("<h1>Hello</h1>"), 0644))
+	require.NoError(t, layout.Finalize(deployment))
+	require.NoError(t, layout.Activate(deployment))
+
+	get := func() int {
+		// A new server per request, so that no cached route is used
+		server := static.NewServer(static.NewResolver(domainRepo, siteRepo, environmentRepo, layout), postgres.NewCertificateRepository(db))
+		app := fiber.New()
+		app.Use(server.Handle)
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Host = host
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, fiber.StatusOK, get())
+
+	require.NoError(t, siteUC.Delete(ctx, workspaceID, created.ID, ownerID))
+	assert.Equal(t, fiber.StatusNotFound, get())
+
+	envs, err := environmentRepo.ListByBranch(ctx, created.Branch.ID)
+	require.NoError(t, err)
+	assert.Empty(t, envs, "environments of a deleted site are not auto-deployed")
+}
+
+// A site whose initial records cannot all be stored leaves none of them
+func TestIntegration_SiteCreationIsAtomic(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	workspaceID, _ := createTestWorkspace(t, db)
+
+	siteUC := usecase.NewSiteUseCase(postgres.NewSiteRepository(db), postgres.NewEnvironmentRepository(db), postgres.NewAuditLogRepository(db))
+
+	// The initial commit needs an existing author, so it fails after the site was inserted
+	_, err := siteUC.Create(ctx, &domain.Site{WorkspaceID: workspaceID, Name: "Atomic"}, uuid.New())
+	require.Error(t, err)
+
+	var sites, commits int
+	require.NoError(t, db.QueryRow(`SELECT count(*) FROM sites WHERE workspace_id = $1`, workspaceID).Scan(&sites))
+	require.NoError(t, db.QueryRow(`SELECT count(*) FROM commits WHERE workspace_id = $1`, workspaceID).Scan(&commits))
+	assert.Zero(t, sites)
+	assert.Zero(t, commits)
+}
+
+// Deleting a site releases its domain names
+func TestIntegration_DeletedSiteReleasesDomains(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	workspaceID, ownerID := createTestWorkspace(t, db)
+
+	siteRepo := postgres.NewSiteRepository(db)
+	domainRepo := postgres.NewDomainRepository(db)
+	siteUC := usecase.NewSiteUseCase(siteRepo, postgres.NewEnvironmentRepository(db), postgres.NewAuditLogRepository(db))
+
+	name := "released-" + uuid.NewString()[:8] + ".example.test"
+	activeDomain := func(siteID uuid.UUID) *domain.Domain {
+		return &domain.Domain{
+			ID:          uuid.New(),
+			WorkspaceID: workspaceID,
+			SiteID:      siteID,
+			Domain:      name,
+			Type:        "custom",
+			Status:      domain.DomainActive,
+			DNSVerified: true,
+			SSLStatus:   "none",
+			CreatedAt:   time.Now(),
+		}
+	}
+
+	first, err := siteUC.Create(ctx, &domain.Site{WorkspaceID: workspaceID, Name: "First"}, ownerID)
+	require.NoError(t, err)
+	require.NoError(t, domainRepo.Create(ctx, activeDomain(first.ID)))
+
+	require.NoError(t, siteUC.Delete(ctx, workspaceID, first.ID, ownerID))
+	domains, err := domainRepo.ListBySite(ctx, first.ID)
+	require.NoError(t, err)
+	assert.Empty(t, domains)
+
+	second, err := siteUC.Create(ctx, &domain.Site{WorkspaceID: workspaceID, Name: "Second"}, ownerID)
+	require.NoError(t, err)
+	assert.NoError(t, domainRepo.Create(ctx, activeDomain(second.ID)), "the name is free again")
+}
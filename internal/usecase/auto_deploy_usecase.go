@@ -0,0 +1,151 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"openbook/internal/domain"
+	"openbook/internal/repository"
+	"openbook/internal/service"
+
+	"github.com/google/uuid"
+)
+
+// autoDeployPollInterval is how often environments whose debounce window
+// ended are deployed
+const autoDeployPollInterval = time.Second
+
+// AutoDeployUseCase deploys the environments tracking a branch whenever its
+// head moves. Deployments are debounced per environment: each head move
+// restarts the window, and the head current at its end is deployed.
+type AutoDeployUseCase struct {
+	environmentRepo repository.EnvironmentRepository
+	deploymentRepo  repository.DeploymentRepository
+	gitRepo         repository.GitRepository
+	deployments     *DeploymentUseCase
+	publisher       *service.Publisher
+	debounce        time.Duration
+}
+
+func NewAutoDeployUseCase(
+	environmentRepo repository.EnvironmentRepository,
+	deploymentRepo repository.DeploymentRepository,
+	gitRepo repository.GitRepository,
+	deployments *DeploymentUseCase,
+	publisher *service.Publisher,
+	debounce time.Duration,
+) *AutoDeployUseCase {
+	return &AutoDeployUseCase{
+		environmentRepo: environmentRepo,
+		deploymentRepo:  deploymentRepo,
+		gitRepo:         gitRepo,
+		deployments:     deployments,
+		publisher:       publisher,
+		debounce:        debounce,
+	}
+}
+
+// BranchHeadMoved schedules a deployment of every active environment
+// tracking the branch
+func (uc *AutoDeployUseCase) BranchHeadMoved(ctx context.Context, event domain.BranchHeadMoved) error {
+	envs, err := uc.environmentRepo.ListByBranch(ctx, event.BranchID)
+	if err != nil {
+		return err
+	}
+	at := event.OccurredAt.Add(uc.debounce)
+	for _, env := range envs {
+		if err := uc.publisher.ScheduleAutoDeploy(ctx, env.ID, at); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BranchDeleted needs no handling: environments of a deleted branch no
+// longer track it and are skipped once their window ends
+func (uc *AutoDeployUseCase) BranchDeleted(ctx context.Context, event domain.BranchDeleted) error {
+	return nil
+}
+
+// Run deploys environments as their debounce windows end, until ctx is done
+func (uc *AutoDeployUseCase) Run(ctx context.Context) {
+	ticker := time.NewTicker(autoDeployPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		envIDs, err := uc.publisher.ClaimDueAutoDeploys(ctx, time.Now())
+		if err != nil {
+			log.Printf("Failed to claim auto deploys: %v", err)
+			continue
+		}
+		for _, envID := range envIDs {
+			if err := uc.deployHead(ctx, envID); err != nil {
+				log.Printf("Failed to auto deploy environment %s: %v", envID, err)
+				// Try again after another window rather than losing the change
+				if err := uc.publisher.ScheduleAutoDeploy(ctx, envID, time.Now().Add(uc.debounce)); err != nil {
+					log.Printf("Failed to reschedule auto deploy of environment %s: %v", envID, err)
+				}
+			}
+		}
+	}
+}
+
+// deployHead deploys the current head of the branch an environment tracks,
+// unless that commit is already deployed or on its way
+func (uc *AutoDeployUseCase) deployHead(ctx context.Context, envID uuid.UUID) error {
+	env, err := uc.environmentRepo.GetByID(ctx, envID)
+	if errors.Is(err, domain.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !env.IsActive || env.BranchID == uuid.Nil {
+		return nil
+	}
+
+	branch, err := uc.gitRepo.GetBranchByID(ctx, env.BranchID)
+	if errors.Is(err, domain.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if branch.HeadCommitID == nil {
+		return nil
+	}
+	head, err := uc.gitRepo.GetCommit(ctx, *branch.HeadCommitID)
+	if err != nil {
+		return fmt.Errorf("failed to get head commit: %w", err)
+	}
+
+	latest, err := uc.deploymentRepo.List(ctx, domain.DeploymentFilter{
+		WorkspaceID:   env.WorkspaceID,
+		EnvironmentID: &env.ID,
+		Limit:         1,
+	})
+	if err != nil {
+		return err
+	}
+	if len(latest) == 1 && latest[0].CommitHash == head.ID.String() &&
+		latest[0].Status != "failed" && latest[0].Status != "cancelled" {
+		return nil
+	}
+
+	return uc.deployments.Create(ctx, &domain.Deployment{
+		WorkspaceID:   env.WorkspaceID,
+		SiteID:        env.SiteID,
+		EnvironmentID: env.ID,
+		CommitHash:    head.ID.String(),
+		TriggeredBy:   head.AuthorID,
+	})
+}
@@ -0,0 +1,215 @@
+package usecase
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"openbook/internal/domain"
+	"openbook/internal/repository"
+	"openbook/internal/service"
+)
+
+const (
+	// certificateRenewBefore is how long before expiry a certificate is renewed
+	certificateRenewBefore = 30 * 24 * time.Hour
+	// certificateRetryInterval is how long a failed request waits before the
+	// next attempt; a request still provisioning after it is considered stuck
+	certificateRetryInterval = time.Hour
+	// certificateTimeout bounds a single certificate request
+	certificateTimeout = 5 * time.Minute
+	// certificateBatchSize bounds the domains handled by one pass
+	certificateBatchSize = 20
+	// challengeTTL is how long an HTTP-01 challenge is answered
+	challengeTTL = 10 * time.Minute
+)
+
+// CertificateUseCase obtains and renews the TLS certificates of verified
+// custom domains through ACME. Certificates and the account key are stored
+// encrypted; HTTP-01 challenges are stored for the site server to answer.
+type CertificateUseCase struct {
+	domainRepo repository.DomainRepository
+	certRepo   repository.CertificateRepository
+	acme       *service.ACME
+	cipher     *service.Cipher
+
+	keyMu      sync.Mutex
+	accountKey crypto.Signer
+}
+
+func NewCertificateUseCase(
+	domainRepo repository.DomainRepository,
+	certRepo repository.CertificateRepository,
+	acme *service.ACME,
+	cipher *service.Cipher,
+) *CertificateUseCase {
+	return &CertificateUseCase{
+		domainRepo: domainRepo,
+		certRepo:   certRepo,
+		acme:       acme,
+		cipher:     cipher,
+	}
+}
+
+// ProvisionDue requests certificates for the active domains without one,
+// retries failed requests every hour and renews certificates 30 days before
+// they expire. It returns how many certificates were issued.
+func (uc *CertificateUseCase) ProvisionDue(ctx context.Context) (int, error) {
+	now := time.Now()
+	domains, err := uc.domainRepo.ListForCertificates(ctx, now.Add(certificateRenewBefore), now.Add(-certificateRetryInterval), certificateBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	issued := 0
+	for i := range domains {
+		if ctx.Err() != nil {
+			break
+		}
+		d := &domains[i]
+		claimed, err := uc.domainRepo.ClaimCertificate(ctx, d.ID, time.Now().Add(-certificateRetryInterval))
+		if err != nil {
+			return issued, err
+		}
+		if !claimed {
+			continue
+		}
+		ok, err := uc.provision(ctx, d)
+		if err != nil {
+			log.Printf("Failed to save certificate state of %s: %v", d.Domain, err)
+			continue
+		}
+		if ok {
+			issued++
+		}
+	}
+	return issued, nil
+}
+
+// provision requests a certificate for a claimed domain and saves the
+// outcome. A failed renewal keeps the domain active while its current
+// certificate is valid.
+func (uc *CertificateUseCase) provision(ctx context.Context, d *domain.Domain) (bool, error) {
+	cert, err := uc.issue(ctx, d)
+	now := time.Now()
+	d.SSLCheckedAt = &now
+	if err != nil {
+		log.Printf("Failed to obtain a certificate for %s: %v", d.Domain, err)
+		d.SSLError = err.Error()
+		d.SSLStatus = domain.SSLError
+		if d.SSLExpiresAt != nil && d.SSLExpiresAt.After(now) {
+			d.SSLStatus = domain.SSLActive
+		}
+		return false, uc.domainRepo.UpdateCertificate(ctx, d)
+	}
+
+	d.SSLStatus = domain.SSLActive
+	d.SSLError = ""
+	d.SSLExpiresAt = &cert.ExpiresAt
+	if err := uc.domainRepo.UpdateCertificate(ctx, d); err != nil {
+		return false, err
+	}
+	log.Printf("Obtained a certificate for %s, valid until %s", d.Domain, cert.ExpiresAt.Format(time.RFC3339))
+	return true, nil
+}
+
+// issue obtains and stores a certificate for the host of a domain. Domains
+// sharing a host, like subdirectory domains, reuse a certificate of the host
+// that is not due for renewal.
+func (uc *CertificateUseCase) issue(ctx context.Context, d *domain.Domain) (*domain.Certificate, error) {
+	ctx, cancel := context.WithTimeout(ctx, certificateTimeout)
+	defer cancel()
+
+	shared, err := uc.certRepo.GetByHost(ctx, d.Host())
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		return nil, err
+	}
+	if err == nil && shared.DomainID != d.ID && shared.ExpiresAt.After(time.Now().Add(certificateRenewBefore)) {
+		cert := &domain.Certificate{
+			DomainID:  d.ID,
+			Data:      shared.Data,
+			ExpiresAt: shared.ExpiresAt,
+			UpdatedAt: time.Now(),
+		}
+		if err := uc.certRepo.Save(ctx, cert); err != nil {
+			return nil, err
+		}
+		return cert, nil
+	}
+
+	key, err := uc.key(ctx)
+	if err != nil {
+		return nil, err
+	}
+	issued, err := uc.acme.Issue(ctx, key, d.Host(), uc)
+	if err != nil {
+		return nil, err
+	}
+	data, err := uc.cipher.Seal(issued.PEM)
+	if err != nil {
+		return nil, err
+	}
+	cert := &domain.Certificate{
+		DomainID:  d.ID,
+		Data:      data,
+		ExpiresAt: issued.NotAfter,
+		UpdatedAt: time.Now(),
+	}
+	if err := uc.certRepo.Save(ctx, cert); err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+// key returns the account key of the ACME directory, creating it on first
+// use. Concurrent workers settle on the key stored first.
+func (uc *CertificateUseCase) key(ctx context.Context) (crypto.Signer, error) {
+	uc.keyMu.Lock()
+	defer uc.keyMu.Unlock()
+	if uc.accountKey != nil {
+		return uc.accountKey, nil
+	}
+
+	data, err := uc.certRepo.GetAccountKey(ctx, uc.acme.DirectoryURL())
+	if errors.Is(err, domain.ErrNotFound) {
+		key, err := service.NewAccountKey()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate ACME account key: %w", err)
+		}
+		sealed, err := uc.cipher.Seal(key)
+		if err != nil {
+			return nil, err
+		}
+		if err := uc.certRepo.CreateAccountKey(ctx, uc.acme.DirectoryURL(), sealed); err != nil {
+			return nil, err
+		}
+		data, err = uc.certRepo.GetAccountKey(ctx, uc.acme.DirectoryURL())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	plain, err := uc.cipher.Open(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt ACME account key: %w", err)
+	}
+	key, err := service.ParseAccountKey(plain)
+	if err != nil {
+		return nil, err
+	}
+	uc.accountKey = key
+	return key, nil
+}
+
+// Present stores an HTTP-01 challenge for the site server to answer
+func (uc *CertificateUseCase) Present(ctx context.Context, token, keyAuthorization string) error {
+	return uc.certRepo.SaveChallenge(ctx, token, keyAuthorization, time.Now().Add(challengeTTL))
+}
+
+func (uc *CertificateUseCase) CleanUp(ctx context.Context, token string) error {
+	return uc.certRepo.DeleteChallenge(ctx, token)
+}
@@ -2,10 +2,17 @@ package usecase
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"strings"
 	"time"
 
+	"openbook/internal/artifact"
+	"openbook/internal/changelog"
 	"openbook/internal/domain"
 	"openbook/internal/repository"
 	"openbook/internal/service"
@@ -14,34 +21,74 @@ import (
 )
 
 type DeploymentUseCase struct {
-	repo      repository.DeploymentRepository
-	auditRepo repository.AuditLogRepository
-	publisher *service.Publisher
+	repo            repository.DeploymentRepository
+	environmentRepo repository.EnvironmentRepository
+	gitRepo         repository.GitRepository
+	auditRepo       repository.AuditLogRepository
+	publisher       *service.Publisher
+	logStream       *service.LogStream
 }
 
-func NewDeploymentUseCase(repo repository.DeploymentRepository, auditRepo repository.AuditLogRepository, publisher *service.Publisher) *DeploymentUseCase {
+func NewDeploymentUseCase(repo repository.DeploymentRepository, environmentRepo repository.EnvironmentRepository, gitRepo repository.GitRepository, auditRepo repository.AuditLogRepository, publisher *service.Publisher, logStream *service.LogStream) *DeploymentUseCase {
 	return &DeploymentUseCase{
-		repo:      repo,
-		auditRepo: auditRepo,
-		publisher: publisher,
+		repo:            repo,
+		environmentRepo: environmentRepo,
+		gitRepo:         gitRepo,
+		auditRepo:       auditRepo,
+		publisher:       publisher,
+		logStream:       logStream,
 	}
 }
 
+// Create queues a deployment, or schedules it when ScheduledAt is set. A
+// scheduled deployment stays scheduled until the worker scheduler queues it
+// at that time.
 func (uc *DeploymentUseCase) Create(ctx context.Context, d *domain.Deployment) error {
 	d.ID = uuid.New()
 	d.Status = "pending"
 	d.CreatedAt = time.Now()
+	if d.ScheduledAt != nil {
+		if !d.ScheduledAt.After(d.CreatedAt) {
+			return fmt.Errorf("%w: scheduled_at must be in the future", domain.ErrInvalidInput)
+		}
+		d.Status = "scheduled"
+	}
+
+	// The environment and the commit must belong to the deployment's site;
+	// the worker builds and publishes whatever the deployment names
+	env, err := uc.environmentRepo.GetByID(ctx, d.EnvironmentID)
+	if err != nil {
+		return err
+	}
+	if err := d.ValidateEnvironment(env); err != nil {
+		return err
+	}
+	commitID, err := uuid.Parse(d.CommitHash)
+	if err != nil {
+		return fmt.Errorf("%w: invalid commit hash", domain.ErrInvalidInput)
+	}
+	commit, err := uc.gitRepo.GetCommit(ctx, commitID)
+	if err != nil {
+		return err
+	}
+	if err := d.ValidateCommit(commit); err != nil {
+		return err
+	}
 
 	if err := uc.repo.Create(ctx, d); err != nil {
 		return fmt.Errorf("failed to create deployment: %w", err)
 	}
 
 	// Audit Log
-	metadata, _ := json.Marshal(map[string]interface{}{
+	fields := map[string]interface{}{
 		"site_id":        d.SiteID,
 		"environment_id": d.EnvironmentID,
 		"commit_hash":    d.CommitHash,
-	})
+	}
+	if d.ScheduledAt != nil {
+		fields["scheduled_at"] = d.ScheduledAt
+	}
+	metadata, _ := json.Marshal(fields)
 
 	audit := &domain.AuditLog{
 		ID:           uuid.New(),
@@ -56,6 +103,9 @@ func (uc *DeploymentUseCase) Create(ctx context.Context, d *domain.Deployment) e
 		fmt.Printf("failed to create audit log: %v\n", err)
 	}
 
+	if d.Status == "scheduled" {
+		return uc.publisher.ScheduleDeployment(ctx, d.ID, *d.ScheduledAt)
+	}
 	if err := uc.publisher.PublishDeployment(ctx, d.ID); err != nil {
 		return fmt.Errorf("failed to publish deployment event: %w", err)
 	}
@@ -63,6 +113,401 @@ func (uc *DeploymentUseCase) Create(ctx context.Context, d *domain.Deployment) e
 	return nil
 }
 
-func (uc *DeploymentUseCase) GetByID(ctx context.Context, id uuid.UUID) (*domain.Deployment, error) {
-	return uc.repo.GetByID(ctx, id)
+// GetByID returns a deployment of the workspace
+func (uc *DeploymentUseCase) GetByID(ctx context.Context, workspaceID, id uuid.UUID) (*domain.Deployment, error) {
+	d, err := uc.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if d.WorkspaceID != workspaceID {
+		return nil, fmt.Errorf("deployment %w", domain.ErrNotFound)
+	}
+	return d, nil
+}
+
+// Deployment listing page sizes
+const (
+	defaultDeploymentPageSize = 20
+	maxDeploymentPageSize     = 100
+)
+
+// DeploymentPage is one page of a deployment listing
+type DeploymentPage struct {
+	Deployments []*domain.Deployment `json:"deployments"`
+	// NextCursor continues the listing; it is empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// List returns a page of the workspace's deployments. cursor is the
+// NextCursor of the previous page, or empty for the first one.
+func (uc *DeploymentUseCase) List(ctx context.Context, filter domain.DeploymentFilter, cursor string) (*DeploymentPage, error) {
+	if filter.Limit == 0 {
+		filter.Limit = defaultDeploymentPageSize
+	}
+	if filter.Limit < 1 || filter.Limit > maxDeploymentPageSize {
+		return nil, fmt.Errorf("%w: limit must be between 1 and %d", domain.ErrInvalidInput, maxDeploymentPageSize)
+	}
+	if filter.Status != "" && !domain.IsValidDeploymentStatus(filter.Status) {
+		return nil, fmt.Errorf("%w: unknown status %q", domain.ErrInvalidInput, filter.Status)
+	}
+	if cursor != "" {
+		after, err := decodeDeploymentCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		filter.After = after
+	}
+
+	// One extra row tells whether another page follows
+	pageSize := filter.Limit
+	filter.Limit++
+	deployments, err := uc.repo.List(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &DeploymentPage{Deployments: deployments}
+	if len(deployments) > pageSize {
+		page.Deployments = deployments[:pageSize]
+		last := page.Deployments[pageSize-1]
+		page.NextCursor = encodeDeploymentCursor(domain.DeploymentCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+	return page, nil
+}
+
+func encodeDeploymentCursor(c domain.DeploymentCursor) string {
+	raw := c.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + c.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeDeploymentCursor(s string) (*domain.DeploymentCursor, error) {
+	invalid := fmt.Errorf("%w: invalid cursor", domain.ErrInvalidInput)
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, invalid
+	}
+	createdAt, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return nil, invalid
+	}
+	c := &domain.DeploymentCursor{}
+	if c.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+		return nil, invalid
+	}
+	if c.ID, err = uuid.Parse(id); err != nil {
+		return nil, invalid
+	}
+	return c, nil
+}
+
+// Cancel stops a deployment. A scheduled or pending deployment is marked
+// cancelled right away and skipped by the worker; a building one is signalled
+// and marked cancelled by its worker once the build has stopped.
+func (uc *DeploymentUseCase) Cancel(ctx context.Context, workspaceID, id, userID uuid.UUID) (*domain.Deployment, error) {
+	d, err := uc.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if d.WorkspaceID != workspaceID {
+		return nil, fmt.Errorf("deployment %w", domain.ErrNotFound)
+	}
+
+	if d.IsFinished() {
+		return nil, fmt.Errorf("%w: deployment is already %s", domain.ErrConflict, d.Status)
+	}
+
+	// A scheduled deployment may be queued, and a pending one picked up, while
+	// it is being cancelled
+	for d.Status == "scheduled" || d.Status == "pending" {
+		scheduled := d.Status == "scheduled"
+		err := uc.repo.UpdateStatus(ctx, d.ID, "cancelled")
+		if err == nil {
+			d.Status = "cancelled"
+			if scheduled {
+				// Once queued, the worker skips the cancelled deployment anyway
+				if err := uc.publisher.UnscheduleDeployment(ctx, d.ID); err != nil {
+					fmt.Printf("failed to unschedule deployment: %v\n", err)
+				}
+			}
+			if err := uc.logStream.Publish(ctx, d.ID, service.LogEvent{Status: "cancelled"}); err != nil {
+				fmt.Printf("failed to publish log status: %v\n", err)
+			}
+			break
+		}
+		if !errors.Is(err, domain.ErrConflict) {
+			return nil, err
+		}
+		if d, err = uc.repo.GetByID(ctx, id); err != nil {
+			return nil, err
+		}
+		if d.IsFinished() {
+			return nil, fmt.Errorf("%w: deployment is already %s", domain.ErrConflict, d.Status)
+		}
+	}
+
+	// A worker may have picked the deployment up in the meantime, so the
+	// signal is sent in both cases
+	if err := uc.publisher.PublishCancel(ctx, d.ID); err != nil {
+		return nil, err
+	}
+
+	metadata, _ := json.Marshal(map[string]interface{}{
+		"site_id":        d.SiteID,
+		"environment_id": d.EnvironmentID,
+		"status":         d.Status,
+	})
+	audit := &domain.AuditLog{
+		ID:           uuid.New(),
+		WorkspaceID:  d.WorkspaceID,
+		UserID:       userID,
+		Action:       "deployment.cancel",
+		MetadataJSON: metadata,
+		CreatedAt:    time.Now(),
+	}
+	if err := uc.auditRepo.Create(ctx, audit); err != nil {
+		fmt.Printf("failed to create audit log: %v\n", err)
+	}
+
+	return d, nil
+}
+
+// Promote queues a deployment that publishes the output of a successful
+// deployment to another environment of the same site. The worker reuses the
+// source output and only rewrites environment-specific URLs.
+func (uc *DeploymentUseCase) Promote(ctx context.Context, workspaceID, id, environmentID, userID uuid.UUID) (*domain.Deployment, error) {
+	source, err := uc.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if source.WorkspaceID != workspaceID {
+		return nil, fmt.Errorf("deployment %w", domain.ErrNotFound)
+	}
+	if source.Status != "success" {
+		return nil, fmt.Errorf("%w: deployment %s is %s", domain.ErrConflict, source.ID, source.Status)
+	}
+
+	env, err := uc.environmentRepo.GetByID(ctx, environmentID)
+	if err != nil {
+		return nil, err
+	}
+	if env.WorkspaceID != workspaceID {
+		return nil, fmt.Errorf("environment %w", domain.ErrNotFound)
+	}
+	if env.SiteID != source.SiteID {
+		return nil, fmt.Errorf("%w: environment %s belongs to another site", domain.ErrInvalidInput, env.ID)
+	}
+	if env.ID == source.EnvironmentID {
+		return nil, fmt.Errorf("%w: deployment %s already belongs to environment %s", domain.ErrInvalidInput, source.ID, env.ID)
+	}
+	if !env.IsActive {
+		return nil, fmt.Errorf("%w: environment %s is not active", domain.ErrConflict, env.ID)
+	}
+
+	d := &domain.Deployment{
+		ID:                 uuid.New(),
+		WorkspaceID:        workspaceID,
+		SiteID:             source.SiteID,
+		EnvironmentID:      env.ID,
+		Status:             "pending",
+		CommitHash:         source.CommitHash,
+		TriggeredBy:        userID,
+		CreatedAt:          time.Now(),
+		SourceDeploymentID: &source.ID,
+	}
+	if err := uc.repo.Create(ctx, d); err != nil {
+		return nil, fmt.Errorf("failed to create deployment: %w", err)
+	}
+
+	metadata, _ := json.Marshal(map[string]interface{}{
+		"site_id":               d.SiteID,
+		"environment_id":        d.EnvironmentID,
+		"commit_hash":           d.CommitHash,
+		"source_deployment_id":  source.ID,
+		"source_environment_id": source.EnvironmentID,
+	})
+	audit := &domain.AuditLog{
+		ID:           uuid.New(),
+		WorkspaceID:  workspaceID,
+		UserID:       userID,
+		Action:       "deployment.promote",
+		MetadataJSON: metadata,
+		CreatedAt:    time.Now(),
+	}
+	// Log error but don't fail the operation
+	if err := uc.auditRepo.Create(ctx, audit); err != nil {
+		fmt.Printf("failed to create audit log: %v\n", err)
+	}
+
+	if err := uc.publisher.PublishDeployment(ctx, d.ID); err != nil {
+		return nil, fmt.Errorf("failed to publish deployment event: %w", err)
+	}
+	return d, nil
+}
+
+// DeploymentArtifact is a downloadable archive or export of a deployment's output
+type DeploymentArtifact struct {
+	Filename    string
+	ContentType string
+	// SHA256 is the checksum of archives prebuilt by the worker, empty for
+	// archives packaged on request
+	SHA256 string
+	Write  func(w io.Writer) error
+}
+
+// Artifact packages the output of a successful deployment. Archives the
+// worker prebuilt are served as stored; other formats are packaged on the
+// fly, producing the same bytes. EPUB and PDF exports are only prebuilt.
+func (uc *DeploymentUseCase) Artifact(ctx context.Context, workspaceID, id uuid.UUID, format string) (*DeploymentArtifact, error) {
+	if err := artifact.ValidateFormat(format); err != nil {
+		return nil, err
+	}
+
+	d, err := uc.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if d.WorkspaceID != workspaceID {
+		return nil, fmt.Errorf("deployment %w", domain.ErrNotFound)
+	}
+	if d.Status != "success" {
+		return nil, fmt.Errorf("%w: deployment %s is %s", domain.ErrConflict, d.ID, d.Status)
+	}
+	if err := uc.checkCommit(ctx, d); err != nil {
+		return nil, err
+	}
+	dir := d.StoragePath
+	if info, err := os.Stat(dir); dir == "" || err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("deployment output %w", domain.ErrNotFound)
+	}
+
+	a := &DeploymentArtifact{
+		Filename:    "deployment-" + d.ID.String() + "." + format,
+		ContentType: artifact.ContentType(format),
+	}
+	if sum, err := artifact.Checksum(dir, format); err == nil {
+		a.SHA256 = sum
+		a.Write = func(w io.Writer) error {
+			f, err := os.Open(artifact.Path(dir, format))
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			_, err = io.Copy(w, f)
+			return err
+		}
+		return a, nil
+	}
+	if artifact.IsExport(format) {
+		return nil, fmt.Errorf("%s export of deployment %s %w", format, d.ID, domain.ErrNotFound)
+	}
+
+	manifest, err := artifact.Collect(dir)
+	if err != nil {
+		return nil, err
+	}
+	a.Write = func(w io.Writer) error {
+		return artifact.Write(w, format, dir, manifest)
+	}
+	return a, nil
+}
+
+// DeploymentChangelog lists what changed between two deployments of an
+// environment
+type DeploymentChangelog struct {
+	From uuid.UUID `json:"from"`
+	To   uuid.UUID `json:"to"`
+	*changelog.Changelog
+}
+
+// Changelog compares two successful deployments of the same environment:
+// the pages added, removed and modified from the output of fromID to the
+// output of id, and the commits in between.
+func (uc *DeploymentUseCase) Changelog(ctx context.Context, workspaceID, id, fromID uuid.UUID) (*DeploymentChangelog, error) {
+	to, err := uc.changelogDeployment(ctx, workspaceID, id)
+	if err != nil {
+		return nil, err
+	}
+	from, err := uc.changelogDeployment(ctx, workspaceID, fromID)
+	if err != nil {
+		return nil, err
+	}
+	if from.EnvironmentID != to.EnvironmentID {
+		return nil, fmt.Errorf("%w: deployments %s and %s belong to different environments", domain.ErrInvalidInput, from.ID, to.ID)
+	}
+
+	fromBuild, err := changelog.ReadBuild(from.StoragePath)
+	if err != nil {
+		return nil, fmt.Errorf("build manifest of deployment %s %w", from.ID, domain.ErrNotFound)
+	}
+	toBuild, err := changelog.ReadBuild(to.StoragePath)
+	if err != nil {
+		return nil, fmt.Errorf("build manifest of deployment %s %w", to.ID, domain.ErrNotFound)
+	}
+	c := changelog.ComparePages(fromBuild, toBuild)
+
+	fromCommit, err := uuid.Parse(from.CommitHash)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid commit hash of deployment %s", domain.ErrInvalidInput, from.ID)
+	}
+	toCommit, err := uuid.Parse(to.CommitHash)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid commit hash of deployment %s", domain.ErrInvalidInput, to.ID)
+	}
+	if c.Commits, c.Truncated, err = changelog.Commits(ctx, uc.gitRepo, fromCommit, toCommit); err != nil {
+		return nil, err
+	}
+	return &DeploymentChangelog{From: from.ID, To: to.ID, Changelog: c}, nil
+}
+
+// changelogDeployment returns a successful deployment of the workspace
+func (uc *DeploymentUseCase) changelogDeployment(ctx context.Context, workspaceID, id uuid.UUID) (*domain.Deployment, error) {
+	d, err := uc.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if d.WorkspaceID != workspaceID {
+		return nil, fmt.Errorf("deployment %w", domain.ErrNotFound)
+	}
+	if d.Status != "success" {
+		return nil, fmt.Errorf("%w: deployment %s is %s", domain.ErrConflict, d.ID, d.Status)
+	}
+	if err := uc.checkCommit(ctx, d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// checkCommit reports whether the deployment built a commit of its own site.
+// Deployments created before commits were checked on creation may name
+// another workspace's commit; their output is not handed out.
+func (uc *DeploymentUseCase) checkCommit(ctx context.Context, d *domain.Deployment) error {
+	commitID, err := uuid.Parse(d.CommitHash)
+	if err != nil {
+		return fmt.Errorf("%w: invalid commit hash of deployment %s", domain.ErrInvalidInput, d.ID)
+	}
+	commit, err := uc.gitRepo.GetCommit(ctx, commitID)
+	if err != nil {
+		return err
+	}
+	return d.ValidateCommit(commit)
+}
+
+// StreamLogs returns a deployment together with its live log events.
+// The subscription is opened before the deployment is read, so every line
+// missing from the returned Logs arrives on the channel. The channel is
+// closed when ctx is done.
+func (uc *DeploymentUseCase) StreamLogs(ctx context.Context, workspaceID, id uuid.UUID) (*domain.Deployment, <-chan service.LogEvent, error) {
+	events, err := uc.logStream.Subscribe(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	d, err := uc.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if d.WorkspaceID != workspaceID {
+		return nil, nil, fmt.Errorf("deployment %w", domain.ErrNotFound)
+	}
+	return d, events, nil
 }
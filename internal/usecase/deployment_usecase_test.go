@@ -0,0 +1,52 @@
+package usecase
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"openbook/internal/domain"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeploymentCursor_RoundTrip(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+
+	tests := []domain.DeploymentCursor{
+		{CreatedAt: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC), ID: uuid.New()},
+		{CreatedAt: time.Date(2026, 3, 1, 12, 0, 0, 123456789, time.UTC), ID: uuid.New()},
+		{CreatedAt: time.Date(2026, 3, 1, 13, 0, 0, 1000, paris), ID: uuid.New()},
+		{CreatedAt: time.Time{}, ID: uuid.Nil},
+	}
+	for _, c := range tests {
+		encoded := encodeDeploymentCursor(c)
+		assert.NotContains(t, encoded, "=", "cursors are unpadded")
+		decoded, err := decodeDeploymentCursor(encoded)
+		require.NoError(t, err, encoded)
+		assert.True(t, c.CreatedAt.Equal(decoded.CreatedAt), "%s != %s", c.CreatedAt, decoded.CreatedAt)
+		assert.Equal(t, c.ID, decoded.ID)
+	}
+}
+
+func TestDecodeDeploymentCursor_Invalid(t *testing.T) {
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	tests := []string{
+		"",
+		"not base64!",
+		encode("2026-03-01T12:00:00Z"),
+		encode("2026-03-01T12:00:00Z|"),
+		encode("2026-03-01T12:00:00Z|not-a-uuid"),
+		encode("yesterday|" + uuid.NewString()),
+		encode("|" + uuid.NewString()),
+		encode("2026-03-01T12:00:00Z|"+uuid.NewString()) + "==",
+	}
+	for _, s := range tests {
+		_, err := decodeDeploymentCursor(s)
+		assert.True(t, errors.Is(err, domain.ErrInvalidInput), "%q: %v", s, err)
+	}
+}
@@ -0,0 +1,359 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"openbook/internal/domain"
+	"openbook/internal/repository"
+	"openbook/internal/service"
+
+	"github.com/google/uuid"
+)
+
+// ChallengePrefix names the TXT record proving ownership of a domain:
+// _openbook-challenge.<domain> must hold the domain's verification token
+const ChallengePrefix = "_openbook-challenge."
+
+const (
+	// pendingCheckInterval is how often pending domains are checked
+	pendingCheckInterval = time.Minute
+	// pendingTimeout is how long a new domain may wait for its DNS records
+	// before it is flagged as failed
+	pendingTimeout = 72 * time.Hour
+	// verifyBatchSize bounds the domains checked by one verification pass
+	verifyBatchSize = 100
+)
+
+var (
+	domainLabel = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+	pathSegment = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+)
+
+// recordError is a verification failure caused by missing or wrong DNS
+// records, as opposed to a failed lookup
+type recordError string
+
+func (e recordError) Error() string { return string(e) }
+
+// DomainUseCase registers the custom domains of sites and verifies them
+// through DNS. A domain is active once the TXT challenge holds its token and,
+// when a CNAME target is configured, the domain points at it. Active domains
+// are re-verified periodically and flagged when their records disappear.
+// Subdirectory domains mount a site at a path of a shared host, like
+// example.com/docs; their records are checked on the host.
+type DomainUseCase struct {
+	repo            repository.DomainRepository
+	siteRepo        repository.SiteRepository
+	auditRepo       repository.AuditLogRepository
+	resolver        service.Resolver
+	cnameTarget     string
+	recheckInterval time.Duration
+}
+
+func NewDomainUseCase(
+	repo repository.DomainRepository,
+	siteRepo repository.SiteRepository,
+	auditRepo repository.AuditLogRepository,
+	resolver service.Resolver,
+	cnameTarget string,
+	recheckInterval time.Duration,
+) *DomainUseCase {
+	return &DomainUseCase{
+		repo:            repo,
+		siteRepo:        siteRepo,
+		auditRepo:       auditRepo,
+		resolver:        resolver,
+		cnameTarget:     strings.TrimSuffix(strings.ToLower(cnameTarget), "."),
+		recheckInterval: recheckInterval,
+	}
+}
+
+// Create registers a custom or subdirectory domain for a site of the
+// workspace. The domain starts pending with a new verification token.
+func (uc *DomainUseCase) Create(ctx context.Context, d *domain.Domain, userID uuid.UUID) error {
+	if d.Type == "" {
+		d.Type = "custom"
+	}
+	var name string
+	var err error
+	switch d.Type {
+	case "custom":
+		name, err = normalizeDomain(d.Domain)
+	case "subdirectory":
+		name, err = normalizeSubdirectory(d.Domain)
+	default:
+		err = fmt.Errorf("%w: unsupported domain type %q", domain.ErrInvalidInput, d.Type)
+	}
+	if err != nil {
+		return err
+	}
+
+	site, err := uc.siteRepo.GetByID(ctx, d.SiteID)
+	if err != nil {
+		return err
+	}
+	if site.WorkspaceID != d.WorkspaceID {
+		return fmt.Errorf("site %w", domain.ErrNotFound)
+	}
+
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return fmt.Errorf("failed to generate verification token: %w", err)
+	}
+
+	d.ID = uuid.New()
+	d.Domain = name
+	d.Status = domain.DomainPending
+	d.DNSVerified = false
+	d.SSLStatus = domain.SSLNone
+	d.VerificationToken = hex.EncodeToString(token)
+	d.CreatedAt = time.Now()
+	if err := uc.repo.Create(ctx, d); err != nil {
+		return err
+	}
+
+	uc.audit(ctx, d, userID, "domain.create")
+	return nil
+}
+
+// Get returns a domain of the workspace
+func (uc *DomainUseCase) Get(ctx context.Context, workspaceID, id uuid.UUID) (*domain.Domain, error) {
+	d, err := uc.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if d.WorkspaceID != workspaceID {
+		return nil, fmt.Errorf("domain %w", domain.ErrNotFound)
+	}
+	return d, nil
+}
+
+// List returns the domains of a site of the workspace
+func (uc *DomainUseCase) List(ctx context.Context, workspaceID, siteID uuid.UUID) ([]domain.Domain, error) {
+	site, err := uc.siteRepo.GetByID(ctx, siteID)
+	if err != nil {
+		return nil, err
+	}
+	if site.WorkspaceID != workspaceID {
+		return nil, fmt.Errorf("site %w", domain.ErrNotFound)
+	}
+	return uc.repo.ListBySite(ctx, siteID)
+}
+
+// Delete removes a domain; the site stops being served at it
+func (uc *DomainUseCase) Delete(ctx context.Context, workspaceID, id, userID uuid.UUID) error {
+	d, err := uc.Get(ctx, workspaceID, id)
+	if err != nil {
+		return err
+	}
+	if err := uc.repo.Delete(ctx, d.ID); err != nil {
+		return err
+	}
+	uc.audit(ctx, d, userID, "domain.delete")
+	return nil
+}
+
+// Verify checks the DNS records of a domain of the workspace right away
+func (uc *DomainUseCase) Verify(ctx context.Context, workspaceID, id uuid.UUID) (*domain.Domain, error) {
+	d, err := uc.Get(ctx, workspaceID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := uc.verify(ctx, d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// VerifyDue checks the domains due for verification: pending domains every
+// minute, the others every recheck interval. It returns how many domains
+// changed status.
+func (uc *DomainUseCase) VerifyDue(ctx context.Context) (int, error) {
+	now := time.Now()
+	domains, err := uc.repo.ListForVerification(ctx, now.Add(-pendingCheckInterval), now.Add(-uc.recheckInterval), verifyBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	for i := range domains {
+		if ctx.Err() != nil {
+			break
+		}
+		d := &domains[i]
+		status := d.Status
+		if err := uc.verify(ctx, d); err != nil {
+			log.Printf("Failed to verify domain %s: %v", d.Domain, err)
+			continue
+		}
+		if d.Status != status {
+			log.Printf("Domain %s is now %s", d.Domain, d.Status)
+			changed++
+		}
+	}
+	return changed, nil
+}
+
+// verify checks the records of a domain and saves the outcome. Failed
+// lookups are recorded without changing the status; missing records leave a
+// new domain pending until pendingTimeout and flag any other as failed. A
+// name is only active for one site: a claim verified while another is
+// active fails until that one loses its records.
+func (uc *DomainUseCase) verify(ctx context.Context, d *domain.Domain) error {
+	err := uc.check(ctx, d)
+	now := time.Now()
+	d.CheckedAt = &now
+	previous := *d
+
+	var missing recordError
+	switch {
+	case err == nil:
+		d.Status = domain.DomainActive
+		d.DNSVerified = true
+		d.VerificationError = ""
+		d.VerifiedAt = &now
+	case errors.As(err, &missing):
+		d.DNSVerified = false
+		d.VerificationError = err.Error()
+		if d.Status != domain.DomainPending || now.Sub(d.CreatedAt) >= pendingTimeout {
+			d.Status = domain.DomainError
+		}
+	default:
+		d.VerificationError = err.Error()
+	}
+
+	err = uc.repo.Update(ctx, d)
+	if errors.Is(err, domain.ErrConflict) && previous.Status != domain.DomainActive {
+		d.Status = previous.Status
+		d.DNSVerified = false
+		d.VerifiedAt = previous.VerifiedAt
+		d.VerificationError = err.Error()
+		if d.Status != domain.DomainPending || now.Sub(d.CreatedAt) >= pendingTimeout {
+			d.Status = domain.DomainError
+		}
+		return uc.repo.Update(ctx, d)
+	}
+	return err
+}
+
+// check returns a recordError when the records of the host of a domain are
+// missing or wrong, and another error when they cannot be looked up
+func (uc *DomainUseCase) check(ctx context.Context, d *domain.Domain) error {
+	host := d.Host()
+	challenge := ChallengePrefix + host
+	values, err := uc.resolver.LookupTXT(ctx, challenge)
+	if err != nil {
+		return lookupError(err, "no TXT record at "+challenge)
+	}
+	found := false
+	for _, v := range values {
+		if strings.TrimSpace(v) == d.VerificationToken {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return recordError("the TXT record at " + challenge + " does not hold the verification token")
+	}
+
+	if uc.cnameTarget == "" {
+		return nil
+	}
+	cname, err := uc.resolver.LookupCNAME(ctx, host)
+	if err == nil && strings.TrimSuffix(strings.ToLower(cname), ".") == uc.cnameTarget {
+		return nil
+	}
+	// Apex domains cannot have a CNAME record; they may point at the
+	// addresses of the target instead
+	targetAddrs, err := uc.resolver.LookupHost(ctx, uc.cnameTarget)
+	if err != nil {
+		return fmt.Errorf("DNS lookup of %s failed: %w", uc.cnameTarget, err)
+	}
+	addrs, err := uc.resolver.LookupHost(ctx, host)
+	if err != nil {
+		return lookupError(err, host+" does not resolve")
+	}
+	for _, addr := range addrs {
+		for _, target := range targetAddrs {
+			if addr == target {
+				return nil
+			}
+		}
+	}
+	return recordError(host + " has no CNAME record to " + uc.cnameTarget + " and does not resolve to its addresses")
+}
+
+// lookupError turns a lookup of a missing record into a recordError
+func lookupError(err error, missing string) error {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return recordError(missing)
+	}
+	return fmt.Errorf("DNS lookup failed: %w", err)
+}
+
+// normalizeDomain lower-cases a host name and checks its syntax
+func normalizeDomain(name string) (string, error) {
+	name = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+	labels := strings.Split(name, ".")
+	if len(name) > 253 || len(labels) < 2 {
+		return "", fmt.Errorf("%w: invalid domain %q", domain.ErrInvalidInput, name)
+	}
+	for _, label := range labels {
+		if len(label) > maxHostLabel || !domainLabel.MatchString(label) {
+			return "", fmt.Errorf("%w: invalid domain %q", domain.ErrInvalidInput, name)
+		}
+	}
+	return name, nil
+}
+
+// normalizeSubdirectory lower-cases a host/path subdirectory domain and
+// checks its syntax. The path has at least one segment and no trailing
+// slash.
+func normalizeSubdirectory(name string) (string, error) {
+	host, dir, ok := strings.Cut(strings.ToLower(strings.TrimSpace(name)), "/")
+	dir = strings.TrimSuffix(dir, "/")
+	if !ok || dir == "" {
+		return "", fmt.Errorf("%w: subdirectory domain %q has no path", domain.ErrInvalidInput, name)
+	}
+	host, err := normalizeDomain(host)
+	if err != nil {
+		return "", err
+	}
+	for _, segment := range strings.Split(dir, "/") {
+		if !pathSegment.MatchString(segment) {
+			return "", fmt.Errorf("%w: invalid path %q", domain.ErrInvalidInput, "/"+dir)
+		}
+	}
+	return host + "/" + dir, nil
+}
+
+func (uc *DomainUseCase) audit(ctx context.Context, d *domain.Domain, userID uuid.UUID, action string) {
+	metadata, _ := json.Marshal(map[string]interface{}{
+		"domain_id": d.ID,
+		"site_id":   d.SiteID,
+		"domain":    d.Domain,
+	})
+	audit := &domain.AuditLog{
+		ID:           uuid.New(),
+		WorkspaceID:  d.WorkspaceID,
+		UserID:       userID,
+		Action:       action,
+		MetadataJSON: metadata,
+		CreatedAt:    time.Now(),
+	}
+	// Log error but don't fail the operation
+	if err := uc.auditRepo.Create(ctx, audit); err != nil {
+		fmt.Printf("failed to create audit log: %v\n", err)
+	}
+}
@@ -0,0 +1,104 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"openbook/internal/domain"
+	"openbook/internal/repository"
+	"openbook/internal/service"
+	"openbook/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+// rollbackLockTTL bounds how long a crashed rollback can hold a site lock
+const rollbackLockTTL = 30 * time.Second
+
+type EnvironmentUseCase struct {
+	repo           repository.EnvironmentRepository
+	deploymentRepo repository.DeploymentRepository
+	auditRepo      repository.AuditLogRepository
+	layout         storage.Layout
+	siteLocks      *service.SiteLocks
+}
+
+func NewEnvironmentUseCase(repo repository.EnvironmentRepository, deploymentRepo repository.DeploymentRepository, auditRepo repository.AuditLogRepository, layout storage.Layout, siteLocks *service.SiteLocks) *EnvironmentUseCase {
+	return &EnvironmentUseCase{
+		repo:           repo,
+		deploymentRepo: deploymentRepo,
+		auditRepo:      auditRepo,
+		layout:         layout,
+		siteLocks:      siteLocks,
+	}
+}
+
+// Rollback re-activates a previous successful deployment of the environment
+// without rebuilding it. It holds the environment's site lock, like a build
+// publishing, and fails with domain.ErrConflict while a build holds it.
+func (uc *EnvironmentUseCase) Rollback(ctx context.Context, workspaceID, environmentID, deploymentID, userID uuid.UUID) (*domain.Environment, error) {
+	env, err := uc.repo.GetByID(ctx, environmentID)
+	if err != nil {
+		return nil, err
+	}
+	if env.WorkspaceID != workspaceID {
+		return nil, fmt.Errorf("environment %w", domain.ErrNotFound)
+	}
+
+	d, err := uc.deploymentRepo.GetByID(ctx, deploymentID)
+	if err != nil {
+		return nil, err
+	}
+	if d.WorkspaceID != workspaceID {
+		return nil, fmt.Errorf("deployment %w", domain.ErrNotFound)
+	}
+	if d.EnvironmentID != env.ID {
+		return nil, fmt.Errorf("%w: deployment %s does not belong to environment %s", domain.ErrInvalidInput, d.ID, env.ID)
+	}
+	if d.Status != "success" {
+		return nil, fmt.Errorf("%w: deployment %s is %s", domain.ErrConflict, d.ID, d.Status)
+	}
+
+	lock, err := uc.siteLocks.TryLock(ctx, env.SiteID, env.ID, "rollback", rollbackLockTTL)
+	if err != nil {
+		return nil, err
+	}
+	if lock == nil {
+		return nil, fmt.Errorf("%w: a deployment of environment %s is being published", domain.ErrConflict, env.Name)
+	}
+	defer func() {
+		if err := lock.Release(); err != nil {
+			fmt.Printf("failed to release site lock: %v\n", err)
+		}
+	}()
+
+	if err := uc.layout.Activate(d); err != nil {
+		return nil, fmt.Errorf("%w: %v", domain.ErrConflict, err)
+	}
+	if err := uc.repo.SetLiveDeployment(ctx, env.ID, d.ID); err != nil {
+		return nil, err
+	}
+
+	metadata, _ := json.Marshal(map[string]interface{}{
+		"environment_id":   env.ID,
+		"deployment_id":    d.ID,
+		"previous_live_id": env.LiveDeploymentID,
+	})
+	audit := &domain.AuditLog{
+		ID:           uuid.New(),
+		WorkspaceID:  workspaceID,
+		UserID:       userID,
+		Action:       "environment.rollback",
+		MetadataJSON: metadata,
+		CreatedAt:    time.Now(),
+	}
+	// Log error but don't fail the operation
+	if err := uc.auditRepo.Create(ctx, audit); err != nil {
+		fmt.Printf("failed to create audit log: %v\n", err)
+	}
+
+	env.LiveDeploymentID = &d.ID
+	return env, nil
+}
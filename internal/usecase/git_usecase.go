@@ -4,7 +4,6 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
-	"encoding/json"
 	"fmt"
 	"time"
 
@@ -14,12 +13,41 @@ import (
 	"github.com/google/uuid"
 )
 
+// BranchListener subscribes to the branch events of the git use case.
+// Listeners are called in order after the change is stored.
+type BranchListener interface {
+	BranchHeadMoved(ctx context.Context, event domain.BranchHeadMoved) error
+	BranchDeleted(ctx context.Context, event domain.BranchDeleted) error
+}
+
 type GitUseCase struct {
-	repo repository.GitRepository
+	repo      repository.GitRepository
+	listeners []BranchListener
+}
+
+func NewGitUseCase(repo repository.GitRepository, listeners ...BranchListener) *GitUseCase {
+	return &GitUseCase{repo: repo, listeners: listeners}
 }
 
-func NewGitUseCase(repo repository.GitRepository) *GitUseCase {
-	return &GitUseCase{repo: repo}
+// headMoved publishes a BranchHeadMoved event; listener failures do not
+// undo the change
+func (uc *GitUseCase) headMoved(ctx context.Context, branch *domain.Branch, previousHeadID *uuid.UUID, authorID uuid.UUID) {
+	event := domain.BranchHeadMoved{
+		WorkspaceID:    branch.WorkspaceID,
+		SiteID:         branch.SiteID,
+		BranchID:       branch.ID,
+		BranchName:     branch.Name,
+		IsProtected:    branch.IsProtected,
+		PreviousHeadID: previousHeadID,
+		HeadCommitID:   *branch.HeadCommitID,
+		AuthorID:       authorID,
+		OccurredAt:     time.Now(),
+	}
+	for _, l := range uc.listeners {
+		if err := l.BranchHeadMoved(ctx, event); err != nil {
+			fmt.Printf("failed to handle head move of branch %s: %v\n", branch.Name, err)
+		}
+	}
 }
 
 func (uc *GitUseCase) CreateBranch(ctx context.Context, workspaceID, siteID uuid.UUID, name string, fromCommitID *uuid.UUID) (*domain.Branch, error) {
@@ -41,10 +69,48 @@ func (uc *GitUseCase) CreateBranch(ctx context.Context, workspaceID, siteID uuid
 	if err := uc.repo.CreateBranch(ctx, branch); err != nil {
 		return nil, fmt.Errorf("failed to create branch: %w", err)
 	}
+	if branch.HeadCommitID != nil {
+		head, err := uc.repo.GetCommit(ctx, *branch.HeadCommitID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get head commit: %w", err)
+		}
+		uc.headMoved(ctx, branch, nil, head.AuthorID)
+	}
 
 	return branch, nil
 }
 
+// DeleteBranch removes a branch. Protected branches cannot be deleted.
+func (uc *GitUseCase) DeleteBranch(ctx context.Context, workspaceID, siteID uuid.UUID, name string) error {
+	branch, err := uc.repo.GetBranch(ctx, siteID, name)
+	if err != nil {
+		return err
+	}
+	if branch.WorkspaceID != workspaceID {
+		return fmt.Errorf("branch %w", domain.ErrNotFound)
+	}
+	if branch.IsProtected {
+		return fmt.Errorf("%w: branch %s is protected", domain.ErrConflict, name)
+	}
+
+	if err := uc.repo.DeleteBranch(ctx, branch.ID); err != nil {
+		return err
+	}
+	event := domain.BranchDeleted{
+		WorkspaceID: branch.WorkspaceID,
+		SiteID:      branch.SiteID,
+		BranchID:    branch.ID,
+		BranchName:  branch.Name,
+		OccurredAt:  time.Now(),
+	}
+	for _, l := range uc.listeners {
+		if err := l.BranchDeleted(ctx, event); err != nil {
+			fmt.Printf("failed to handle deletion of branch %s: %v\n", branch.Name, err)
+		}
+	}
+	return nil
+}
+
 func (uc *GitUseCase) GetBranch(ctx context.Context, siteID uuid.UUID, name string) (*domain.Branch, error) {
 	return uc.repo.GetBranch(ctx, siteID, name)
 }
@@ -90,18 +156,41 @@ func (uc *GitUseCase) MergeBranches(ctx context.Context, workspaceID, siteID uui
 		return nil, fmt.Errorf("failed to create merge commit: %w", err)
 	}
 
-	// 5. Update Target Branch Head
+	// 5. Copy the source tree, builds read a commit's files from its tree rows
+	sourceTree, err := uc.repo.GetTree(ctx, sourceHead.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get source tree: %w", err)
+	}
+	for _, entry := range sourceTree {
+		entry.ID = uuid.New()
+		entry.CommitID = mergeCommit.ID
+		if err := uc.repo.CreateTree(ctx, &entry); err != nil {
+			return nil, fmt.Errorf("failed to create tree entry: %w", err)
+		}
+	}
+
+	// 6. Update Target Branch Head
+	previousHeadID := targetBranch.HeadCommitID
 	targetBranch.HeadCommitID = &mergeCommit.ID
 	targetBranch.UpdatedAt = time.Now()
 	if err := uc.repo.UpdateBranch(ctx, targetBranch); err != nil {
 		return nil, fmt.Errorf("failed to update target branch: %w", err)
 	}
+	uc.headMoved(ctx, targetBranch, previousHeadID, authorID)
 
 	return mergeCommit, nil
 }
 
 func (uc *GitUseCase) CommitChanges(ctx context.Context, workspaceID, siteID uuid.UUID, branchName string, message string, authorID uuid.UUID, files map[string][]byte) (*domain.Commit, error) {
-	// 1. Get Branch
+	// 1. Validate paths before anything is read or stored; they become file
+	// paths below the deployment directory when the commit is built
+	for path := range files {
+		if err := domain.ValidateTreePath(path); err != nil {
+			return nil, err
+		}
+	}
+
+	// 2. Get Branch
 	branch, err := uc.repo.GetBranch(ctx, siteID, branchName)
 	if err != nil {
 		// If branch doesn't exist, create it pointing to nothing (initial commit)
@@ -109,8 +198,11 @@ func (uc *GitUseCase) CommitChanges(ctx context.Context, workspaceID, siteID uui
 		// For now, fail.
 		return nil, fmt.Errorf("branch %s not found: %w", branchName, err)
 	}
+	if branch.WorkspaceID != workspaceID {
+		return nil, fmt.Errorf("branch %s %w", branchName, domain.ErrNotFound)
+	}
 
-	// 2. Create Blobs
+	// 3. Create Blobs
 	treeEntries := make([]domain.Tree, 0, len(files))
 	for path, content := range files {
 		// Hash content
@@ -120,20 +212,11 @@ func (uc *GitUseCase) CommitChanges(ctx context.Context, workspaceID, siteID uui
 		// Store Blob (idempotent)
 		blob := &domain.Blob{
 			Hash:        blobHash,
-			ContentJSON: json.RawMessage(content), // Storing raw content as JSON message might be tricky if not JSON
-			// Wait, ContentJSON implies it's JSON.
-			// If it's HTML/Markdown, we should wrap it in JSON string?
-			// Or just store bytes?
-			// The model says ContentJSON json.RawMessage.
-			// Let's wrap it in a JSON string for now to be safe with DB type.
-			SizeBytes: int64(len(content)),
-			CreatedAt: time.Now(),
+			ContentJSON: domain.EncodeBlobContent(content),
+			SizeBytes:   int64(len(content)),
+			CreatedAt:   time.Now(),
 		}
 
-		// Wrap content in JSON string
-		contentJSON, _ := json.Marshal(string(content))
-		blob.ContentJSON = contentJSON
-
 		if err := uc.repo.CreateBlob(ctx, blob); err != nil {
 			return nil, fmt.Errorf("failed to create blob for %s: %w", path, err)
 		}
@@ -147,7 +230,7 @@ func (uc *GitUseCase) CommitChanges(ctx context.Context, workspaceID, siteID uui
 		})
 	}
 
-	// 3. Create Tree (Snapshot model - assuming full tree for simplicity)
+	// 4. Create Tree (Snapshot model - assuming full tree for simplicity)
 	// In real Git, we'd reuse existing tree entries.
 	// Here we just create a new commit with these files.
 	// If files map is partial update, we need to fetch old tree.
@@ -163,7 +246,7 @@ func (uc *GitUseCase) CommitChanges(ctx context.Context, workspaceID, siteID uui
 	}
 	treeHash := hex.EncodeToString(treeHasher.Sum(nil))
 
-	// 4. Create Commit
+	// 5. Create Commit
 	commit := &domain.Commit{
 		ID:          uuid.New(),
 		WorkspaceID: workspaceID,
@@ -179,7 +262,7 @@ func (uc *GitUseCase) CommitChanges(ctx context.Context, workspaceID, siteID uui
 		return nil, fmt.Errorf("failed to create commit: %w", err)
 	}
 
-	// 5. Save Tree Entries linked to Commit
+	// 6. Save Tree Entries linked to Commit
 	for _, entry := range treeEntries {
 		entry.CommitID = commit.ID
 		if err := uc.repo.CreateTree(ctx, &entry); err != nil {
@@ -187,12 +270,14 @@ func (uc *GitUseCase) CommitChanges(ctx context.Context, workspaceID, siteID uui
 		}
 	}
 
-	// 6. Update Branch Head
+	// 7. Update Branch Head
+	previousHeadID := branch.HeadCommitID
 	branch.HeadCommitID = &commit.ID
 	branch.UpdatedAt = time.Now()
 	if err := uc.repo.UpdateBranch(ctx, branch); err != nil {
 		return nil, fmt.Errorf("failed to update branch: %w", err)
 	}
+	uc.headMoved(ctx, branch, previousHeadID, authorID)
 
 	return commit, nil
 }
@@ -0,0 +1,212 @@
+package usecase
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"openbook/internal/domain"
+	"openbook/internal/repository"
+	"openbook/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+// previewEnvironmentPrefix names the preview environment of a branch
+const previewEnvironmentPrefix = "preview/"
+
+// maxHostLabel is the longest DNS label a preview host may use
+const maxHostLabel = 63
+
+var hostLabelInvalid = regexp.MustCompile(`[^a-z0-9]+`)
+
+// PreviewUseCase keeps a preview environment for every non-protected branch.
+// Each preview is served at a deterministic host and tracks its branch, so
+// auto-deploy redeploys it whenever the branch head moves. Previews expire
+// once their branch is deleted or inactive.
+type PreviewUseCase struct {
+	siteRepo        repository.SiteRepository
+	environmentRepo repository.EnvironmentRepository
+	deploymentRepo  repository.DeploymentRepository
+	layout          storage.Layout
+	baseDomain      string
+	ttl             time.Duration
+}
+
+func NewPreviewUseCase(
+	siteRepo repository.SiteRepository,
+	environmentRepo repository.EnvironmentRepository,
+	deploymentRepo repository.DeploymentRepository,
+	layout storage.Layout,
+	baseDomain string,
+	ttl time.Duration,
+) *PreviewUseCase {
+	return &PreviewUseCase{
+		siteRepo:        siteRepo,
+		environmentRepo: environmentRepo,
+		deploymentRepo:  deploymentRepo,
+		layout:          layout,
+		baseDomain:      strings.Trim(strings.ToLower(baseDomain), "."),
+		ttl:             ttl,
+	}
+}
+
+// PreviewHost returns the host a branch preview is served at:
+// <branch>--<site>-<id>.preview.<base-domain>. Slugs are only unique within a
+// workspace, so <id>, a short hash of the site ID, keeps the previews of
+// sites sharing a slug apart. A name that is not already a valid label, like
+// feat_x or Feat.X, or that would exceed the DNS limit, is converted and
+// suffixed with a hash of the original, so that distinct branches never
+// share a host.
+func PreviewHost(branchName, siteSlug string, siteID uuid.UUID, baseDomain string) string {
+	sum := sha256.Sum256(siteID[:])
+	site := hostLabel(siteSlug, maxHostLabel/2-9) + "-" + hex.EncodeToString(sum[:4])
+	branch := hostLabel(branchName, maxHostLabel-len(site)-2)
+	return branch + "--" + site + ".preview." + baseDomain
+}
+
+// hostLabel converts a name to a DNS label of at most max characters
+func hostLabel(name string, max int) string {
+	label := toLabel(name)
+	if label == name && len(label) <= max {
+		return label
+	}
+	sum := sha256.Sum256([]byte(name))
+	if len(label) > max-7 {
+		label = strings.Trim(label[:max-7], "-")
+	}
+	if label == "" {
+		label = "x"
+	}
+	return label + "-" + hex.EncodeToString(sum[:3])
+}
+
+// toLabel lower-cases a name and replaces the runs of characters invalid in
+// a DNS label with a hyphen
+func toLabel(s string) string {
+	label := strings.Trim(hostLabelInvalid.ReplaceAllString(strings.ToLower(s), "-"), "-")
+	if label == "" {
+		label = "x"
+	}
+	return label
+}
+
+// BranchHeadMoved creates or reactivates the preview of a branch. It must
+// run before auto-deploy so the new head is deployed to the preview.
+func (uc *PreviewUseCase) BranchHeadMoved(ctx context.Context, event domain.BranchHeadMoved) error {
+	if uc.baseDomain == "" || event.IsProtected {
+		return nil
+	}
+
+	site, err := uc.siteRepo.GetByID(ctx, event.SiteID)
+	if err != nil {
+		return fmt.Errorf("failed to get site: %w", err)
+	}
+
+	now := event.OccurredAt
+	url := "https://" + PreviewHost(event.BranchName, site.Slug, site.ID, uc.baseDomain)
+	env, err := uc.environmentRepo.GetByName(ctx, site.ID, previewEnvironmentPrefix+event.BranchName)
+	switch {
+	case errors.Is(err, domain.ErrNotFound):
+		env = &domain.Environment{
+			ID:             uuid.New(),
+			WorkspaceID:    event.WorkspaceID,
+			SiteID:         site.ID,
+			Name:           previewEnvironmentPrefix + event.BranchName,
+			BranchID:       event.BranchID,
+			URL:            url,
+			IsActive:       true,
+			IsPreview:      true,
+			LastActivityAt: &now,
+			CreatedAt:      now,
+		}
+		if err := uc.environmentRepo.Create(ctx, env); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	case !env.IsPreview:
+		return fmt.Errorf("%w: environment %s is not a preview", domain.ErrConflict, env.Name)
+	default:
+		// A recreated branch takes over the preview of its predecessor
+		env.BranchID = event.BranchID
+		env.URL = url
+		env.IsActive = true
+		env.LastActivityAt = &now
+		if err := uc.environmentRepo.Update(ctx, env); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BranchDeleted expires the preview of a deleted branch right away
+func (uc *PreviewUseCase) BranchDeleted(ctx context.Context, event domain.BranchDeleted) error {
+	env, err := uc.environmentRepo.GetByName(ctx, event.SiteID, previewEnvironmentPrefix+event.BranchName)
+	if errors.Is(err, domain.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !env.IsPreview || !env.IsActive {
+		return nil
+	}
+	return uc.expire(ctx, env)
+}
+
+// ExpireInactive expires previews whose branch is gone or that had no new
+// commit within the preview TTL. It returns the number of expired previews.
+func (uc *PreviewUseCase) ExpireInactive(ctx context.Context) (int, error) {
+	envs, err := uc.environmentRepo.ListExpiredPreviews(ctx, time.Now().Add(-uc.ttl))
+	if err != nil {
+		return 0, err
+	}
+	expired := 0
+	for _, env := range envs {
+		if err := uc.expire(ctx, env); err != nil {
+			return expired, fmt.Errorf("failed to expire preview %s: %w", env.ID, err)
+		}
+		expired++
+	}
+	return expired, nil
+}
+
+// expire deactivates a preview and removes its published output. The
+// environment and deployment rows are kept for history.
+func (uc *PreviewUseCase) expire(ctx context.Context, env *domain.Environment) error {
+	env.IsActive = false
+	if err := uc.environmentRepo.Update(ctx, env); err != nil {
+		return err
+	}
+
+	link := uc.layout.LiveLink(env.WorkspaceID, env.SiteID, env.ID)
+	if err := os.RemoveAll(filepath.Dir(link)); err != nil {
+		return fmt.Errorf("failed to remove live link: %w", err)
+	}
+
+	filter := domain.DeploymentFilter{WorkspaceID: env.WorkspaceID, EnvironmentID: &env.ID, Limit: 100}
+	for {
+		deployments, err := uc.deploymentRepo.List(ctx, filter)
+		if err != nil {
+			return err
+		}
+		for _, d := range deployments {
+			if err := os.RemoveAll(uc.layout.DeploymentDir(d)); err != nil {
+				return fmt.Errorf("failed to remove deployment output: %w", err)
+			}
+		}
+		if len(deployments) < filter.Limit {
+			return nil
+		}
+		last := deployments[len(deployments)-1]
+		filter.After = &domain.DeploymentCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+}
@@ -0,0 +1,70 @@
+package usecase
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+var testSiteID = uuid.MustParse("6f1c2d9e-8a47-4b0e-9c1d-3e5f7a9b2c4d")
+
+func TestPreviewHost(t *testing.T) {
+	tests := []struct {
+		branch string
+		site   string
+		want   string
+	}{
+		{"feat-x", "handbook", `^feat-x--handbook-[0-9a-f]{8}\.preview\.example\.com$`},
+		{"main", "docs", `^main--docs-[0-9a-f]{8}\.preview\.example\.com$`},
+	}
+	for _, tt := range tests {
+		assert.Regexp(t, regexp.MustCompile(tt.want), PreviewHost(tt.branch, tt.site, testSiteID, "example.com"), tt.branch)
+	}
+	assert.Equal(t,
+		PreviewHost("main", "docs", testSiteID, "example.com"),
+		PreviewHost("main", "docs", testSiteID, "example.com"),
+		"hosts are deterministic",
+	)
+}
+
+func TestPreviewHost_CollidingBranches(t *testing.T) {
+	branches := []string{"feat-x", "feat_x", "Feat.X", "feat--x", "feat/x"}
+	hosts := map[string]string{}
+	for _, branch := range branches {
+		host := PreviewHost(branch, "handbook", testSiteID, "example.com")
+		if other, ok := hosts[host]; ok {
+			t.Errorf("branches %q and %q share host %s", other, branch, host)
+		}
+		hosts[host] = branch
+		assert.True(t, strings.HasPrefix(host, "feat-x"), host)
+	}
+}
+
+// Slugs are only unique within a workspace
+func TestPreviewHost_SameSlugInTwoWorkspaces(t *testing.T) {
+	first := PreviewHost("feature", "docs", uuid.New(), "example.com")
+	second := PreviewHost("feature", "docs", uuid.New(), "example.com")
+	assert.NotEqual(t, first, second)
+	assert.True(t, strings.HasPrefix(first, "feature--docs-"), first)
+	assert.True(t, strings.HasPrefix(second, "feature--docs-"), second)
+}
+
+func TestPreviewHost_Long(t *testing.T) {
+	long := strings.Repeat("a", 80)
+	for _, branch := range []string{long, long + "b"} {
+		host := PreviewHost(branch, strings.Repeat("s", 40), testSiteID, "example.com")
+		label := strings.SplitN(host, ".", 2)[0]
+		assert.LessOrEqual(t, len(label), maxHostLabel, host)
+	}
+	assert.NotEqual(t,
+		PreviewHost(long, "handbook", testSiteID, "example.com"),
+		PreviewHost(long+"b", "handbook", testSiteID, "example.com"),
+	)
+	assert.NotEqual(t,
+		PreviewHost("main", strings.Repeat("s", 40), testSiteID, "example.com"),
+		PreviewHost("main", strings.Repeat("s", 41), testSiteID, "example.com"),
+	)
+}
@@ -0,0 +1,75 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"openbook/internal/domain"
+	"openbook/internal/repository"
+	"openbook/internal/service"
+
+	"github.com/google/uuid"
+)
+
+// QueueUseCase exposes operator actions on the deployment queue
+type QueueUseCase struct {
+	deploymentRepo repository.DeploymentRepository
+	auditRepo      repository.AuditLogRepository
+	publisher      *service.Publisher
+}
+
+func NewQueueUseCase(deploymentRepo repository.DeploymentRepository, auditRepo repository.AuditLogRepository, publisher *service.Publisher) *QueueUseCase {
+	return &QueueUseCase{
+		deploymentRepo: deploymentRepo,
+		auditRepo:      auditRepo,
+		publisher:      publisher,
+	}
+}
+
+func (uc *QueueUseCase) ListDeadLetters(ctx context.Context, limit int64) ([]service.DeadLetter, error) {
+	return uc.publisher.ListDeadLetters(ctx, limit)
+}
+
+// RequeueDeadLetter puts a dead-lettered deployment back on the queue
+func (uc *QueueUseCase) RequeueDeadLetter(ctx context.Context, id string, userID uuid.UUID) (*service.DeadLetter, error) {
+	letter, err := uc.publisher.GetDeadLetter(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if letter == nil {
+		return nil, fmt.Errorf("dead letter %w", domain.ErrNotFound)
+	}
+
+	d, err := uc.deploymentRepo.GetByID(ctx, letter.DeploymentID)
+	if err != nil {
+		return nil, err
+	}
+	if err := uc.deploymentRepo.UpdateStatus(ctx, d.ID, "pending"); err != nil {
+		return nil, err
+	}
+	if err := uc.publisher.RequeueDeadLetter(ctx, letter); err != nil {
+		return nil, err
+	}
+
+	metadata, _ := json.Marshal(map[string]interface{}{
+		"deployment_id":  d.ID,
+		"dead_letter_id": letter.ID,
+		"attempts":       letter.Attempts,
+	})
+	audit := &domain.AuditLog{
+		ID:           uuid.New(),
+		WorkspaceID:  d.WorkspaceID,
+		UserID:       userID,
+		Action:       "deployment.requeue",
+		MetadataJSON: metadata,
+		CreatedAt:    time.Now(),
+	}
+	// Log error but don't fail the operation
+	if err := uc.auditRepo.Create(ctx, audit); err != nil {
+		fmt.Printf("failed to create audit log: %v\n", err)
+	}
+
+	return letter, nil
+}
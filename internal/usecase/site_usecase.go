@@ -0,0 +1,264 @@
+package usecase
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"openbook/internal/domain"
+	"openbook/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// Every site starts with a protected main branch holding an empty initial
+// commit, and a production environment tracking it
+const (
+	defaultBranchName      = "main"
+	defaultEnvironmentName = "production"
+	defaultSitePlan        = "basic"
+)
+
+// maxSlugLength keeps slugs usable as a DNS label, see PreviewHost
+const maxSlugLength = 63
+
+var siteSlugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+type SiteUseCase struct {
+	repo            repository.SiteRepository
+	environmentRepo repository.EnvironmentRepository
+	auditRepo       repository.AuditLogRepository
+}
+
+func NewSiteUseCase(repo repository.SiteRepository, environmentRepo repository.EnvironmentRepository, auditRepo repository.AuditLogRepository) *SiteUseCase {
+	return &SiteUseCase{
+		repo:            repo,
+		environmentRepo: environmentRepo,
+		auditRepo:       auditRepo,
+	}
+}
+
+// CreatedSite is a new site with the branch and environment created with it
+type CreatedSite struct {
+	*domain.Site
+	Branch      *domain.Branch      `json:"branch"`
+	Environment *domain.Environment `json:"environment"`
+}
+
+// SiteUpdate lists the settings of a site to change; nil fields are kept
+type SiteUpdate struct {
+	Name               *string
+	Slug               *string
+	DefaultEnvironment *string
+	IsPublic           *bool
+	BrokenLinks        *string
+	WhatsNew           *bool
+}
+
+// Create creates a site together with its main branch, an empty initial
+// commit and its production environment. The slug defaults to one derived
+// from the name and must be unique among the sites of the workspace.
+func (uc *SiteUseCase) Create(ctx context.Context, site *domain.Site, userID uuid.UUID) (*CreatedSite, error) {
+	site.Name = strings.TrimSpace(site.Name)
+	if site.Name == "" {
+		return nil, fmt.Errorf("%w: name is required", domain.ErrInvalidInput)
+	}
+	if site.Slug == "" {
+		site.Slug = toLabel(site.Name)
+		if len(site.Slug) > maxSlugLength {
+			site.Slug = strings.Trim(site.Slug[:maxSlugLength], "-")
+		}
+	}
+	if site.BrokenLinks == "" {
+		site.BrokenLinks = domain.BrokenLinksWarn
+	}
+	if err := validateSite(site); err != nil {
+		return nil, err
+	}
+	if _, err := uc.repo.GetBySlug(ctx, site.WorkspaceID, site.Slug); err == nil {
+		return nil, fmt.Errorf("%w: slug %s is already used in the workspace", domain.ErrConflict, site.Slug)
+	} else if !errors.Is(err, domain.ErrNotFound) {
+		return nil, err
+	}
+
+	now := time.Now()
+	site.ID = uuid.New()
+	site.Plan = defaultSitePlan
+	site.DefaultEnvironment = defaultEnvironmentName
+	site.CreatedAt = now
+	site.UpdatedAt = now
+	// Without its branch and environment the site would be unusable, so all
+	// of them are stored together
+	created, commit := initialSite(site, userID)
+	if err := uc.repo.CreateInitialized(ctx, site, commit, created.Branch, created.Environment); err != nil {
+		return nil, err
+	}
+
+	uc.audit(ctx, site, userID, "site.create", map[string]interface{}{
+		"site_id": site.ID,
+		"name":    site.Name,
+		"slug":    site.Slug,
+	})
+	return created, nil
+}
+
+// initialSite returns the main branch, its empty initial commit and the
+// production environment of a new site
+func initialSite(site *domain.Site, userID uuid.UUID) (*CreatedSite, *domain.Commit) {
+	emptyTree := sha256.Sum256(nil)
+	commit := &domain.Commit{
+		ID:          uuid.New(),
+		WorkspaceID: site.WorkspaceID,
+		SiteID:      &site.ID,
+		TreeHash:    hex.EncodeToString(emptyTree[:]),
+		Message:     "Initial commit",
+		AuthorID:    userID,
+		CreatedAt:   site.CreatedAt,
+	}
+
+	branch := &domain.Branch{
+		ID:           uuid.New(),
+		WorkspaceID:  site.WorkspaceID,
+		SiteID:       site.ID,
+		Name:         defaultBranchName,
+		HeadCommitID: &commit.ID,
+		IsProtected:  true,
+		CreatedAt:    site.CreatedAt,
+		UpdatedAt:    site.CreatedAt,
+	}
+
+	env := &domain.Environment{
+		ID:          uuid.New(),
+		WorkspaceID: site.WorkspaceID,
+		SiteID:      site.ID,
+		Name:        defaultEnvironmentName,
+		BranchID:    branch.ID,
+		IsActive:    true,
+		CreatedAt:   site.CreatedAt,
+	}
+	return &CreatedSite{Site: site, Branch: branch, Environment: env}, commit
+}
+
+// Get returns a site of the workspace
+func (uc *SiteUseCase) Get(ctx context.Context, workspaceID, id uuid.UUID) (*domain.Site, error) {
+	site, err := uc.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if site.WorkspaceID != workspaceID {
+		return nil, fmt.Errorf("site %w", domain.ErrNotFound)
+	}
+	return site, nil
+}
+
+// List returns the sites of the workspace, oldest first
+func (uc *SiteUseCase) List(ctx context.Context, workspaceID uuid.UUID) ([]domain.Site, error) {
+	return uc.repo.List(ctx, workspaceID)
+}
+
+// Update changes the name, slug and settings of a site. The default
+// environment must name one of its environments.
+func (uc *SiteUseCase) Update(ctx context.Context, workspaceID, id uuid.UUID, update SiteUpdate, userID uuid.UUID) (*domain.Site, error) {
+	site, err := uc.Get(ctx, workspaceID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]interface{}{"site_id": site.ID}
+	if update.Name != nil {
+		site.Name = strings.TrimSpace(*update.Name)
+		changes["name"] = site.Name
+	}
+	if update.Slug != nil && *update.Slug != site.Slug {
+		site.Slug = *update.Slug
+		changes["slug"] = site.Slug
+		if other, err := uc.repo.GetBySlug(ctx, workspaceID, site.Slug); err == nil && other.ID != site.ID {
+			return nil, fmt.Errorf("%w: slug %s is already used in the workspace", domain.ErrConflict, site.Slug)
+		}
+	}
+	if update.DefaultEnvironment != nil && *update.DefaultEnvironment != site.DefaultEnvironment {
+		env, err := uc.environmentRepo.GetByName(ctx, site.ID, *update.DefaultEnvironment)
+		if errors.Is(err, domain.ErrNotFound) || (err == nil && env.IsPreview) {
+			return nil, fmt.Errorf("%w: site has no environment %q", domain.ErrInvalidInput, *update.DefaultEnvironment)
+		}
+		if err != nil {
+			return nil, err
+		}
+		site.DefaultEnvironment = env.Name
+		changes["default_environment"] = site.DefaultEnvironment
+	}
+	if update.IsPublic != nil {
+		site.IsPublic = *update.IsPublic
+		changes["is_public"] = site.IsPublic
+	}
+	if update.BrokenLinks != nil {
+		site.BrokenLinks = *update.BrokenLinks
+		changes["broken_links"] = site.BrokenLinks
+	}
+	if update.WhatsNew != nil {
+		site.WhatsNew = *update.WhatsNew
+		changes["whats_new"] = site.WhatsNew
+	}
+	if err := validateSite(site); err != nil {
+		return nil, err
+	}
+
+	site.UpdatedAt = time.Now()
+	if err := uc.repo.Update(ctx, site); err != nil {
+		return nil, err
+	}
+	uc.audit(ctx, site, userID, "site.update", changes)
+	return site, nil
+}
+
+// Delete soft-deletes a site. It stops being served, and its slug and domain
+// names can be reused; its history stays in the database.
+func (uc *SiteUseCase) Delete(ctx context.Context, workspaceID, id, userID uuid.UUID) error {
+	site, err := uc.Get(ctx, workspaceID, id)
+	if err != nil {
+		return err
+	}
+	if err := uc.repo.Delete(ctx, site.ID); err != nil {
+		return err
+	}
+	uc.audit(ctx, site, userID, "site.delete", map[string]interface{}{
+		"site_id": site.ID,
+		"slug":    site.Slug,
+	})
+	return nil
+}
+
+func validateSite(site *domain.Site) error {
+	if site.Name == "" || len(site.Name) > 255 {
+		return fmt.Errorf("%w: name must be 1 to 255 characters", domain.ErrInvalidInput)
+	}
+	if len(site.Slug) > maxSlugLength || !siteSlugPattern.MatchString(site.Slug) {
+		return fmt.Errorf("%w: slug must be up to %d lowercase letters, digits and inner hyphens", domain.ErrInvalidInput, maxSlugLength)
+	}
+	if site.BrokenLinks != domain.BrokenLinksWarn && site.BrokenLinks != domain.BrokenLinksFail {
+		return fmt.Errorf("%w: broken_links must be %s or %s", domain.ErrInvalidInput, domain.BrokenLinksWarn, domain.BrokenLinksFail)
+	}
+	return nil
+}
+
+func (uc *SiteUseCase) audit(ctx context.Context, site *domain.Site, userID uuid.UUID, action string, fields map[string]interface{}) {
+	metadata, _ := json.Marshal(fields)
+	audit := &domain.AuditLog{
+		ID:           uuid.New(),
+		WorkspaceID:  site.WorkspaceID,
+		UserID:       userID,
+		Action:       action,
+		MetadataJSON: metadata,
+		CreatedAt:    time.Now(),
+	}
+	// Log error but don't fail the operation
+	if err := uc.auditRepo.Create(ctx, audit); err != nil {
+		fmt.Printf("failed to create audit log: %v\n", err)
+	}
+}
@@ -0,0 +1,344 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"openbook/internal/render"
+
+	"github.com/HugoSmits86/nativewebp"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// fingerprintLength is the number of hex digits of the content hash
+// embedded in fingerprinted file names
+const fingerprintLength = 12
+
+// maxAssetSize is the size above which an asset is reported as oversized
+const maxAssetSize = 1 << 20
+
+// maxImagePixels bounds the images decoded to generate variants
+const maxImagePixels = 40_000_000
+
+// jpegQuality is used for resized JPEG variants
+const jpegQuality = 82
+
+// imageWidths are the widths of the responsive variants; only widths below
+// the width of the original are generated
+var imageWidths = []int{480, 960, 1600}
+
+// assetExts are the static assets published under a fingerprinted name
+var assetExts = map[string]bool{
+	".css": true, ".js": true, ".mjs": true, ".map": true,
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".webp": true, ".avif": true, ".svg": true, ".ico": true,
+	".woff": true, ".woff2": true, ".ttf": true, ".otf": true, ".eot": true,
+	".mp4": true, ".webm": true, ".mp3": true, ".ogg": true, ".pdf": true,
+}
+
+// imageFormats are the MIME types of the image formats variants are
+// generated for. GIFs are only fingerprinted, they may be animated.
+var imageFormats = map[string]string{
+	"png":  "image/png",
+	"jpeg": "image/jpeg",
+	"webp": "image/webp",
+}
+
+// assetOutput is a fingerprinted output of a static asset. Its name embeds
+// the hash of its content, so it can be cached forever.
+type assetOutput struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	Type   string `json:"type,omitempty"` // MIME type of image outputs
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+}
+
+// isStaticAsset reports whether a tree path is published fingerprinted
+func isStaticAsset(p string) bool {
+	return assetExts[strings.ToLower(path.Ext(p))]
+}
+
+// fingerprintPath names an output after the hash of its content:
+// "img/hero.png" becomes "img/hero.<hash>.png", or "img/hero-480w.<hash>.webp"
+// for a variant with suffix "-480w" and extension ".webp"
+func fingerprintPath(rel, suffix, ext, sum string) string {
+	if ext == "" {
+		ext = path.Ext(rel)
+	}
+	return strings.TrimSuffix(rel, path.Ext(rel)) + suffix + "." + sum[:fingerprintLength] + ext
+}
+
+// buildAssets writes the fingerprinted outputs of a static asset: the asset
+// itself and, for images, resized variants and WebP versions. The first
+// output is always the asset itself. An image that cannot be resized or
+// re-encoded is still published; the returned warning says why variants
+// are missing.
+func buildAssets(dir, rel string, content []byte) ([]assetOutput, string, error) {
+	original, err := writeAsset(dir, rel, "", "", content)
+	if err != nil {
+		return nil, "", err
+	}
+	outputs := []assetOutput{original}
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return outputs, "", nil
+	}
+	outputs[0].Width, outputs[0].Height = cfg.Width, cfg.Height
+	if format == "gif" {
+		outputs[0].Type = "image/gif"
+	}
+	mimeType, ok := imageFormats[format]
+	if !ok {
+		return outputs, "", nil
+	}
+	outputs[0].Type = mimeType
+	if cfg.Width*cfg.Height > maxImagePixels {
+		return outputs, fmt.Sprintf("%dx%d pixels is too large to resize", cfg.Width, cfg.Height), nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return outputs, fmt.Sprintf("cannot decode image: %v", err), nil
+	}
+
+	var warning string
+	widths := []int{cfg.Width}
+	for _, w := range imageWidths {
+		if w < cfg.Width {
+			widths = append(widths, w)
+		}
+	}
+	for _, w := range widths {
+		scaled := img
+		sized := content
+		if w != cfg.Width {
+			scaled = resize(img, w)
+			if sized, err = encodeImage(scaled, format); err != nil {
+				return outputs, fmt.Sprintf("cannot encode at %dpx: %v", w, err), nil
+			}
+			// A smaller image that does not weigh less than the original
+			// is of no use to any client
+			if len(sized) >= len(content) {
+				continue
+			}
+			variant, err := writeAsset(dir, rel, fmt.Sprintf("-%dw", w), "", sized)
+			if err != nil {
+				return nil, "", err
+			}
+			variant.Type = mimeType
+			variant.Width, variant.Height = scaled.Bounds().Dx(), scaled.Bounds().Dy()
+			outputs = append(outputs, variant)
+		}
+		if format == "webp" || warning != "" {
+			continue
+		}
+
+		// WebP is lossless here, so it only beats photos in the source
+		// format sometimes; versions that are not smaller are skipped
+		webp, err := encodeWebP(scaled)
+		if err != nil {
+			warning = fmt.Sprintf("cannot encode as WebP: %v", err)
+			continue
+		}
+		if len(webp) >= len(sized) {
+			continue
+		}
+		variant, err := writeAsset(dir, rel, fmt.Sprintf("-%dw", w), ".webp", webp)
+		if err != nil {
+			return nil, "", err
+		}
+		variant.Type = "image/webp"
+		variant.Width, variant.Height = scaled.Bounds().Dx(), scaled.Bounds().Dy()
+		outputs = append(outputs, variant)
+	}
+	return outputs, warning, nil
+}
+
+func writeAsset(dir, rel, suffix, ext string, content []byte) (assetOutput, error) {
+	sum := sha256.Sum256(content)
+	out := assetOutput{SHA256: hex.EncodeToString(sum[:])}
+	out.Path = fingerprintPath(rel, suffix, ext, out.SHA256)
+	return out, writeOutput(dir, out.Path, content)
+}
+
+// resize scales an image to the given width, keeping its aspect ratio
+func resize(img image.Image, width int) image.Image {
+	b := img.Bounds()
+	height := max(1, (b.Dy()*width+b.Dx()/2)/b.Dx())
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+func encodeImage(img image.Image, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+	case "png":
+		err = (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(&buf, img)
+	case "webp":
+		return encodeWebP(img)
+	default:
+		err = fmt.Errorf("unsupported image format %s", format)
+	}
+	return buf.Bytes(), err
+}
+
+// encodeWebP encodes an image as lossless WebP. The encoder panics on some
+// images, which must not take the worker down with it.
+func encodeWebP(img image.Image) (b []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("webp encoder failed: %v", r)
+		}
+	}()
+	var buf bytes.Buffer
+	if err := nativewebp.Encode(&buf, img, nil); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// processAssets publishes the fingerprinted outputs of every static asset of
+// a build. Assets unchanged since the previous build reuse its outputs.
+// written is updated with every output path.
+func (p *DeploymentProcessor) processAssets(ctx context.Context, dir string, previous *previousBuild, manifest *buildManifest, sources map[string][]byte, written map[string]bool, blog *buildLog) error {
+	paths := make([]string, 0, len(manifest.Files))
+	for rel := range manifest.Files {
+		if isStaticAsset(rel) {
+			paths = append(paths, rel)
+		}
+	}
+	sort.Strings(paths)
+
+	generated, variants := 0, 0
+	for _, rel := range paths {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		file := manifest.Files[rel]
+		content, isChanged := sources[rel]
+		if !isChanged {
+			for _, out := range file.Assets {
+				if err := reuseOutput(previous.dir, dir, out.Path); err != nil {
+					return fmt.Errorf("failed to reuse %s: %w", out.Path, err)
+				}
+				written[out.Path] = true
+			}
+			continue
+		}
+
+		outputs, warning, err := buildAssets(dir, rel, content)
+		if err != nil {
+			return fmt.Errorf("failed to publish asset %s: %w", rel, err)
+		}
+		if warning != "" {
+			blog.Warnf(ctx, "Missing responsive variants for %s: %s", rel, warning)
+		}
+		for _, out := range outputs {
+			written[out.Path] = true
+		}
+		file.Assets = outputs
+		manifest.Files[rel] = file
+		generated++
+		variants += len(outputs) - 1
+	}
+	blog.Infof(ctx, "Fingerprinted %d assets, %d new, with %d new image variants", len(paths), generated, variants)
+	return nil
+}
+
+// reportOversizedAssets logs the static assets larger than maxAssetSize
+func reportOversizedAssets(ctx context.Context, dir string, manifest *buildManifest, blog *buildLog) {
+	var oversized []string
+	for rel, file := range manifest.Files {
+		if !isStaticAsset(rel) {
+			continue
+		}
+		info, err := os.Stat(filepath.Join(dir, file.OutputPath))
+		if err != nil || info.Size() <= maxAssetSize {
+			continue
+		}
+		oversized = append(oversized, fmt.Sprintf("%s (%.1f MB)", rel, float64(info.Size())/(1<<20)))
+	}
+	sort.Strings(oversized)
+	for i, asset := range oversized {
+		if i == maxReportedLinks {
+			blog.Warnf(ctx, "... and %d more oversized assets", len(oversized)-maxReportedLinks)
+			break
+		}
+		blog.Warnf(ctx, "Oversized asset %s, larger than %d KB", asset, maxAssetSize>>10)
+	}
+}
+
+// assetsByURL maps the URL path of every static asset of a build to its
+// fingerprinted outputs
+func assetsByURL(manifest *buildManifest) map[string][]assetOutput {
+	assets := make(map[string][]assetOutput)
+	for rel, file := range manifest.Files {
+		if len(file.Assets) > 0 {
+			assets["/"+rel] = file.Assets
+		}
+	}
+	return assets
+}
+
+// changedAssets returns the URL paths of the assets whose fingerprinted
+// name differs from the previous build, including added and removed ones.
+// Pages referencing them are rendered again.
+func changedAssets(current, previous map[string][]assetOutput) map[string]bool {
+	changed := make(map[string]bool)
+	for url, outputs := range current {
+		if prev := previous[url]; len(prev) == 0 || prev[0].Path != outputs[0].Path {
+			changed[url] = true
+		}
+	}
+	for url := range previous {
+		if _, ok := current[url]; !ok {
+			changed[url] = true
+		}
+	}
+	return changed
+}
+
+// referencesChanged reports whether a page links to one of the changed assets
+func referencesChanged(page *sitePage, changed map[string]bool) bool {
+	for _, link := range page.LinkRefs {
+		if changed[link.Target] {
+			return true
+		}
+	}
+	return false
+}
+
+// responsiveImage describes the published outputs of an image for the
+// renderer, below the base path the site is mounted at
+func responsiveImage(outputs []assetOutput, base string) *render.Image {
+	if len(outputs) == 0 {
+		return nil
+	}
+	original := outputs[0]
+	img := &render.Image{Src: base + "/" + original.Path, Type: original.Type, Width: original.Width, Height: original.Height}
+	if len(outputs) == 1 {
+		return img
+	}
+	for _, out := range outputs {
+		img.Variants = append(img.Variants, render.ImageVariant{URL: base + "/" + out.Path, Type: out.Type, Width: out.Width})
+	}
+	return img
+}
@@ -0,0 +1,96 @@
+package worker
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"openbook/internal/domain"
+	"openbook/internal/render"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// noisyPNG returns a PNG that compresses like a photo: the smaller the
+// image, the fewer bytes. noise is the amplitude of the grain.
+func noisyPNG(t *testing.T, noise int) []byte {
+	rnd := rand.New(rand.NewSource(1))
+	img := image.NewNRGBA(image.Rect(0, 0, 1200, 800))
+	for x := 0; x < 1200; x++ {
+		for y := 0; y < 800; y++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x/5 + rnd.Intn(noise)), G: uint8(y / 4), B: 0x80, A: 0xff})
+		}
+	}
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+// A PNG committed through the API as base64 is stored as a binary blob and
+// published with resized variants the renderer lists in srcset
+func TestBuildAssets_CommittedPNG(t *testing.T) {
+	buf := bytes.NewBuffer(noisyPNG(t, 64))
+
+	// The commit handler receives the file like this
+	var file struct {
+		Content  string `json:"content"`
+		Encoding string `json:"encoding"`
+	}
+	body, _ := json.Marshal(map[string]string{"content": base64.StdEncoding.EncodeToString(buf.Bytes()), "encoding": "base64"})
+	require.NoError(t, json.Unmarshal(body, &file))
+	decoded, err := base64.StdEncoding.DecodeString(file.Content)
+	require.NoError(t, err)
+	content := domain.DecodeBlobContent(domain.EncodeBlobContent(decoded))
+	require.Equal(t, buf.Bytes(), content)
+
+	dir := t.TempDir()
+	outputs, warning, err := buildAssets(dir, "img/hero.png", content)
+	require.NoError(t, err)
+	assert.Empty(t, warning)
+
+	widths := map[int]bool{}
+	for _, out := range outputs {
+		_, err := os.Stat(filepath.Join(dir, out.Path))
+		assert.NoError(t, err, out.Path)
+		if out.Type == "image/png" {
+			widths[out.Width] = true
+		}
+	}
+	assert.Equal(t, map[int]bool{1200: true, 480: true, 960: true}, widths)
+	assert.True(t, strings.HasPrefix(outputs[0].Path, "img/hero."))
+
+	doc := render.Markdown([]byte("![Hero](img/hero.png)"), nil, func(src string) *render.Image {
+		return responsiveImage(outputs, "/docs")
+	})
+	assert.Contains(t, doc.HTML, "srcset=")
+	assert.Contains(t, doc.HTML, " 480w")
+	assert.Contains(t, doc.HTML, " 960w")
+	assert.Contains(t, doc.HTML, `src="/docs/`+outputs[0].Path+`"`)
+}
+
+// The WebP encoder panics on some images; they are still published with
+// their resized variants
+func TestBuildAssets_WebPEncoderFailure(t *testing.T) {
+	content := noisyPNG(t, 256)
+
+	dir := t.TempDir()
+	outputs, warning, err := buildAssets(dir, "img/noise.png", content)
+	require.NoError(t, err)
+	assert.Contains(t, warning, "WebP")
+
+	widths := map[int]bool{}
+	for _, out := range outputs {
+		assert.Equal(t, "image/png", out.Type)
+		widths[out.Width] = true
+	}
+	assert.Equal(t, map[int]bool{1200: true, 480: true, 960: true}, widths)
+}
@@ -0,0 +1,138 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"openbook/internal/domain"
+	"openbook/internal/repository"
+	"openbook/internal/service"
+
+	"github.com/google/uuid"
+)
+
+// maxLogBytes caps what is persisted to deployments.logs; later lines are
+// still streamed live but only a truncation notice is stored.
+const maxLogBytes = 1 << 20
+
+// Lines are stored in batches: once logFlushBytes are waiting, or at the
+// latest logFlushInterval after the first waiting line
+const (
+	logFlushBytes    = 64 << 10
+	logFlushInterval = time.Second
+	logFlushTimeout  = 5 * time.Second
+)
+
+// buildLog captures the steps, warnings and errors of one deployment.
+// Lines are appended to deployments.logs in batches, and each batch is
+// published only once stored, so a client reading the stored log and then
+// the live stream never misses a line.
+type buildLog struct {
+	deploymentID uuid.UUID
+	repo         repository.DeploymentRepository
+	stream       *service.LogStream
+
+	mu        sync.Mutex
+	seq       int
+	size      int
+	truncated bool
+	stored    strings.Builder    // text waiting to be appended to deployments.logs
+	events    []service.LogEvent // lines waiting to be published
+	timer     *time.Timer
+}
+
+func newBuildLog(d *domain.Deployment, repo repository.DeploymentRepository, stream *service.LogStream) *buildLog {
+	b := &buildLog{deploymentID: d.ID, repo: repo, stream: stream, size: len(d.Logs)}
+	if d.Logs != "" {
+		b.seq = strings.Count(d.Logs, "\n")
+	}
+	return b
+}
+
+func (b *buildLog) Infof(ctx context.Context, format string, args ...interface{}) {
+	b.write(ctx, "INFO", fmt.Sprintf(format, args...))
+}
+
+func (b *buildLog) Warnf(ctx context.Context, format string, args ...interface{}) {
+	b.write(ctx, "WARN", fmt.Sprintf(format, args...))
+}
+
+func (b *buildLog) Errorf(ctx context.Context, format string, args ...interface{}) {
+	b.write(ctx, "ERROR", fmt.Sprintf(format, args...))
+}
+
+// Flush stores and publishes the waiting lines
+func (b *buildLog) Flush(ctx context.Context) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.flush(ctx)
+}
+
+// Close flushes the log and publishes the final status so live readers can
+// stop streaming
+func (b *buildLog) Close(ctx context.Context, status string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.flush(ctx)
+	if err := b.stream.Publish(ctx, b.deploymentID, service.LogEvent{Seq: b.seq, Status: status}); err != nil {
+		log.Printf("Deployment %s: %v", b.deploymentID, err)
+	}
+}
+
+func (b *buildLog) write(ctx context.Context, level, message string) {
+	log.Printf("Deployment %s: [%s] %s", b.deploymentID, level, message)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	line := fmt.Sprintf("%s [%s] %s", time.Now().UTC().Format(time.RFC3339), level, strings.ReplaceAll(message, "\n", " "))
+	if !b.truncated {
+		stored := line
+		if b.size+len(line)+1 > maxLogBytes {
+			stored = fmt.Sprintf("%s [WARN] log truncated at %d bytes", time.Now().UTC().Format(time.RFC3339), maxLogBytes)
+			b.truncated = true
+		}
+		b.stored.WriteString(stored + "\n")
+		b.size += len(stored) + 1
+	}
+	b.events = append(b.events, service.LogEvent{Seq: b.seq, Line: line})
+	b.seq++
+
+	switch {
+	case b.stored.Len() >= logFlushBytes:
+		b.flush(ctx)
+	case b.timer == nil:
+		b.timer = time.AfterFunc(logFlushInterval, func() {
+			// The build may be done or cancelled by now
+			ctx, cancel := context.WithTimeout(context.Background(), logFlushTimeout)
+			defer cancel()
+			b.Flush(ctx)
+		})
+	}
+}
+
+// flush stores the waiting text in one statement, then publishes the
+// waiting lines. b.mu must be held.
+func (b *buildLog) flush(ctx context.Context) {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	if b.stored.Len() > 0 {
+		if err := b.repo.AppendLogs(ctx, b.deploymentID, b.stored.String()); err != nil {
+			log.Printf("Deployment %s: %v", b.deploymentID, err)
+		}
+		b.stored.Reset()
+	}
+	for _, event := range b.events {
+		if err := b.stream.Publish(ctx, b.deploymentID, event); err != nil {
+			log.Printf("Deployment %s: %v", b.deploymentID, err)
+			break
+		}
+	}
+	b.events = b.events[:0]
+}
@@ -0,0 +1,87 @@
+package worker
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"openbook/internal/domain"
+	"openbook/internal/repository"
+	"openbook/internal/service"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeLogRepo struct {
+	repository.DeploymentRepository
+	mu      sync.Mutex
+	appends []string
+}
+
+func (f *fakeLogRepo) AppendLogs(ctx context.Context, id uuid.UUID, text string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.appends = append(f.appends, text)
+	return nil
+}
+
+func (f *fakeLogRepo) calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.appends...)
+}
+
+// newTestLogStream returns a live log stream that is unreachable;
+// publishing fails and is only logged
+func newTestLogStream(t *testing.T) *service.LogStream {
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1, DialTimeout: 10 * time.Millisecond})
+	t.Cleanup(func() { client.Close() })
+	return service.NewLogStream(client)
+}
+
+func newTestBuildLog(t *testing.T, repo *fakeLogRepo) *buildLog {
+	return newBuildLog(&domain.Deployment{ID: uuid.New()}, repo, newTestLogStream(t))
+}
+
+func TestBuildLog_StoresLinesInBatches(t *testing.T) {
+	repo := &fakeLogRepo{}
+	blog := newTestBuildLog(t, repo)
+	ctx := context.Background()
+
+	for i := 0; i < 50; i++ {
+		blog.Infof(ctx, "step %d", i)
+	}
+	assert.Empty(t, repo.calls(), "lines wait for the flush")
+
+	blog.Close(ctx, "success")
+	calls := repo.calls()
+	require.Len(t, calls, 1)
+	assert.Equal(t, 50, strings.Count(calls[0], "\n"))
+	assert.Contains(t, calls[0], "[INFO] step 49\n")
+	assert.Equal(t, 50, blog.seq)
+}
+
+func TestBuildLog_FlushesAfterInterval(t *testing.T) {
+	repo := &fakeLogRepo{}
+	blog := newTestBuildLog(t, repo)
+
+	blog.Warnf(context.Background(), "slow step")
+	assert.Eventually(t, func() bool { return len(repo.calls()) == 1 }, 3*logFlushInterval, 10*time.Millisecond)
+	assert.Contains(t, repo.calls()[0], "[WARN] slow step")
+}
+
+func TestBuildLog_FlushesLargeBatches(t *testing.T) {
+	repo := &fakeLogRepo{}
+	blog := newTestBuildLog(t, repo)
+
+	line := strings.Repeat("x", 1000)
+	for blog.size < logFlushBytes+len(line) {
+		blog.Infof(context.Background(), "%s", line)
+	}
+	assert.NotEmpty(t, repo.calls(), "a full batch is stored right away")
+}
@@ -0,0 +1,142 @@
+package worker
+
+import (
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// minCompressSize is the smallest output worth precompressing
+const minCompressSize = 1024
+
+// compressibleExts are the text outputs served precompressed
+var compressibleExts = map[string]bool{
+	".html": true, ".htm": true, ".css": true, ".js": true, ".mjs": true, ".json": true,
+	".xml": true, ".txt": true, ".svg": true, ".md": true, ".map": true, ".webmanifest": true,
+}
+
+// compressors write the precompressed variants picked up by the static server
+var compressors = []struct {
+	suffix string
+	wrap   func(io.Writer) io.WriteCloser
+}{
+	{".gz", func(w io.Writer) io.WriteCloser {
+		zw, _ := gzip.NewWriterLevel(w, gzip.BestCompression)
+		return zw
+	}},
+	{".br", func(w io.Writer) io.WriteCloser {
+		return brotli.NewWriterLevel(w, 9)
+	}},
+}
+
+// precompress writes gzip and brotli variants next to the text outputs of a
+// build. Outputs reused from the previous build reuse its variants too.
+// Variants that would not be smaller than the original are skipped.
+func precompress(dir, previousDir string) (int, error) {
+	written := 0
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if strings.HasPrefix(entry.Name(), ".") && path != dir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !compressibleExts[strings.ToLower(filepath.Ext(path))] {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() || info.Size() < minCompressSize {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		reused := false
+		if previousDir != "" {
+			if prevInfo, err := os.Stat(filepath.Join(previousDir, rel)); err == nil && os.SameFile(info, prevInfo) {
+				reused = true
+			}
+		}
+
+		for _, c := range compressors {
+			if reused {
+				if _, err := os.Stat(filepath.Join(previousDir, rel+c.suffix)); err == nil {
+					if err := reuseOutput(previousDir, dir, rel+c.suffix); err != nil {
+						return err
+					}
+					continue
+				}
+			}
+			ok, err := compressFile(path, path+c.suffix, info.Size(), c.wrap)
+			if err != nil {
+				return err
+			}
+			if ok {
+				written++
+			}
+		}
+		return nil
+	})
+	return written, err
+}
+
+// compressFile writes the compressed form of src to dst, keeping it only
+// when it is smaller than the original. dst may be a hard link to the output
+// of an earlier deployment, such as a committed variant, so it is replaced
+// through a rename instead of being written in place.
+func compressFile(src, dst string, size int64, wrap func(io.Writer) io.WriteCloser) (bool, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return false, err
+	}
+	defer in.Close()
+
+	out, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".tmp-*")
+	if err != nil {
+		return false, err
+	}
+	tmp := out.Name()
+	defer os.Remove(tmp)
+
+	zw := wrap(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		zw.Close()
+		out.Close()
+		return false, err
+	}
+	if err := zw.Close(); err != nil {
+		out.Close()
+		return false, err
+	}
+	info, err := out.Stat()
+	if err != nil {
+		out.Close()
+		return false, err
+	}
+	if err := out.Close(); err != nil {
+		return false, err
+	}
+	if info.Size() >= size {
+		if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+			return false, err
+		}
+		return false, nil
+	}
+	if err := os.Chmod(tmp, 0644); err != nil {
+		return false, err
+	}
+	return true, os.Rename(tmp, dst)
+}
@@ -2,141 +2,652 @@ package worker
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
+	"openbook/internal/artifact"
+	"openbook/internal/domain"
+	"openbook/internal/render"
 	"openbook/internal/repository"
+	"openbook/internal/service"
+	"openbook/internal/storage"
 
 	"github.com/google/uuid"
 )
 
 type DeploymentProcessor struct {
-	deploymentRepo repository.DeploymentRepository
-	gitRepo        repository.GitRepository
-	storagePath    string
+	deploymentRepo  repository.DeploymentRepository
+	gitRepo         repository.GitRepository
+	siteRepo        repository.SiteRepository
+	environmentRepo repository.EnvironmentRepository
+	domainRepo      repository.DomainRepository
+	layout          storage.Layout
+	logStream       *service.LogStream
+	artifactFormats []string
 }
 
 func NewDeploymentProcessor(
 	dRepo repository.DeploymentRepository,
 	gRepo repository.GitRepository,
-	storagePath string,
+	sRepo repository.SiteRepository,
+	eRepo repository.EnvironmentRepository,
+	domRepo repository.DomainRepository,
+	layout storage.Layout,
+	logStream *service.LogStream,
+	artifactFormats []string,
 ) *DeploymentProcessor {
 	return &DeploymentProcessor{
-		deploymentRepo: dRepo,
-		gitRepo:        gRepo,
-		storagePath:    storagePath,
+		deploymentRepo:  dRepo,
+		gitRepo:         gRepo,
+		siteRepo:        sRepo,
+		environmentRepo: eRepo,
+		domainRepo:      domRepo,
+		layout:          layout,
+		logStream:       logStream,
+		artifactFormats: artifactFormats,
 	}
 }
 
-func (p *DeploymentProcessor) Process(ctx context.Context, deploymentID uuid.UUID) error {
-	log.Printf("Starting deployment process for ID: %s", deploymentID)
+// sitePage is a rendered HTML page of a deployment
+type sitePage struct {
+	SourcePath   string    `json:"source_path"`
+	OutputPath   string    `json:"output_path"`
+	Path         string    `json:"path"` // pretty URL path, e.g. "/guide/intro"
+	URL          string    `json:"url"`
+	Title        string    `json:"title"`
+	Text         string    `json:"text"`
+	Links        []string  `json:"links,omitempty"` // internal URL paths linked from the page
+	LastModified time.Time `json:"last_modified"`
+	Templated    bool      `json:"templated"` // rendered into the site layout
+	// LinkRefs and Anchors feed the link checker: every internal link with
+	// its location, and the fragment identifiers the page defines
+	LinkRefs []pageLink `json:"link_refs,omitempty"`
+	Anchors  []string   `json:"anchors,omitempty"`
+}
+
+// pageLink is an internal link found on a page
+type pageLink struct {
+	Href     string `json:"href"`
+	Target   string `json:"target"` // pretty URL path
+	Fragment string `json:"fragment,omitempty"`
+	Block    string `json:"block,omitempty"` // heading of the section the link is in
+}
 
+func (p *DeploymentProcessor) Process(ctx context.Context, deploymentID uuid.UUID) error {
 	// 1. Fetch deployment
 	deployment, err := p.deploymentRepo.GetByID(ctx, deploymentID)
 	if err != nil {
 		return fmt.Errorf("failed to get deployment: %w", err)
 	}
 
+	blog := newBuildLog(deployment, p.deploymentRepo, p.logStream)
+	blog.Infof(ctx, "Starting deployment of commit %s", deployment.CommitHash)
+
 	// 2. Update status to building
 	if err := p.deploymentRepo.UpdateStatus(ctx, deployment.ID, "building"); err != nil {
 		return fmt.Errorf("failed to update status to building: %w", err)
 	}
 
-	// 3. Resolve commit and tree
-	// Note: CommitHash in Deployment is a string, but GetCommit expects UUID?
-	// The models say CommitHash string. The repository GetCommit expects UUID.
-	// This is a mismatch. Let's assume CommitHash in deployment is the UUID of the commit for now, or fix repository.
-	// Looking at models.go from previous turn: CommitHash string.
-	// Looking at repository/postgres/git_repository.go: GetCommit(ctx, id uuid.UUID).
-	// So CommitHash should be a UUID string.
+	publish := p.build
+	if deployment.SourceDeploymentID != nil {
+		publish = p.promote
+	}
+	url, err := publish(ctx, deployment, blog)
+	if err != nil {
+		if ctx.Err() != nil {
+			if errors.Is(context.Cause(ctx), errCancelled) {
+				p.cancelDeployment(deployment, blog)
+				return fmt.Errorf("%w: %v", errCancelled, err)
+			}
+			p.interruptDeployment(deployment, blog)
+			return fmt.Errorf("%w: %v", errInterrupted, err)
+		}
+		p.failDeployment(ctx, deployment, blog, err)
+		return err
+	}
+
+	// 8. Record the output and mark the deployment successful. The build is
+	// live at this point, so a late cancellation no longer applies.
+	ctx = context.WithoutCancel(ctx)
+	if err := p.deploymentRepo.MarkSuccess(ctx, deployment.ID, p.layout.DeploymentDir(deployment), url); err != nil {
+		return fmt.Errorf("failed to update status to success: %w", err)
+	}
 
+	blog.Infof(ctx, "Deployment completed successfully")
+	blog.Close(ctx, "success")
+	return nil
+}
+
+// build renders the deployment's commit and publishes it to its environment.
+// It returns the public URL the build is served at.
+func (p *DeploymentProcessor) build(ctx context.Context, deployment *domain.Deployment, blog *buildLog) (string, error) {
+	// 3. Resolve commit and tree
+	// CommitHash in Deployment holds the UUID of the commit to publish.
 	commitUUID, err := uuid.Parse(deployment.CommitHash)
 	if err != nil {
-		p.failDeployment(ctx, deployment.ID, fmt.Errorf("invalid commit hash: %w", err))
-		return err
+		return "", fmt.Errorf("%w: invalid commit hash: %v", domain.ErrInvalidInput, err)
 	}
 
 	commit, err := p.gitRepo.GetCommit(ctx, commitUUID)
 	if err != nil {
-		p.failDeployment(ctx, deployment.ID, fmt.Errorf("failed to get commit: %w", err))
-		return err
+		return "", fmt.Errorf("failed to get commit: %w", err)
+	}
+	// Queued and scheduled rows are checked again: only their creation
+	// went through the use case
+	if err := deployment.ValidateCommit(commit); err != nil {
+		return "", err
 	}
 
-	// 4. Build and Save
-	siteStoragePath := filepath.Join(p.storagePath, deployment.WorkspaceID.String(), deployment.SiteID.String(), deployment.CommitHash)
+	// 4. Resolve site, environment and the public base URL
+	site, err := p.siteRepo.GetByID(ctx, deployment.SiteID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get site: %w", err)
+	}
+
+	env, err := p.environmentRepo.GetByID(ctx, deployment.EnvironmentID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get environment: %w", err)
+	}
+
+	domains, err := p.domainRepo.ListBySite(ctx, site.ID)
+	if err != nil {
+		return "", fmt.Errorf("failed to list domains: %w", err)
+	}
+	baseURL := siteBaseURL(site, env, domains)
+	if baseURL == "" {
+		blog.Warnf(ctx, "Environment %s has no URL or active domain, generated links will be relative", env.Name)
+	}
+
+	// 5. Build into a staging directory; it only becomes visible once complete
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	siteStoragePath := p.layout.StagingDir(deployment)
+	if err := os.RemoveAll(siteStoragePath); err != nil {
+		return "", fmt.Errorf("failed to clear staging dir: %w", err)
+	}
 	if err := os.MkdirAll(siteStoragePath, 0755); err != nil {
-		p.failDeployment(ctx, deployment.ID, fmt.Errorf("failed to create storage dir: %w", err))
-		return err
+		return "", fmt.Errorf("failed to create storage dir: %w", err)
 	}
 
 	// Fetch all tree entries for this commit
 	trees, err := p.gitRepo.GetTree(ctx, commit.ID)
 	if err != nil {
-		p.failDeployment(ctx, deployment.ID, fmt.Errorf("failed to get tree: %w", err))
-		return err
+		return "", fmt.Errorf("failed to get tree: %w", err)
 	}
+	blog.Infof(ctx, "Building %d tree entries of site %s for environment %s", len(trees), site.Name, env.Name)
 
+	// Only paths whose blob changed since the last successful build of this
+	// environment are fetched and rendered; the rest is reused from its output.
+	previous := p.findPreviousBuild(ctx, deployment, site, baseURL, blog)
+	if previous != nil {
+		blog.Infof(ctx, "Incremental build on top of deployment %s", previous.deployment.ID)
+	}
+	manifest := &buildManifest{
+		Version:  buildFormatVersion,
+		CommitID: commit.ID.String(),
+		SiteName: site.Name,
+		BaseURL:  baseURL,
+		Files:    make(map[string]buildFile, len(trees)),
+	}
+	sources := make(map[string][]byte)
+	var changed []domain.Tree
 	for _, treeNode := range trees {
-		if treeNode.Type == "blob" {
-			// Fetch blob content
-			blob, err := p.gitRepo.GetBlob(ctx, treeNode.BlobHash)
-			if err != nil {
-				p.failDeployment(ctx, deployment.ID, fmt.Errorf("failed to get blob %s: %w", treeNode.BlobHash, err))
-				return err
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		if treeNode.Type != "blob" {
+			continue
+		}
+		// Paths are validated at commit time; trees stored before that are
+		// checked again so a path can never escape the staging directory
+		if err := domain.ValidateTreePath(treeNode.Path); err != nil {
+			return "", err
+		}
+		if previous != nil {
+			if prevFile, ok := previous.manifest.Files[treeNode.Path]; ok && prevFile.BlobHash == treeNode.BlobHash {
+				manifest.Files[treeNode.Path] = prevFile
+				continue
 			}
+		}
 
-			// Determine full path
-			// Assuming treeNode.Path is relative to site root, e.g., "index.html" or "docs/page.md"
-			fullPath := filepath.Join(siteStoragePath, treeNode.Path)
+		content, err := p.blobContent(ctx, treeNode.BlobHash)
+		if err != nil {
+			return "", fmt.Errorf("failed to get blob %s: %w", treeNode.BlobHash, err)
+		}
+		file, _ := describeFile(treeNode, content, baseURL, nil)
+		manifest.Files[treeNode.Path] = file
+		sources[treeNode.Path] = content
+		changed = append(changed, treeNode)
+	}
+
+	lastModified, err := p.lastModified(ctx, commit, changed)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve file history: %w", err)
+	}
+	for path, modified := range lastModified {
+		if file := manifest.Files[path]; file.Page != nil {
+			file.Page.LastModified = modified
+		}
+	}
+
+	pages := manifest.pages()
+	nav := navigation(pages)
+	links := backlinks(pages)
+	titles := make(map[string]string, len(pages))
+	for _, page := range pages {
+		titles[page.Path] = page.Title
+	}
+
+	// Static assets are published under fingerprinted names first, so pages
+	// can reference them. Pages whose assets got a new name are re-rendered.
+	written := make(map[string]bool)
+	if err := p.processAssets(ctx, siteStoragePath, previous, manifest, sources, written, blog); err != nil {
+		return "", err
+	}
+	assets := assetsByURL(manifest)
+	var prevManifest *buildManifest
+	if previous != nil {
+		prevManifest = previous.manifest
+	}
+	stale := staleOutputs(manifest, prevManifest)
 
-			// Ensure directory exists
-			if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
-				p.failDeployment(ctx, deployment.ID, fmt.Errorf("failed to create dir for %s: %w", treeNode.Path, err))
-				return err
+	paths := make([]string, 0, len(manifest.Files))
+	for path := range manifest.Files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	reused := 0
+	for _, path := range paths {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		file := manifest.Files[path]
+		written[file.OutputPath] = true
+
+		content, isChanged := sources[path]
+		if !stale[path] {
+			if err := reuseOutput(previous.dir, siteStoragePath, file.OutputPath); err != nil {
+				return "", fmt.Errorf("failed to reuse %s: %w", path, err)
 			}
+			reused++
+			continue
+		}
 
-			// Write file
-			// content_json in Blob is json.RawMessage. We probably want the raw content.
-			// If it's JSON encoded, we might need to decode it.
-			// But for "Construir HTML real", maybe the blob IS the content?
-			// Or maybe we need to render it?
-			// CONTEXTO3: "Construir HTML real".
-			// If the blob is Markdown, we should convert to HTML.
-			// For now, let's just write the content as is (or unquoted JSON string).
-
-			var content string
-			if err := json.Unmarshal(blob.ContentJSON, &content); err != nil {
-				// If not a JSON string, maybe it's just raw JSON?
-				// Write raw bytes
-				content = string(blob.ContentJSON)
+		if !isChanged {
+			if content, err = p.blobContent(ctx, file.BlobHash); err != nil {
+				return "", fmt.Errorf("failed to get blob %s: %w", file.BlobHash, err)
 			}
+		}
 
-			// Simple HTML wrapper if it's markdown (naive implementation)
-			if filepath.Ext(treeNode.Path) == ".md" {
-				fullPath = fullPath[0:len(fullPath)-3] + ".html"
-				content = fmt.Sprintf("<html><body><pre>%s</pre></body></html>", content)
+		output := content
+		if file.Page != nil && file.Page.Templated {
+			_, doc := describeFile(domain.Tree{Path: path, BlobHash: file.BlobHash}, content, baseURL, assets)
+			output, err = render.Page(render.PageData{
+				SiteName:     site.Name,
+				Title:        file.Page.Title,
+				CanonicalURL: file.Page.URL,
+				Body:         doc.HTML,
+				Navigation:   navItems(nav, file.Page.Path, basePath(baseURL)),
+				Backlinks:    backlinkItems(links[file.Page.Path], titles, basePath(baseURL)),
+			})
+			if err != nil {
+				return "", fmt.Errorf("failed to render %s: %w", path, err)
 			}
+		}
+
+		if err := writeOutput(siteStoragePath, file.OutputPath, output); err != nil {
+			return "", fmt.Errorf("failed to write file %s: %w", path, err)
+		}
+	}
+	blog.Infof(ctx, "Wrote %d files, reused %d unchanged files", len(paths)-reused, reused)
+	reportOversizedAssets(ctx, siteStoragePath, manifest, blog)
+	if err := p.writeWhatsNew(ctx, siteStoragePath, deployment, site, manifest, baseURL, written, blog); err != nil {
+		return "", fmt.Errorf("failed to write What's new page: %w", err)
+	}
+
+	// 6. Generate sitemap, robots.txt, feed and LLM digests
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if err := writeSEOFiles(siteStoragePath, site, baseURL, pages, commit.CreatedAt, written); err != nil {
+		return "", fmt.Errorf("failed to generate site metadata: %w", err)
+	}
+	if err := p.reportBrokenLinks(ctx, site, pages, written, blog); err != nil {
+		return "", err
+	}
+	if err := writeManifest(siteStoragePath, manifest); err != nil {
+		return "", fmt.Errorf("failed to write build manifest: %w", err)
+	}
+
+	if baseURL == "" {
+		blog.Infof(ctx, "Generated robots.txt and llms.txt for %d pages, without sitemap.xml and feed.xml as there is no base URL", len(pages))
+	} else {
+		blog.Infof(ctx, "Generated sitemap.xml, robots.txt, feed.xml and llms.txt for %d pages", len(pages))
+	}
+
+	// Text outputs get gzip and brotli variants for the static server
+	previousDir := ""
+	if previous != nil {
+		previousDir = previous.dir
+	}
+	compressed, err := precompress(siteStoragePath, previousDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to precompress outputs: %w", err)
+	}
+	blog.Infof(ctx, "Precompressed %d files", compressed)
+
+	if err := p.storeArtifacts(ctx, siteStoragePath, blog); err != nil {
+		return "", err
+	}
+	if err := p.storeExports(ctx, siteStoragePath, site, commit, manifest, sources, assets, blog); err != nil {
+		return "", err
+	}
 
-			if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
-				p.failDeployment(ctx, deployment.ID, fmt.Errorf("failed to write file %s: %w", treeNode.Path, err))
-				return err
+	// 7. Publish: move the build in place and swap the environment's live pointer
+	if err := p.publish(ctx, deployment, env, blog); err != nil {
+		return "", err
+	}
+	return baseURL, nil
+}
+
+// reportBrokenLinks logs the internal links of the build that lead nowhere
+// and fails the build when the site does not accept broken links
+func (p *DeploymentProcessor) reportBrokenLinks(ctx context.Context, site *domain.Site, pages []sitePage, outputs map[string]bool, blog *buildLog) error {
+	broken := checkLinks(pages, outputs)
+	if len(broken) == 0 {
+		blog.Infof(ctx, "Checked internal links of %d pages, none broken", len(pages))
+		return nil
+	}
+
+	report := blog.Warnf
+	if site.BrokenLinks == domain.BrokenLinksFail {
+		report = blog.Errorf
+	}
+	for i, link := range broken {
+		if i == maxReportedLinks {
+			report(ctx, "... and %d more broken links", len(broken)-maxReportedLinks)
+			break
+		}
+		location := link.Page
+		if link.Block != "" {
+			location += ` in section "` + link.Block + `"`
+		}
+		report(ctx, "Broken link on %s: %s (%s)", location, link.Href, link.Reason)
+	}
+
+	if site.BrokenLinks == domain.BrokenLinksFail {
+		return fmt.Errorf("%w: %d broken internal links", domain.ErrInvalidInput, len(broken))
+	}
+	blog.Warnf(ctx, "Found %d broken internal links", len(broken))
+	return nil
+}
+
+// storeArtifacts prebuilds the configured downloadable archives of a build
+func (p *DeploymentProcessor) storeArtifacts(ctx context.Context, dir string, blog *buildLog) error {
+	formats := archiveFormats(p.artifactFormats)
+	if len(formats) == 0 {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	manifest, err := artifact.Store(dir, formats)
+	if err != nil {
+		return err
+	}
+	blog.Infof(ctx, "Packaged %d files as %s", len(manifest.Files), strings.Join(formats, ", "))
+	return nil
+}
+
+// publish moves a complete staging directory in place and swaps the
+// environment's live pointer. This is the last point where a build can be
+// aborted.
+func (p *DeploymentProcessor) publish(ctx context.Context, deployment *domain.Deployment, env *domain.Environment, blog *buildLog) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := deployment.ValidateEnvironment(env); err != nil {
+		return err
+	}
+	ctx = context.WithoutCancel(ctx)
+	if err := p.layout.Finalize(deployment); err != nil {
+		return err
+	}
+	if err := p.layout.Activate(deployment); err != nil {
+		return err
+	}
+	if err := p.environmentRepo.SetLiveDeployment(ctx, env.ID, deployment.ID); err != nil {
+		return err
+	}
+	blog.Infof(ctx, "Published to environment %s", env.Name)
+	return nil
+}
+
+func (p *DeploymentProcessor) failDeployment(ctx context.Context, d *domain.Deployment, blog *buildLog, err error) {
+	blog.Errorf(ctx, "Deployment failed: %v", err)
+	if err := p.deploymentRepo.MarkFailed(ctx, d.ID, err.Error()); err != nil {
+		log.Printf("Failed to mark deployment %s failed: %v", d.ID, err)
+	}
+	_ = os.RemoveAll(p.layout.StagingDir(d))
+	blog.Close(ctx, "failed")
+}
+
+// cancelDeployment records a build aborted on request and removes its
+// partial output
+func (p *DeploymentProcessor) cancelDeployment(d *domain.Deployment, blog *buildLog) {
+	ctx, cancel := context.WithTimeout(context.Background(), interruptTimeout)
+	defer cancel()
+
+	blog.Warnf(ctx, "Deployment cancelled")
+	if err := p.deploymentRepo.UpdateStatus(ctx, d.ID, "cancelled"); err != nil {
+		log.Printf("Failed to mark deployment %s cancelled: %v", d.ID, err)
+	}
+	_ = os.RemoveAll(p.layout.StagingDir(d))
+	blog.Close(ctx, "cancelled")
+}
+
+// interruptDeployment puts a deployment whose build was cut short by a
+// shutdown back to pending. The build context is already cancelled, so the
+// bookkeeping runs on its own short-lived context.
+func (p *DeploymentProcessor) interruptDeployment(d *domain.Deployment, blog *buildLog) {
+	ctx, cancel := context.WithTimeout(context.Background(), interruptTimeout)
+	defer cancel()
+
+	blog.Warnf(ctx, "Build interrupted by worker shutdown, it will be resumed by another worker")
+	blog.Flush(ctx)
+	if err := p.deploymentRepo.UpdateStatus(ctx, d.ID, "pending"); err != nil {
+		log.Printf("Failed to reset interrupted deployment %s: %v", d.ID, err)
+	}
+	_ = os.RemoveAll(p.layout.StagingDir(d))
+}
+
+// blobContent returns the file content stored in a blob
+func (p *DeploymentProcessor) blobContent(ctx context.Context, hash string) ([]byte, error) {
+	blob, err := p.gitRepo.GetBlob(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	return domain.DecodeBlobContent(blob.ContentJSON), nil
+}
+
+// describeFile computes the output path and page metadata of a tree entry.
+// The returned document is nil for files that are not pages. Links and
+// images pointing to one of the static assets, keyed by URL path, are
+// rendered with their fingerprinted outputs. Internal links are emitted below
+// the path of the base URL, so that sites mounted in a subdirectory work.
+func describeFile(treeNode domain.Tree, content []byte, baseURL string, assets map[string][]assetOutput) (buildFile, *render.Document) {
+	file := buildFile{BlobHash: treeNode.BlobHash, OutputPath: treeNode.Path}
+
+	ext := strings.ToLower(filepath.Ext(treeNode.Path))
+	templated := ext == ".md"
+	if templated {
+		file.OutputPath = strings.TrimSuffix(treeNode.Path, filepath.Ext(treeNode.Path)) + ".html"
+	}
+	urlPath := pageURLPath(file.OutputPath)
+	base := basePath(baseURL)
+
+	var doc *render.Document
+	switch ext {
+	case ".md":
+		doc = render.Markdown(content, func(href string) string {
+			if target, fragment, ok := resolveInternalLink(urlPath, href); ok && fragment == "" && len(assets[target]) > 0 {
+				return base + "/" + assets[target][0].Path
 			}
+			return rewriteInternalLink(urlPath, href, base)
+		}, func(src string) *render.Image {
+			if target, _, ok := resolveInternalLink(urlPath, src); ok {
+				return responsiveImage(assets[target], base)
+			}
+			return nil
+		})
+	case ".html", ".htm":
+		doc = render.HTMLSource(content)
+	default:
+		return file, nil
+	}
+
+	page := &sitePage{
+		SourcePath: treeNode.Path,
+		OutputPath: file.OutputPath,
+		Path:       urlPath,
+		URL:        baseURL + urlPath,
+		Title:      doc.Title,
+		Text:       doc.Text,
+		Templated:  templated,
+	}
+	if page.Title == "" {
+		page.Title = strings.TrimSuffix(filepath.Base(treeNode.Path), filepath.Ext(treeNode.Path))
+	}
+	seen := make(map[string]bool)
+	for _, link := range doc.Links {
+		target, fragment, ok := resolveInternalLink(urlPath, link.Href)
+		if !ok {
+			continue
+		}
+		page.LinkRefs = append(page.LinkRefs, pageLink{Href: link.Href, Target: target, Fragment: fragment, Block: link.Block})
+		if !seen[target] && !link.Image {
+			seen[target] = true
+			page.Links = append(page.Links, target)
 		}
 	}
+	page.Anchors = doc.Anchors
+	file.Page = page
+	return file, doc
+}
 
-	// 5. Update status to success
-	if err := p.deploymentRepo.UpdateStatus(ctx, deployment.ID, "success"); err != nil {
-		return fmt.Errorf("failed to update status to success: %w", err)
+func navItems(nav []navEntry, current, base string) []render.NavItem {
+	items := make([]render.NavItem, 0, len(nav))
+	for _, entry := range nav {
+		items = append(items, render.NavItem{Title: entry.Title, URL: base + entry.Path, Active: entry.Path == current})
+	}
+	return items
+}
+
+func backlinkItems(sources []string, titles map[string]string, base string) []render.NavItem {
+	items := make([]render.NavItem, 0, len(sources))
+	for _, source := range sources {
+		items = append(items, render.NavItem{Title: titles[source], URL: base + source})
+	}
+	return items
+}
+
+// writeOutput writes a file below the deployment root, creating parent directories
+func writeOutput(root, relPath string, content []byte) error {
+	fullPath, err := outputPath(root, relPath)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return err
+	}
+	// An existing file may be a hard link to the output of an earlier
+	// deployment; unlink it instead of writing through it
+	if err := os.Remove(fullPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.WriteFile(fullPath, content, 0644)
+}
+
+// outputPath joins a relative output path to a build directory, refusing
+// paths that would resolve outside of it
+func outputPath(root, relPath string) (string, error) {
+	fullPath := filepath.Join(root, relPath)
+	rel, err := filepath.Rel(root, fullPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(relPath) {
+		return "", fmt.Errorf("%w: output path %q escapes the build directory", domain.ErrInvalidInput, relPath)
+	}
+	return fullPath, nil
+}
+
+// pageURLPath maps an output file to its pretty URL path ("guide/intro.html" -> "/guide/intro")
+func pageURLPath(outputPath string) string {
+	urlPath := "/" + filepath.ToSlash(outputPath)
+	urlPath = strings.TrimSuffix(urlPath, ".html")
+	urlPath = strings.TrimSuffix(urlPath, ".htm")
+	if urlPath == "/index" || strings.HasSuffix(urlPath, "/index") {
+		urlPath = strings.TrimSuffix(urlPath, "index")
+	}
+	return urlPath
+}
+
+// siteBaseURL resolves the public origin of an environment.
+// The default environment is served from the site's primary active custom
+// domain, or else from its first active subdirectory domain; every other
+// environment uses its own URL.
+func siteBaseURL(site *domain.Site, env *domain.Environment, domains []domain.Domain) string {
+	if env.Name == site.DefaultEnvironment {
+		for _, kind := range []string{"custom", "subdirectory"} {
+			for _, d := range domains {
+				if d.Type == kind && d.Status == domain.DomainActive {
+					return "https://" + d.Domain
+				}
+			}
+		}
+	}
+	if env.URL == "" {
+		return ""
+	}
+	base := strings.TrimSuffix(env.URL, "/")
+	if !strings.Contains(base, "://") {
+		base = "https://" + base
 	}
+	return base
+}
 
-	log.Printf("Deployment %s completed successfully", deploymentID)
+// Supersede skips a queued deployment because a newer one of the same
+// environment will publish over it anyway
+func (p *DeploymentProcessor) Supersede(ctx context.Context, d *domain.Deployment, newer *domain.Deployment) error {
+	blog := newBuildLog(d, p.deploymentRepo, p.logStream)
+	blog.Warnf(ctx, "Superseded by newer deployment %s, skipping build", newer.ID)
+	if err := p.deploymentRepo.UpdateStatus(ctx, d.ID, "cancelled"); err != nil {
+		blog.Flush(ctx)
+		return fmt.Errorf("failed to update status to cancelled: %w", err)
+	}
+	blog.Close(ctx, "cancelled")
 	return nil
 }
 
-func (p *DeploymentProcessor) failDeployment(ctx context.Context, id uuid.UUID, err error) {
-	log.Printf("Deployment %s failed: %v", id, err)
-	_ = p.deploymentRepo.UpdateStatus(ctx, id, "failed")
+// Fail marks a deployment that will not be retried as failed, unless it
+// already finished, so that it is not requeued as interrupted later
+func (p *DeploymentProcessor) Fail(ctx context.Context, id uuid.UUID, cause error) error {
+	d, err := p.deploymentRepo.GetByID(ctx, id)
+	if errors.Is(err, domain.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get deployment: %w", err)
+	}
+	if d.IsFinished() {
+		return nil
+	}
+	p.failDeployment(ctx, d, newBuildLog(d, p.deploymentRepo, p.logStream), cause)
+	return nil
 }
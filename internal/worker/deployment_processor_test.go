@@ -0,0 +1,164 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"openbook/internal/domain"
+	"openbook/internal/repository"
+	"openbook/internal/storage"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDeploymentRepo records the statuses a deployment goes through
+type fakeDeploymentRepo struct {
+	fakeLogRepo
+	deployment *domain.Deployment
+	statuses   []string
+	failure    string
+}
+
+func (f *fakeDeploymentRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.Deployment, error) {
+	if id != f.deployment.ID {
+		return nil, fmt.Errorf("deployment %w", domain.ErrNotFound)
+	}
+	return f.deployment, nil
+}
+
+func (f *fakeDeploymentRepo) UpdateStatus(ctx context.Context, id uuid.UUID, status string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f.statuses = append(f.statuses, status)
+	return nil
+}
+
+func (f *fakeDeploymentRepo) MarkFailed(ctx context.Context, id uuid.UUID, message string) error {
+	f.statuses = append(f.statuses, "failed")
+	f.failure = message
+	return nil
+}
+
+// blockingGit stands for a build in progress: reading the commit waits
+// until the build is stopped, or fails with err
+type blockingGit struct {
+	repository.GitRepository
+	err error
+}
+
+func (g *blockingGit) GetCommit(ctx context.Context, id uuid.UUID) (*domain.Commit, error) {
+	if g.err != nil {
+		return nil, g.err
+	}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func newTestProcessor(t *testing.T, repo *fakeDeploymentRepo, git repository.GitRepository) *DeploymentProcessor {
+	return NewDeploymentProcessor(repo, git, nil, nil, nil, storage.NewLayout(t.TempDir()), newTestLogStream(t), nil)
+}
+
+func TestDeploymentProcessor_Process_Stopped(t *testing.T) {
+	tests := []struct {
+		name     string
+		stop     func(cancel context.CancelCauseFunc)
+		gitErr   error
+		wantErr  error
+		statuses []string
+		log      string
+	}{
+		{
+			name:     "cancel signal",
+			stop:     func(cancel context.CancelCauseFunc) { cancel(errCancelled) },
+			wantErr:  errCancelled,
+			statuses: []string{"building", "cancelled"},
+			log:      "[WARN] Deployment cancelled",
+		},
+		{
+			name:     "worker shutdown",
+			stop:     func(cancel context.CancelCauseFunc) { cancel(nil) },
+			wantErr:  errInterrupted,
+			statuses: []string{"building", "pending"},
+			log:      "[WARN] Build interrupted by worker shutdown",
+		},
+		{
+			name:     "build failure",
+			gitErr:   fmt.Errorf("commit %w", domain.ErrNotFound),
+			wantErr:  domain.ErrNotFound,
+			statuses: []string{"building", "failed"},
+			log:      "[ERROR] Deployment failed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &domain.Deployment{ID: uuid.New(), CommitHash: uuid.NewString(), Status: "pending"}
+			repo := &fakeDeploymentRepo{deployment: d}
+			p := newTestProcessor(t, repo, &blockingGit{err: tt.gitErr})
+
+			ctx, cancel := context.WithCancelCause(context.Background())
+			defer cancel(nil)
+			if tt.stop != nil {
+				time.AfterFunc(10*time.Millisecond, func() { tt.stop(cancel) })
+			}
+
+			err := p.Process(ctx, d.ID)
+			assert.True(t, errors.Is(err, tt.wantErr), "%v", err)
+			assert.Equal(t, tt.statuses, repo.statuses)
+			assert.Contains(t, strings.Join(repo.calls(), ""), tt.log)
+		})
+	}
+}
+
+func TestDeploymentProcessor_Supersede(t *testing.T) {
+	d := &domain.Deployment{ID: uuid.New(), Status: "pending"}
+	newer := &domain.Deployment{ID: uuid.New(), Status: "pending"}
+	repo := &fakeDeploymentRepo{deployment: d}
+	p := newTestProcessor(t, repo, nil)
+
+	require.NoError(t, p.Supersede(context.Background(), d, newer))
+	assert.Equal(t, []string{"cancelled"}, repo.statuses)
+	calls := repo.calls()
+	require.Len(t, calls, 1, "the log is stored once")
+	assert.Contains(t, calls[0], "Superseded by newer deployment "+newer.ID.String())
+}
+
+func TestIsPermanent(t *testing.T) {
+	tests := []struct {
+		err       error
+		permanent bool
+	}{
+		{fmt.Errorf("commit %w", domain.ErrNotFound), true},
+		{fmt.Errorf("%w: invalid commit hash", domain.ErrInvalidInput), true},
+		{fmt.Errorf("failed to get tree: %w", errors.New("connection reset")), false},
+		{fmt.Errorf("%w: deployment cannot go from success to building", domain.ErrConflict), false},
+		{context.DeadlineExceeded, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.permanent, isPermanent(tt.err), tt.err.Error())
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempt int
+		delay   time.Duration
+	}{
+		{0, retryBaseDelay},
+		{1, retryBaseDelay},
+		{2, 2 * retryBaseDelay},
+		{3, 4 * retryBaseDelay},
+		{6, 32 * retryBaseDelay},
+		{7, retryMaxDelay},
+		{100, retryMaxDelay},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.delay, retryDelay(tt.attempt), "attempt %d", tt.attempt)
+	}
+}
@@ -0,0 +1,122 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"openbook/internal/artifact"
+	"openbook/internal/domain"
+	"openbook/internal/export"
+)
+
+// exportFormats returns the export formats among the configured artifacts
+func exportFormats(formats []string) []string {
+	var exports []string
+	for _, format := range formats {
+		if artifact.IsExport(format) {
+			exports = append(exports, format)
+		}
+	}
+	return exports
+}
+
+// archiveFormats returns the archive formats among the configured artifacts
+func archiveFormats(formats []string) []string {
+	var archives []string
+	for _, format := range formats {
+		if !artifact.IsExport(format) {
+			archives = append(archives, format)
+		}
+	}
+	return archives
+}
+
+// storeExports assembles the pages of a build into the configured export
+// formats. Templated pages contribute their rendered body, HTML pages their
+// own content; images are read back from the build output.
+func (p *DeploymentProcessor) storeExports(ctx context.Context, dir string, site *domain.Site, commit *domain.Commit, manifest *buildManifest, sources map[string][]byte, assets map[string][]assetOutput, blog *buildLog) error {
+	formats := exportFormats(p.artifactFormats)
+	if len(formats) == 0 {
+		return nil
+	}
+
+	book := &export.Book{
+		Title:      site.Name,
+		Identifier: "urn:uuid:" + commit.ID.String(),
+		Modified:   commit.CreatedAt,
+		Resource: func(urlPath string) ([]byte, error) {
+			rel := strings.TrimPrefix(path.Clean("/"+urlPath), "/")
+			// Dot directories hold the build manifest and artifacts
+			for _, segment := range strings.Split(rel, "/") {
+				if strings.HasPrefix(segment, ".") {
+					return nil, os.ErrNotExist
+				}
+			}
+			full, err := outputPath(dir, filepath.FromSlash(rel))
+			if err != nil {
+				return nil, err
+			}
+			return os.ReadFile(full)
+		},
+	}
+	for _, page := range manifest.pages() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		file := manifest.Files[page.SourcePath]
+		content, ok := sources[page.SourcePath]
+		if !ok {
+			var err error
+			if content, err = p.blobContent(ctx, file.BlobHash); err != nil {
+				return fmt.Errorf("failed to get blob %s: %w", file.BlobHash, err)
+			}
+		}
+		body := string(content)
+		if page.Templated {
+			_, doc := describeFile(domain.Tree{Path: page.SourcePath, BlobHash: file.BlobHash}, content, "", assets)
+			body = doc.HTML
+		}
+		book.Chapters = append(book.Chapters, export.Chapter{Title: page.Title, Path: page.Path, HTML: body})
+	}
+
+	for _, format := range formats {
+		write := export.WriteEPUB
+		if format == artifact.FormatPDF {
+			write = export.WritePDF
+		}
+		err := artifact.StoreFile(dir, format, func(w io.Writer) error {
+			return write(w, book)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to export %s: %w", format, err)
+		}
+	}
+	blog.Infof(ctx, "Exported %d pages as %s", len(book.Chapters), strings.Join(formats, ", "))
+	return nil
+}
+
+// linkExports reuses the exports of a promoted deployment; they do not
+// depend on the base URL
+func (p *DeploymentProcessor) linkExports(ctx context.Context, source *domain.Deployment, sourceDir, dir string, blog *buildLog) error {
+	for _, format := range exportFormats(p.artifactFormats) {
+		if _, err := artifact.Checksum(sourceDir, format); err != nil {
+			blog.Warnf(ctx, "Deployment %s has no %s export", source.ID, format)
+			continue
+		}
+		rel, err := filepath.Rel(sourceDir, artifact.Path(sourceDir, format))
+		if err != nil {
+			return err
+		}
+		for _, name := range []string{rel, rel + ".sha256"} {
+			if err := reuseOutput(sourceDir, dir, name); err != nil {
+				return fmt.Errorf("failed to reuse %s export: %w", format, err)
+			}
+		}
+	}
+	return nil
+}
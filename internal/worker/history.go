@@ -0,0 +1,57 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"openbook/internal/domain"
+)
+
+// maxHistoryDepth bounds how many ancestors are inspected to date a path
+const maxHistoryDepth = 500
+
+// lastModified returns, for every blob path of the commit, the time of the
+// most recent commit on its first-parent history that changed the path.
+func (p *DeploymentProcessor) lastModified(ctx context.Context, commit *domain.Commit, trees []domain.Tree) (map[string]time.Time, error) {
+	result := make(map[string]time.Time, len(trees))
+	pending := make(map[string]string, len(trees))
+	for _, t := range trees {
+		if t.Type == "blob" {
+			pending[t.Path] = t.BlobHash
+		}
+	}
+
+	current := commit
+	for depth := 0; len(pending) > 0; depth++ {
+		if current.ParentHash == nil || depth >= maxHistoryDepth {
+			for path := range pending {
+				result[path] = current.CreatedAt
+			}
+			break
+		}
+
+		parent, err := p.gitRepo.GetCommit(ctx, *current.ParentHash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get parent commit: %w", err)
+		}
+		parentTrees, err := p.gitRepo.GetTree(ctx, parent.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get parent tree: %w", err)
+		}
+
+		parentBlobs := make(map[string]string, len(parentTrees))
+		for _, t := range parentTrees {
+			parentBlobs[t.Path] = t.BlobHash
+		}
+		for path, hash := range pending {
+			if parentBlobs[path] != hash {
+				result[path] = current.CreatedAt
+				delete(pending, path)
+			}
+		}
+		current = parent
+	}
+
+	return result, nil
+}
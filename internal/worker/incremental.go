@@ -0,0 +1,224 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"openbook/internal/domain"
+)
+
+// buildFormatVersion is bumped whenever the rendered output changes shape,
+// so that outputs of older deployments are never reused.
+const buildFormatVersion = 3
+
+// manifestPath is where a deployment records what it built, relative to its output root
+const manifestPath = ".openbook/manifest.json"
+
+// buildManifest describes the output of a deployment so the next build of the
+// same environment can reuse whatever did not change.
+type buildManifest struct {
+	Version  int                  `json:"version"`
+	CommitID string               `json:"commit_id"`
+	SiteName string               `json:"site_name"`
+	BaseURL  string               `json:"base_url"`
+	Files    map[string]buildFile `json:"files"` // keyed by tree path
+}
+
+type buildFile struct {
+	BlobHash   string    `json:"blob_hash"`
+	OutputPath string    `json:"output_path"`
+	Page       *sitePage `json:"page,omitempty"`
+	// Assets are the fingerprinted outputs of a static asset, the asset
+	// itself first
+	Assets []assetOutput `json:"assets,omitempty"`
+}
+
+// previousBuild is the reusable output of the last successful deployment
+type previousBuild struct {
+	deployment *domain.Deployment
+	dir        string
+	manifest   *buildManifest
+}
+
+// pages returns the pages of the manifest ordered by URL path
+func (m *buildManifest) pages() []sitePage {
+	var pages []sitePage
+	for _, f := range m.Files {
+		if f.Page != nil {
+			pages = append(pages, *f.Page)
+		}
+	}
+	sort.Slice(pages, func(i, j int) bool { return pages[i].Path < pages[j].Path })
+	return pages
+}
+
+// findPreviousBuild returns the last successful deployment of the same
+// site and environment if its output can be reused, or nil for a full build.
+func (p *DeploymentProcessor) findPreviousBuild(ctx context.Context, d *domain.Deployment, site *domain.Site, baseURL string, blog *buildLog) *previousBuild {
+	prev, err := p.deploymentRepo.GetLastSuccessful(ctx, d.SiteID, d.EnvironmentID)
+	if err != nil {
+		return nil
+	}
+
+	dir := p.layout.DeploymentDir(prev)
+	manifest, err := readManifest(dir)
+	if err != nil {
+		blog.Warnf(ctx, "Cannot reuse output of deployment %s: %v", prev.ID, err)
+		return nil
+	}
+	if manifest.Version != buildFormatVersion || manifest.SiteName != site.Name || manifest.BaseURL != baseURL {
+		return nil
+	}
+	return &previousBuild{deployment: prev, dir: dir, manifest: manifest}
+}
+
+func readManifest(dir string) (*buildManifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, manifestPath))
+	if err != nil {
+		return nil, err
+	}
+	var m buildManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid build manifest: %w", err)
+	}
+	return &m, nil
+}
+
+func writeManifest(dir string, m *buildManifest) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return writeOutput(dir, manifestPath, data)
+}
+
+// reuseOutput hard-links an unchanged output from the previous deployment,
+// falling back to a copy when both live on different filesystems.
+func reuseOutput(fromDir, toDir, relPath string) error {
+	src, err := outputPath(fromDir, relPath)
+	if err != nil {
+		return err
+	}
+	dst, err := outputPath(toDir, relPath)
+	if err != nil {
+		return err
+	}
+	if src == dst {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	_ = os.Remove(dst)
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// staleOutputs returns the tree paths of a build whose output cannot be
+// reused from the previous build: files whose blob changed, and templated
+// pages whose navigation, backlinks or referenced assets changed, as pages
+// embed them. Without a previous build every output is stale.
+func staleOutputs(current, previous *buildManifest) map[string]bool {
+	stale := make(map[string]bool, len(current.Files))
+	if previous == nil {
+		for path := range current.Files {
+			stale[path] = true
+		}
+		return stale
+	}
+
+	pages, prevPages := current.pages(), previous.pages()
+	navChanged := !equalNavigation(navigation(pages), navigation(prevPages))
+	links, prevLinks := backlinks(pages), backlinks(prevPages)
+	assetsChanged := changedAssets(assetsByURL(current), assetsByURL(previous))
+	for path, file := range current.Files {
+		if prev, ok := previous.Files[path]; !ok || prev.BlobHash != file.BlobHash {
+			stale[path] = true
+			continue
+		}
+		if file.Page != nil && file.Page.Templated &&
+			(navChanged || !equalStrings(links[file.Page.Path], prevLinks[file.Page.Path]) ||
+				referencesChanged(file.Page, assetsChanged)) {
+			stale[path] = true
+		}
+	}
+	return stale
+}
+
+// navigation lists every page in output order
+func navigation(pages []sitePage) []navEntry {
+	nav := make([]navEntry, 0, len(pages))
+	for _, page := range pages {
+		nav = append(nav, navEntry{Title: page.Title, Path: page.Path})
+	}
+	return nav
+}
+
+type navEntry struct {
+	Title string
+	Path  string
+}
+
+func equalNavigation(a, b []navEntry) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// backlinks maps each page path to the sorted paths of pages linking to it
+func backlinks(pages []sitePage) map[string][]string {
+	result := make(map[string][]string)
+	for _, page := range pages {
+		seen := make(map[string]bool)
+		for _, target := range page.Links {
+			if target == page.Path || seen[target] {
+				continue
+			}
+			seen[target] = true
+			result[target] = append(result[target], page.Path)
+		}
+	}
+	for target := range result {
+		sort.Strings(result[target])
+	}
+	return result
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
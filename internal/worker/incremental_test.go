@@ -0,0 +1,119 @@
+package worker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testManifest describes a small site: two templated pages linking to each
+// other, a verbatim HTML page and an image the guide shows
+func testManifest() *buildManifest {
+	return &buildManifest{
+		Version: buildFormatVersion,
+		Files: map[string]buildFile{
+			"index.md": {BlobHash: "a1", OutputPath: "index.html", Page: &sitePage{
+				Path: "/", Title: "Home", Templated: true, Links: []string{"/guide"},
+				LinkRefs: []pageLink{{Href: "guide.md", Target: "/guide"}},
+			}},
+			"guide.md": {BlobHash: "b1", OutputPath: "guide/index.html", Page: &sitePage{
+				Path: "/guide", Title: "Guide", Templated: true, Links: []string{"/"},
+				LinkRefs: []pageLink{{Href: "index.md", Target: "/"}, {Href: "img/hero.png", Target: "/img/hero.png"}},
+			}},
+			"raw.html": {BlobHash: "c1", OutputPath: "raw.html", Page: &sitePage{Path: "/raw", Title: "Raw"}},
+			"img/hero.png": {BlobHash: "d1", OutputPath: "img/hero.png", Assets: []assetOutput{
+				{Path: "img/hero.d1d1d1d1d1d1.png"},
+			}},
+		},
+	}
+}
+
+func TestStaleOutputs(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(m *buildManifest)
+		stale  []string
+	}{
+		{"unchanged", func(m *buildManifest) {}, nil},
+		{"edited page", func(m *buildManifest) {
+			f := m.Files["index.md"]
+			f.BlobHash = "a2"
+			m.Files["index.md"] = f
+		}, []string{"index.md"}},
+		{"edited verbatim page", func(m *buildManifest) {
+			f := m.Files["raw.html"]
+			f.BlobHash = "c2"
+			m.Files["raw.html"] = f
+		}, []string{"raw.html"}},
+		{"renamed page title changes the navigation of every templated page", func(m *buildManifest) {
+			page := *m.Files["guide.md"].Page
+			page.Title = "User guide"
+			m.Files["guide.md"] = buildFile{BlobHash: "b2", OutputPath: "guide/index.html", Page: &page}
+		}, []string{"guide.md", "index.md"}},
+		{"new page", func(m *buildManifest) {
+			m.Files["faq.md"] = buildFile{BlobHash: "e1", OutputPath: "faq/index.html", Page: &sitePage{Path: "/faq", Title: "FAQ", Templated: true}}
+		}, []string{"faq.md", "guide.md", "index.md"}},
+		{"new file", func(m *buildManifest) {
+			m.Files["robots.txt"] = buildFile{BlobHash: "f1", OutputPath: "robots.txt"}
+		}, []string{"robots.txt"}},
+		{"removed link changes the backlinks of its target", func(m *buildManifest) {
+			page := *m.Files["index.md"].Page
+			page.Links, page.LinkRefs = nil, nil
+			m.Files["index.md"] = buildFile{BlobHash: "a2", OutputPath: "index.html", Page: &page}
+		}, []string{"guide.md", "index.md"}},
+		{"new image re-renders the pages showing it", func(m *buildManifest) {
+			m.Files["img/hero.png"] = buildFile{BlobHash: "d2", OutputPath: "img/hero.png", Assets: []assetOutput{
+				{Path: "img/hero.d2d2d2d2d2d2.png"},
+			}}
+		}, []string{"guide.md", "img/hero.png"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current := testManifest()
+			tt.change(current)
+			stale := staleOutputs(current, testManifest())
+			var paths []string
+			for path := range current.Files {
+				if stale[path] {
+					paths = append(paths, path)
+				}
+			}
+			assert.ElementsMatch(t, tt.stale, paths)
+		})
+	}
+}
+
+func TestStaleOutputs_FirstBuild(t *testing.T) {
+	current := testManifest()
+	stale := staleOutputs(current, nil)
+	assert.Len(t, stale, len(current.Files))
+	for path := range current.Files {
+		assert.True(t, stale[path], path)
+	}
+}
+
+func TestChangedAssets(t *testing.T) {
+	previous := map[string][]assetOutput{
+		"/img/a.png": {{Path: "img/a.111111111111.png"}},
+		"/img/b.png": {{Path: "img/b.222222222222.png"}},
+		"/css/c.css": {{Path: "css/c.333333333333.css"}},
+	}
+	current := map[string][]assetOutput{
+		"/img/a.png": {{Path: "img/a.111111111111.png"}, {Path: "img/a-480w.444444444444.png"}},
+		"/img/b.png": {{Path: "img/b.555555555555.png"}},
+		"/js/d.js":   {{Path: "js/d.666666666666.js"}},
+	}
+	assert.Equal(t, map[string]bool{"/img/b.png": true, "/css/c.css": true, "/js/d.js": true}, changedAssets(current, previous))
+}
+
+func TestBacklinks(t *testing.T) {
+	pages := []sitePage{
+		{Path: "/b", Links: []string{"/a", "/a", "/b"}},
+		{Path: "/a", Links: []string{"/c"}},
+		{Path: "/c", Links: []string{"/a"}},
+	}
+	assert.Equal(t, map[string][]string{
+		"/a": {"/b", "/c"},
+		"/c": {"/a"},
+	}, backlinks(pages))
+}
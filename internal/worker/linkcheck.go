@@ -0,0 +1,81 @@
+package worker
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// maxReportedLinks bounds the broken links written to the build log
+const maxReportedLinks = 100
+
+// brokenLink is an internal link whose target or anchor does not exist
+type brokenLink struct {
+	Page   string // URL path of the linking page
+	Block  string
+	Href   string
+	Reason string
+}
+
+// checkLinks validates the internal links of every page against the outputs
+// of the build and the anchors of the linked pages. outputs holds every
+// output path written by the build.
+func checkLinks(pages []sitePage, outputs map[string]bool) []brokenLink {
+	targets := make(map[string]bool, len(outputs))
+	for output := range outputs {
+		targets[linkKey("/"+output)] = true
+	}
+	anchors := make(map[string]map[string]bool, len(pages))
+	for _, page := range pages {
+		key := linkKey(page.Path)
+		targets[key] = true
+		set := make(map[string]bool, len(page.Anchors))
+		for _, anchor := range page.Anchors {
+			set[anchor] = true
+		}
+		anchors[key] = set
+	}
+
+	var broken []brokenLink
+	for _, page := range pages {
+		for _, link := range page.LinkRefs {
+			key := linkKey(link.Target)
+			reason := ""
+			switch {
+			case !targets[key]:
+				reason = "page not found"
+			case link.Fragment != "" && anchors[key] != nil && !hasAnchor(anchors[key], link.Fragment):
+				reason = "anchor #" + link.Fragment + " not found"
+			default:
+				continue
+			}
+			broken = append(broken, brokenLink{Page: page.Path, Block: link.Block, Href: link.Href, Reason: reason})
+		}
+	}
+	sort.SliceStable(broken, func(i, j int) bool { return broken[i].Page < broken[j].Page })
+	return broken
+}
+
+// linkKey normalizes a URL path for comparison: /guide, /guide/ and
+// /guide/index all reach the same page
+func linkKey(p string) string {
+	if unescaped, err := url.PathUnescape(p); err == nil {
+		p = unescaped
+	}
+	p = strings.TrimSuffix(p, "/index")
+	if p != "/" {
+		p = strings.TrimSuffix(p, "/")
+	}
+	if p == "" {
+		p = "/"
+	}
+	return p
+}
+
+func hasAnchor(anchors map[string]bool, fragment string) bool {
+	if fragment == "top" || anchors[fragment] {
+		return true
+	}
+	unescaped, err := url.PathUnescape(fragment)
+	return err == nil && anchors[unescaped]
+}
@@ -0,0 +1,80 @@
+package worker
+
+import (
+	"net/url"
+	"path"
+	"strings"
+)
+
+// basePath returns the path a site is mounted at from its base URL, without
+// a trailing slash: "" at the root of a host, "/docs/api" for a subdirectory
+func basePath(baseURL string) string {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(u.Path, "/")
+}
+
+// resolveInternalLink resolves a link found on the page served at fromURL.
+// It returns the pretty URL path of the target and its fragment, or ok=false
+// for external links (with a scheme or protocol-relative).
+func resolveInternalLink(fromURL, href string) (target string, fragment string, ok bool) {
+	href = strings.TrimSpace(href)
+	if href == "" || strings.HasPrefix(href, "//") {
+		return "", "", false
+	}
+	if i := strings.Index(href, ":"); i >= 0 && !strings.ContainsAny(href[:i], "/?#") {
+		return "", "", false
+	}
+
+	if i := strings.Index(href, "#"); i >= 0 {
+		href, fragment = href[:i], href[i+1:]
+	}
+	if i := strings.Index(href, "?"); i >= 0 {
+		href = href[:i]
+	}
+	if href == "" {
+		return fromURL, fragment, true
+	}
+
+	if !strings.HasPrefix(href, "/") {
+		dir := fromURL
+		if !strings.HasSuffix(dir, "/") {
+			dir = path.Dir(dir) + "/"
+		}
+		href = dir + href
+	}
+
+	trailing := strings.HasSuffix(href, "/")
+	cleaned := path.Clean(href)
+	if trailing && cleaned != "/" {
+		cleaned += "/"
+	}
+	for _, ext := range []string{".md", ".html", ".htm"} {
+		if strings.HasSuffix(strings.ToLower(cleaned), ext) {
+			cleaned = cleaned[:len(cleaned)-len(ext)]
+			break
+		}
+	}
+	if cleaned == "/index" || strings.HasSuffix(cleaned, "/index") {
+		cleaned = strings.TrimSuffix(cleaned, "index")
+	}
+	return cleaned, fragment, true
+}
+
+// rewriteInternalLink returns the href emitted in rendered HTML for a source
+// link, below the base path the site is mounted at
+func rewriteInternalLink(fromURL, href, base string) string {
+	if strings.HasPrefix(href, "#") {
+		return href
+	}
+	target, fragment, ok := resolveInternalLink(fromURL, href)
+	if !ok {
+		return href
+	}
+	if fragment != "" {
+		return base + target + "#" + fragment
+	}
+	return base + target
+}
@@ -0,0 +1,141 @@
+package worker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveInternalLink(t *testing.T) {
+	tests := []struct {
+		from, href       string
+		target, fragment string
+		ok               bool
+	}{
+		{"/guide/intro", "setup.md", "/guide/setup", "", true},
+		{"/guide/", "setup.md", "/guide/setup", "", true},
+		{"/guide/intro", "../faq.html#install", "/faq", "install", true},
+		{"/guide/intro", "/api/index.md", "/api/", "", true},
+		{"/guide/intro", "index.md", "/guide/", "", true},
+		{"/guide/intro", "/index", "/", "", true},
+		{"/guide/intro", "sub/", "/guide/sub/", "", true},
+		{"/guide/intro", "page.MD?x=1#top", "/guide/page", "top", true},
+		{"/guide/intro", "#usage", "/guide/intro", "usage", true},
+		{"/guide/intro", "?page=2", "/guide/intro", "", true},
+		{"/guide/intro", "../../../etc", "/etc", "", true},
+		{"/guide/intro", " setup.md ", "/guide/setup", "", true},
+		{"/", "img/logo.png", "/img/logo.png", "", true},
+		{"/guide/intro", "https://example.com/x.md", "", "", false},
+		{"/guide/intro", "mailto:team@example.com", "", "", false},
+		{"/guide/intro", "//cdn.example.com/a.js", "", "", false},
+		{"/guide/intro", "", "", "", false},
+		{"/guide/intro", "docs/a:b.md", "/guide/docs/a:b", "", true},
+	}
+	for _, tt := range tests {
+		target, fragment, ok := resolveInternalLink(tt.from, tt.href)
+		assert.Equal(t, tt.ok, ok, "%s from %s", tt.href, tt.from)
+		assert.Equal(t, tt.target, target, "%s from %s", tt.href, tt.from)
+		assert.Equal(t, tt.fragment, fragment, "%s from %s", tt.href, tt.from)
+	}
+}
+
+func TestRewriteInternalLink(t *testing.T) {
+	tests := []struct {
+		from, href, base string
+		want             string
+	}{
+		{"/guide/intro", "setup.md", "", "/guide/setup"},
+		{"/guide/intro", "setup.md#run", "/docs", "/docs/guide/setup#run"},
+		{"/guide/intro", "#usage", "/docs", "#usage"},
+		{"/guide/intro", "https://example.com", "/docs", "https://example.com"},
+		{"/", "index.md", "/docs", "/docs/"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, rewriteInternalLink(tt.from, tt.href, tt.base), tt.href)
+	}
+}
+
+func TestBasePath(t *testing.T) {
+	tests := map[string]string{
+		"":                              "",
+		"https://docs.example.com":      "",
+		"https://docs.example.com/":     "",
+		"https://example.com/docs/api/": "/docs/api",
+		"https://example.com/docs":      "/docs",
+		"http://[::1]:namedport/x":      "",
+	}
+	for baseURL, want := range tests {
+		assert.Equal(t, want, basePath(baseURL), baseURL)
+	}
+}
+
+func TestLinkKey(t *testing.T) {
+	tests := map[string]string{
+		"/guide":        "/guide",
+		"/guide/":       "/guide",
+		"/guide/index":  "/guide",
+		"/":             "/",
+		"/index":        "/",
+		"":              "/",
+		"/caf%C3%A9":    "/café",
+		"/100%":         "/100%",
+		"/img/logo.png": "/img/logo.png",
+	}
+	for p, want := range tests {
+		assert.Equal(t, want, linkKey(p), p)
+	}
+}
+
+func TestCheckLinks(t *testing.T) {
+	pages := []sitePage{
+		{Path: "/", Anchors: []string{"welcome"}},
+		{Path: "/guide/", Anchors: []string{"install", "café"}},
+		{Path: "/guide/setup", Anchors: []string{"run"}},
+	}
+	outputs := map[string]bool{"index.html": true, "img/logo.png": true, "report.pdf": true}
+
+	tests := []struct {
+		name   string
+		link   pageLink
+		reason string
+	}{
+		{"page", pageLink{Href: "guide/setup.md", Target: "/guide/setup"}, ""},
+		{"directory page", pageLink{Href: "guide/", Target: "/guide/"}, ""},
+		{"index page", pageLink{Href: "guide/index.md", Target: "/guide/index"}, ""},
+		{"anchor", pageLink{Href: "guide/setup.md#run", Target: "/guide/setup", Fragment: "run"}, ""},
+		{"escaped anchor", pageLink{Href: "guide/#caf%C3%A9", Target: "/guide/", Fragment: "caf%C3%A9"}, ""},
+		{"top", pageLink{Href: "guide/setup.md#top", Target: "/guide/setup", Fragment: "top"}, ""},
+		{"asset", pageLink{Href: "img/logo.png", Target: "/img/logo.png"}, ""},
+		{"anchor of a file", pageLink{Href: "report.pdf#page=2", Target: "/report.pdf", Fragment: "page=2"}, ""},
+		{"missing page", pageLink{Href: "guide/teardown.md", Target: "/guide/teardown"}, "page not found"},
+		{"missing asset", pageLink{Href: "img/missing.png", Target: "/img/missing.png"}, "page not found"},
+		{"missing anchor", pageLink{Href: "guide/setup.md#build", Target: "/guide/setup", Fragment: "build"}, "anchor #build not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			linking := sitePage{Path: "/", LinkRefs: []pageLink{tt.link}}
+			broken := checkLinks(append([]sitePage{linking}, pages[1:]...), outputs)
+			if tt.reason == "" {
+				assert.Empty(t, broken)
+				return
+			}
+			if assert.Len(t, broken, 1) {
+				assert.Equal(t, brokenLink{Page: "/", Href: tt.link.Href, Reason: tt.reason}, broken[0])
+			}
+		})
+	}
+}
+
+func TestCheckLinks_SortedByPage(t *testing.T) {
+	missing := []pageLink{{Href: "gone.md", Target: "/gone", Block: "Intro"}}
+	pages := []sitePage{
+		{Path: "/b", LinkRefs: missing},
+		{Path: "/a", LinkRefs: missing},
+	}
+	broken := checkLinks(pages, nil)
+	if assert.Len(t, broken, 2) {
+		assert.Equal(t, "/a", broken[0].Page)
+		assert.Equal(t, "/b", broken[1].Page)
+		assert.Equal(t, "Intro", broken[0].Block)
+	}
+}
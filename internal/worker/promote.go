@@ -0,0 +1,193 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"openbook/internal/artifact"
+	"openbook/internal/domain"
+)
+
+// promote publishes the output of another deployment to this deployment's
+// environment without rebuilding it. Files are hard-linked from the source
+// output; only the generated files embedding the public base URL (templated
+// pages, sitemap, feed, robots.txt, LLM digests) are rewritten for the
+// target environment. Files taken verbatim from the commit stay untouched.
+// Internal links are root-relative, so an environment served at another
+// base path, such as a subdirectory domain, gets a full build instead. So
+// does a promotion between an environment with and one without a base URL,
+// as the sitemap and feed only exist with one.
+func (p *DeploymentProcessor) promote(ctx context.Context, deployment *domain.Deployment, blog *buildLog) (string, error) {
+	source, err := p.deploymentRepo.GetByID(ctx, *deployment.SourceDeploymentID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get source deployment: %w", err)
+	}
+	if source.WorkspaceID != deployment.WorkspaceID || source.SiteID != deployment.SiteID {
+		return "", fmt.Errorf("%w: source deployment %s belongs to another site", domain.ErrInvalidInput, source.ID)
+	}
+	if source.Status != "success" {
+		return "", fmt.Errorf("%w: source deployment %s is %s", domain.ErrInvalidInput, source.ID, source.Status)
+	}
+	sourceDir := p.layout.DeploymentDir(source)
+	manifest, err := readManifest(sourceDir)
+	if err != nil {
+		return "", fmt.Errorf("%w: output of deployment %s is not available: %v", domain.ErrInvalidInput, source.ID, err)
+	}
+
+	site, err := p.siteRepo.GetByID(ctx, deployment.SiteID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get site: %w", err)
+	}
+	env, err := p.environmentRepo.GetByID(ctx, deployment.EnvironmentID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get environment: %w", err)
+	}
+	domains, err := p.domainRepo.ListBySite(ctx, site.ID)
+	if err != nil {
+		return "", fmt.Errorf("failed to list domains: %w", err)
+	}
+	baseURL := siteBaseURL(site, env, domains)
+	if basePath(manifest.BaseURL) != basePath(baseURL) {
+		blog.Infof(ctx, "Environment %s is served at another base path than deployment %s, rebuilding its commit", env.Name, source.ID)
+		return p.build(ctx, deployment, blog)
+	}
+	if (manifest.BaseURL == "") != (baseURL == "") {
+		blog.Infof(ctx, "Only one of environment %s and deployment %s has a base URL, rebuilding its commit", env.Name, source.ID)
+		return p.build(ctx, deployment, blog)
+	}
+	blog.Infof(ctx, "Promoting deployment %s to environment %s", source.ID, env.Name)
+
+	stagingDir := p.layout.StagingDir(deployment)
+	if err := os.RemoveAll(stagingDir); err != nil {
+		return "", fmt.Errorf("failed to clear staging dir: %w", err)
+	}
+	linked, err := linkOutputs(ctx, sourceDir, stagingDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to copy source output: %w", err)
+	}
+	blog.Infof(ctx, "Linked %d files of deployment %s", linked, source.ID)
+
+	rewritten := 0
+	if manifest.BaseURL != baseURL {
+		if rewritten, err = rewriteBaseURL(stagingDir, manifest, baseURL); err != nil {
+			return "", fmt.Errorf("failed to rewrite URLs: %w", err)
+		}
+	}
+	if err := p.writeWhatsNew(ctx, stagingDir, deployment, site, manifest, baseURL, nil, blog); err != nil {
+		return "", fmt.Errorf("failed to write What's new page: %w", err)
+	}
+	if err := writeManifest(stagingDir, manifest); err != nil {
+		return "", fmt.Errorf("failed to write build manifest: %w", err)
+	}
+	blog.Infof(ctx, "Rewrote %d files for %s", rewritten, baseURL)
+
+	// Linked outputs reuse the variants of the source, rewritten ones get new ones
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if _, err := precompress(stagingDir, sourceDir); err != nil {
+		return "", fmt.Errorf("failed to precompress outputs: %w", err)
+	}
+	if err := p.storeArtifacts(ctx, stagingDir, blog); err != nil {
+		return "", err
+	}
+	if err := p.linkExports(ctx, source, sourceDir, stagingDir, blog); err != nil {
+		return "", err
+	}
+
+	if err := p.publish(ctx, deployment, env, blog); err != nil {
+		return "", err
+	}
+	return baseURL, nil
+}
+
+// linkOutputs hard-links the outputs of a deployment into dir. The build
+// manifest and the precompressed variants are left out; both are written
+// again for the copy.
+func linkOutputs(ctx context.Context, sourceDir, dir string) (int, error) {
+	linked := 0
+	err := filepath.WalkDir(sourceDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if strings.HasPrefix(entry.Name(), ".") && path != sourceDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if artifact.IsVariant(path) {
+			return nil
+		}
+		rel, err := filepath.Rel(sourceDir, path)
+		if err != nil {
+			return err
+		}
+		if err := reuseOutput(sourceDir, dir, rel); err != nil {
+			return err
+		}
+		linked++
+		return nil
+	})
+	return linked, err
+}
+
+// rewriteBaseURL replaces the base URL in the generated outputs of a build
+// and in its manifest. It returns the number of rewritten files.
+func rewriteBaseURL(dir string, manifest *buildManifest, baseURL string) (int, error) {
+	from := []byte(manifest.BaseURL + "/")
+	to := []byte(baseURL + "/")
+
+	fromCommit := make(map[string]bool, len(manifest.Files))
+	var outputs []string
+	for path, file := range manifest.Files {
+		fromCommit[file.OutputPath] = true
+		if file.Page != nil {
+			file.Page.URL = baseURL + strings.TrimPrefix(file.Page.URL, manifest.BaseURL)
+			if file.Page.Templated {
+				outputs = append(outputs, file.OutputPath)
+			}
+		}
+		manifest.Files[path] = file
+	}
+	for _, name := range seoFiles {
+		if !fromCommit[name] {
+			outputs = append(outputs, name)
+		}
+	}
+	manifest.BaseURL = baseURL
+
+	rewritten := 0
+	for _, rel := range outputs {
+		full := filepath.Join(dir, rel)
+		content, err := os.ReadFile(full)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return rewritten, err
+		}
+		updated := bytes.ReplaceAll(content, from, to)
+		if bytes.Equal(updated, content) {
+			continue
+		}
+		// The file is a hard link to the source output; replace it instead
+		// of writing through it
+		if err := os.Remove(full); err != nil {
+			return rewritten, err
+		}
+		if err := writeOutput(dir, rel, updated); err != nil {
+			return rewritten, err
+		}
+		rewritten++
+	}
+	return rewritten, nil
+}
@@ -0,0 +1,120 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"openbook/internal/domain"
+	"openbook/internal/service"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// schedulePollInterval is how often due scheduled deployments are queued
+const schedulePollInterval = time.Second
+
+var (
+	// queueDueDeployments atomically moves due entries of the schedule set
+	// onto the stream, marking them released
+	queueDueDeployments = redis.NewScript(`
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, 100)
+for _, id in ipairs(due) do
+	redis.call('ZREM', KEYS[1], id)
+	redis.call('SADD', KEYS[3], id)
+	redis.call('XADD', KEYS[2], '*', 'deployment_id', id, 'attempt', 0)
+end
+return #due
+`)
+	// restoreScheduledDeployment adds a deployment to the schedule set unless
+	// it is there already or was released onto the stream
+	restoreScheduledDeployment = redis.NewScript(`
+if redis.call('SISMEMBER', KEYS[2], ARGV[2]) == 1 then
+	return 0
+end
+return redis.call('ZADD', KEYS[1], 'NX', ARGV[1], ARGV[2])
+`)
+)
+
+// pollSchedule queues scheduled deployments whose time has come. Like
+// retries, the move runs as a Lua script so that each deployment is queued
+// exactly once however many workers poll.
+func (w *Worker) pollSchedule(ctx context.Context) {
+	ticker := time.NewTicker(schedulePollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			now := strconv.FormatInt(time.Now().Unix(), 10)
+			n, err := queueDueDeployments.Run(ctx, w.redisClient, []string{service.ScheduleSet, service.DeploymentsStream, service.ReleasedSet}, now).Int()
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("Failed to queue scheduled deployments: %v", err)
+				}
+				continue
+			}
+			if n > 0 {
+				log.Printf("Queued %d scheduled deployments", n)
+			}
+		}
+	}
+}
+
+// restoreSchedule adds scheduled deployments missing from the schedule set,
+// e.g. after Redis lost its data. Entries already there are left untouched,
+// and deployments released onto the stream but not yet picked up, which are
+// still scheduled, are not queued a second time.
+func (w *Worker) restoreSchedule(ctx context.Context) {
+	deployments, err := w.deploymentRepo.ListByStatus(ctx, "scheduled")
+	if err != nil {
+		log.Printf("Failed to list scheduled deployments: %v", err)
+		return
+	}
+
+	restored := int64(0)
+	for _, d := range deployments {
+		if d.ScheduledAt == nil {
+			continue
+		}
+		keys := []string{service.ScheduleSet, service.ReleasedSet}
+		n, err := restoreScheduledDeployment.Run(ctx, w.redisClient, keys, d.ScheduledAt.Unix(), d.ID.String()).Int64()
+		if err != nil {
+			log.Printf("Failed to restore schedule of deployment %s: %v", d.ID, err)
+			continue
+		}
+		restored += n
+	}
+	if restored > 0 {
+		log.Printf("Restored %d scheduled deployments", restored)
+	}
+}
+
+// queueScheduled moves a deployment released by the scheduler to pending.
+// A deployment cancelled in the meantime is returned as it is now.
+func (w *Worker) queueScheduled(ctx context.Context, d *domain.Deployment) (*domain.Deployment, error) {
+	err := w.deploymentRepo.UpdateStatus(ctx, d.ID, "pending")
+	if errors.Is(err, domain.ErrConflict) {
+		return w.deploymentRepo.GetByID(ctx, d.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Scheduled deployment %s is due, queued", d.ID)
+	now := time.Now()
+	d.Status, d.QueuedAt = "pending", &now
+	return d, nil
+}
+
+// clearRelease forgets that the scheduler released a deployment onto the
+// stream. It runs for every deployment read off the stream once it is no
+// longer scheduled, whether it was queued, cancelled or never scheduled;
+// restoreSchedule skips deployments in any other status anyway.
+func (w *Worker) clearRelease(ctx context.Context, d *domain.Deployment) {
+	if err := w.redisClient.SRem(ctx, service.ReleasedSet, d.ID.String()).Err(); err != nil {
+		log.Printf("Failed to clear release of deployment %s: %v", d.ID, err)
+	}
+}
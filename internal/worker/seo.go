@@ -0,0 +1,180 @@
+package worker
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"openbook/internal/domain"
+)
+
+// feedSize is the number of recently changed pages listed in the Atom feed
+const feedSize = 20
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"feed"`
+	XMLNS   string      `xml:"xmlns,attr"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Link    []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID      string   `xml:"id"`
+	Title   string   `xml:"title"`
+	Updated string   `xml:"updated"`
+	Link    atomLink `xml:"link"`
+	Summary string   `xml:"summary,omitempty"`
+}
+
+// seoFiles are the outputs generated by writeSEOFiles
+var seoFiles = []string{"sitemap.xml", "robots.txt", "feed.xml", "llms.txt", "llms-full.txt"}
+
+// writeSEOFiles emits sitemap.xml, robots.txt, feed.xml, llms.txt and
+// llms-full.txt. Files already provided by the commit are left untouched.
+// Sitemaps and Atom feeds require absolute URLs, so both are left out
+// without a base URL. updated stamps a feed without dated pages, so that
+// the same commit always produces the same output.
+func writeSEOFiles(root string, site *domain.Site, baseURL string, pages []sitePage, updated time.Time, written map[string]bool) error {
+	files := map[string]func() ([]byte, error){
+		"robots.txt":    func() ([]byte, error) { return buildRobots(site, baseURL), nil },
+		"llms.txt":      func() ([]byte, error) { return buildLLMsIndex(site, pages), nil },
+		"llms-full.txt": func() ([]byte, error) { return buildLLMsFull(site, pages), nil },
+	}
+	if baseURL != "" {
+		files["sitemap.xml"] = func() ([]byte, error) { return buildSitemap(pages) }
+		files["feed.xml"] = func() ([]byte, error) { return buildAtomFeed(site, baseURL, pages, updated) }
+	}
+
+	for name, build := range files {
+		if written[name] {
+			continue
+		}
+		content, err := build()
+		if err != nil {
+			return fmt.Errorf("failed to build %s: %w", name, err)
+		}
+		if err := writeOutput(root, name, content); err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+		written[name] = true
+	}
+	return nil
+}
+
+func buildSitemap(pages []sitePage) ([]byte, error) {
+	set := sitemapURLSet{XMLNS: "http://www.sitemaps.org/schemas/sitemap/0.9"}
+	for _, page := range pages {
+		u := sitemapURL{Loc: page.URL}
+		if !page.LastModified.IsZero() {
+			u.LastMod = page.LastModified.UTC().Format(time.RFC3339)
+		}
+		set.URLs = append(set.URLs, u)
+	}
+	return marshalXML(set)
+}
+
+func buildRobots(site *domain.Site, baseURL string) []byte {
+	if !site.IsPublic {
+		return []byte("User-agent: *\nDisallow: /\n")
+	}
+	if baseURL == "" {
+		return []byte("User-agent: *\nAllow: /\n")
+	}
+	return []byte(fmt.Sprintf("User-agent: *\nAllow: /\n\nSitemap: %s/sitemap.xml\n", baseURL))
+}
+
+func buildAtomFeed(site *domain.Site, baseURL string, pages []sitePage, updated time.Time) ([]byte, error) {
+	recent := make([]sitePage, len(pages))
+	copy(recent, pages)
+	sort.SliceStable(recent, func(i, j int) bool { return recent[i].LastModified.After(recent[j].LastModified) })
+	if len(recent) > feedSize {
+		recent = recent[:feedSize]
+	}
+
+	feed := atomFeed{
+		XMLNS: "http://www.w3.org/2005/Atom",
+		ID:    baseURL + "/",
+		Title: site.Name,
+		Link: []atomLink{
+			{Href: baseURL + "/"},
+			{Href: baseURL + "/feed.xml", Rel: "self"},
+		},
+		Updated: updated.UTC().Format(time.RFC3339),
+	}
+	if len(recent) > 0 && !recent[0].LastModified.IsZero() {
+		feed.Updated = recent[0].LastModified.UTC().Format(time.RFC3339)
+	}
+
+	for _, page := range recent {
+		feed.Entries = append(feed.Entries, atomEntry{
+			ID:      page.URL,
+			Title:   page.Title,
+			Updated: page.LastModified.UTC().Format(time.RFC3339),
+			Link:    atomLink{Href: page.URL},
+			Summary: summarize(page.Text, 280),
+		})
+	}
+	return marshalXML(feed)
+}
+
+// buildLLMsIndex follows the llms.txt convention: a title, a short summary and a link list
+func buildLLMsIndex(site *domain.Site, pages []sitePage) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n> Documentation published with OpenBook.\n\n## Pages\n\n", site.Name)
+	for _, page := range pages {
+		fmt.Fprintf(&b, "- [%s](%s)\n", page.Title, page.URL)
+	}
+	return []byte(b.String())
+}
+
+func buildLLMsFull(site *domain.Site, pages []sitePage) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n", site.Name)
+	for _, page := range pages {
+		fmt.Fprintf(&b, "\n---\n\n# %s\n\nSource: %s\n\n%s\n", page.Title, page.URL, strings.TrimSpace(page.Text))
+	}
+	return []byte(b.String())
+}
+
+func marshalXML(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+// summarize collapses whitespace and truncates text to at most max runes
+func summarize(text string, max int) string {
+	runes := []rune(strings.Join(strings.Fields(text), " "))
+	if len(runes) <= max {
+		return string(runes)
+	}
+	return string(runes[:max]) + "…"
+}
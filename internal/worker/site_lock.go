@@ -0,0 +1,24 @@
+package worker
+
+import (
+	"context"
+
+	"openbook/internal/domain"
+	"openbook/internal/service"
+)
+
+// lockTTL bounds how long a crashed worker can hold a site lock; holders
+// refresh it on every heartbeat
+const lockTTL = claimIdle
+
+// tryLockSite acquires the build lock of the deployment's environment.
+// It returns nil without error when another build or a rollback holds the lock.
+func (w *Worker) tryLockSite(ctx context.Context, d *domain.Deployment) (*service.SiteLock, error) {
+	return w.siteLocks.TryLock(ctx, d.SiteID, d.EnvironmentID, d.ID.String(), lockTTL)
+}
+
+// siteLockedBy reports whether the deployment's environment lock is
+// currently held by a build of that deployment
+func (w *Worker) siteLockedBy(ctx context.Context, d *domain.Deployment) (bool, error) {
+	return w.siteLocks.LockedBy(ctx, d.SiteID, d.EnvironmentID, d.ID.String())
+}
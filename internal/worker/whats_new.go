@@ -0,0 +1,137 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"openbook/internal/changelog"
+	"openbook/internal/domain"
+	"openbook/internal/render"
+
+	"github.com/google/uuid"
+)
+
+// whatsNewPath is the output of the "What's new" page, served at /whats-new
+const whatsNewPath = "whats-new.html"
+
+var whatsNewTemplate = template.Must(template.New("whats-new").Funcs(template.FuncMap{
+	"summary": func(message string) string {
+		line, _, _ := strings.Cut(message, "\n")
+		return line
+	},
+}).Parse(`<h1>What's new</h1>
+<p>Changes since the update of <time datetime="{{.Since.Format "2006-01-02T15:04:05Z07:00"}}">{{.Since.Format "January 2, 2006"}}</time>.</p>
+{{if .Empty}}<p>No pages changed.</p>
+{{end}}{{if .Added}}<h2>New pages</h2>
+<ul>
+{{range .Added}}<li><a href="{{$.BasePath}}{{.Path}}">{{.Title}}</a></li>
+{{end}}</ul>
+{{end}}{{if .Modified}}<h2>Updated pages</h2>
+<ul>
+{{range .Modified}}<li><a href="{{$.BasePath}}{{.Path}}">{{.Title}}</a></li>
+{{end}}</ul>
+{{end}}{{if .Removed}}<h2>Removed pages</h2>
+<ul>
+{{range .Removed}}<li>{{.Title}}</li>
+{{end}}</ul>
+{{end}}{{if .Commits}}<h2>Changes</h2>
+<ul>
+{{range .Commits}}<li>{{summary .Message}} <time datetime="{{.CreatedAt.Format "2006-01-02T15:04:05Z07:00"}}">{{.CreatedAt.Format "January 2, 2006"}}</time></li>
+{{end}}{{if .Truncated}}<li>and earlier changes</li>
+{{end}}</ul>
+{{end}}`))
+
+// changelogBuild lists the source files of a build for the changelog
+func changelogBuild(manifest *buildManifest) changelog.Build {
+	build := make(changelog.Build, len(manifest.Files))
+	for path, file := range manifest.Files {
+		src := changelog.Source{BlobHash: file.BlobHash}
+		if file.Page != nil {
+			src.Page = &changelog.Page{Path: file.Page.Path, URL: file.Page.URL, Title: file.Page.Title}
+		}
+		build[path] = src
+	}
+	return build
+}
+
+// writeWhatsNew publishes the "What's new" page of a site that enables it:
+// the pages changed since the last successful deployment of the environment
+// and the commits in between. The first deployment of an environment has
+// no such page, and a page of the commit at the same path is left alone.
+// A page linked from a promoted deployment is always replaced, since it
+// compares against another environment.
+func (p *DeploymentProcessor) writeWhatsNew(ctx context.Context, dir string, deployment *domain.Deployment, site *domain.Site, manifest *buildManifest, baseURL string, written map[string]bool, blog *buildLog) error {
+	for _, file := range manifest.Files {
+		if file.OutputPath == whatsNewPath {
+			if site.WhatsNew {
+				blog.Warnf(ctx, "The commit provides %s, no What's new page is generated", whatsNewPath)
+			}
+			return nil
+		}
+	}
+	if err := os.Remove(filepath.Join(dir, whatsNewPath)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if !site.WhatsNew {
+		return nil
+	}
+
+	prev, err := p.deploymentRepo.GetLastSuccessful(ctx, deployment.SiteID, deployment.EnvironmentID)
+	if err != nil {
+		blog.Infof(ctx, "First deployment of the environment, no What's new page")
+		return nil
+	}
+	from, err := changelog.ReadBuild(p.layout.DeploymentDir(prev))
+	if err != nil {
+		blog.Warnf(ctx, "Cannot compare with deployment %s, no What's new page: %v", prev.ID, err)
+		return nil
+	}
+	changes := changelog.ComparePages(from, changelogBuild(manifest))
+
+	fromCommit, errFrom := uuid.Parse(prev.CommitHash)
+	toCommit, errTo := uuid.Parse(deployment.CommitHash)
+	if errFrom == nil && errTo == nil {
+		if changes.Commits, changes.Truncated, err = changelog.Commits(ctx, p.gitRepo, fromCommit, toCommit); err != nil {
+			return fmt.Errorf("failed to list commits since deployment %s: %w", prev.ID, err)
+		}
+	}
+
+	since := prev.CreatedAt
+	if prev.FinishedAt != nil {
+		since = *prev.FinishedAt
+	}
+	var body bytes.Buffer
+	err = whatsNewTemplate.Execute(&body, struct {
+		*changelog.Changelog
+		Since    time.Time
+		BasePath string
+	}{changes, since, basePath(baseURL)})
+	if err != nil {
+		return err
+	}
+	output, err := render.Page(render.PageData{
+		SiteName:     site.Name,
+		Title:        "What's new",
+		CanonicalURL: baseURL + pageURLPath(whatsNewPath),
+		Body:         body.String(),
+		Navigation:   navItems(navigation(manifest.pages()), pageURLPath(whatsNewPath), basePath(baseURL)),
+	})
+	if err != nil {
+		return err
+	}
+	if err := writeOutput(dir, whatsNewPath, output); err != nil {
+		return err
+	}
+	if written != nil {
+		written[whatsNewPath] = true
+	}
+	blog.Infof(ctx, "Published What's new page: %d new, %d updated and %d removed pages, %d commits since deployment %s",
+		len(changes.Added), len(changes.Modified), len(changes.Removed), len(changes.Commits), prev.ID)
+	return nil
+}
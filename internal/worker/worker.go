@@ -2,93 +2,633 @@ package worker
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"os"
+	"strconv"
+	"sync"
 	"time"
 
 	"openbook/internal/config"
+	"openbook/internal/domain"
 	"openbook/internal/repository"
+	"openbook/internal/service"
+	"openbook/internal/storage"
 
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 )
 
+const (
+	// readBlock bounds how long a read waits so shutdown is noticed promptly
+	readBlock = 5 * time.Second
+	// claimIdle is how long a delivered message may go without a heartbeat
+	// before another worker reclaims it
+	claimIdle = 2 * time.Minute
+	// heartbeatInterval refreshes the idle time of the message being processed
+	heartbeatInterval = 30 * time.Second
+	// reclaimInterval is how often stale pending messages are reclaimed
+	reclaimInterval = 30 * time.Second
+	// retryPollInterval is how often due retries are moved back to the stream
+	retryPollInterval = time.Second
+	// retryBaseDelay and retryMaxDelay bound the exponential retry backoff
+	retryBaseDelay = 10 * time.Second
+	retryMaxDelay  = 10 * time.Minute
+	// lockWaitDelay is how long a deployment waits when its environment is already building
+	lockWaitDelay = 5 * time.Second
+	// interruptTimeout bounds the bookkeeping of builds cut short by a shutdown
+	interruptTimeout = 10 * time.Second
+)
+
+// errInterrupted marks a build stopped by a worker shutdown. Its message is
+// left un-ACKed so another worker reclaims it.
+var errInterrupted = errors.New("build interrupted by shutdown")
+
+// errCancelled is the cancellation cause of a build stopped on request
+var errCancelled = errors.New("deployment cancelled")
+
+// requeueDueRetries atomically moves due entries of the retry set onto the stream
+var requeueDueRetries = redis.NewScript(`
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, 100)
+for _, member in ipairs(due) do
+	redis.call('ZREM', KEYS[1], member)
+	local entry = cjson.decode(member)
+	redis.call('XADD', KEYS[2], '*', 'deployment_id', entry.deployment_id, 'attempt', entry.attempt)
+end
+return #due
+`)
+
 type Worker struct {
-	redisClient *redis.Client
-	processor   *DeploymentProcessor
+	redisClient    *redis.Client
+	siteLocks      *service.SiteLocks
+	processor      *DeploymentProcessor
+	deploymentRepo repository.DeploymentRepository
+	consumer       string
+	maxAttempts    int
+	concurrency    int
+	inFlight       sync.WaitGroup
+	reclaimCursor  string
+
+	// running holds the cancel functions of the builds of this worker
+	runningMu sync.Mutex
+	running   map[uuid.UUID]context.CancelCauseFunc
+
+	// quit stops reading new messages; cancelBuilds interrupts running builds
+	quit         chan struct{}
+	loopDone     chan struct{}
+	stopOnce     sync.Once
+	buildCtx     context.Context
+	cancelBuilds context.CancelFunc
 }
 
-func NewWorker(r *redis.Client, dRepo repository.DeploymentRepository, gRepo repository.GitRepository, cfg *config.Config) *Worker {
-	processor := NewDeploymentProcessor(dRepo, gRepo, cfg.StoragePath)
+func NewWorker(
+	r *redis.Client,
+	dRepo repository.DeploymentRepository,
+	gRepo repository.GitRepository,
+	sRepo repository.SiteRepository,
+	eRepo repository.EnvironmentRepository,
+	domRepo repository.DomainRepository,
+	cfg *config.Config,
+) *Worker {
+	processor := NewDeploymentProcessor(dRepo, gRepo, sRepo, eRepo, domRepo, storage.NewLayout(cfg.StoragePath), service.NewLogStream(r), cfg.ArtifactFormats)
+	buildCtx, cancelBuilds := context.WithCancel(context.Background())
 	return &Worker{
-		redisClient: r,
-		processor:   processor,
+		redisClient:    r,
+		siteLocks:      service.NewSiteLocks(r),
+		processor:      processor,
+		deploymentRepo: dRepo,
+		consumer:       consumerName(cfg.WorkerName),
+		maxAttempts:    cfg.MaxAttempts,
+		concurrency:    cfg.Concurrency,
+		reclaimCursor:  "0-0",
+		running:        make(map[uuid.UUID]context.CancelCauseFunc),
+		quit:           make(chan struct{}),
+		loopDone:       make(chan struct{}),
+		buildCtx:       buildCtx,
+		cancelBuilds:   cancelBuilds,
+	}
+}
+
+// consumerName identifies this process within the consumer group.
+// It must be unique per running worker so pending entries can be told apart.
+func consumerName(configured string) string {
+	if configured != "" {
+		return configured
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "worker"
 	}
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), uuid.NewString()[:8])
 }
 
+// Start consumes the deployments stream with a pool of build slots.
+// A message is only read or reclaimed when a slot is free, so a slow build
+// never holds up messages another worker could take.
+// Builds run on the worker's own context so that Stop can let them finish
+// after reading has stopped.
 func (w *Worker) Start(ctx context.Context) {
-	log.Println("Worker started. Listening to deployments_stream...")
+	defer close(w.loopDone)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-w.quit:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	log.Printf("Worker %s started with %d build slots. Listening to %s...", w.consumer, w.concurrency, service.DeploymentsStream)
 
 	// Ensure group exists
-	err := w.redisClient.XGroupCreateMkStream(ctx, "deployments_stream", "deployment_group", "$").Err()
+	err := w.redisClient.XGroupCreateMkStream(ctx, service.DeploymentsStream, service.DeploymentsGroup, "$").Err()
 	if err != nil && err.Error() != "BUSYGROUP Consumer Group name already exists" {
 		log.Printf("Failed to create consumer group: %v", err)
-		// Continue anyway? Or fatal?
-		// If group fails, we can't consume.
-		// But maybe it's a transient error.
 	}
 
+	w.recoverInterrupted(ctx)
+	w.restoreSchedule(ctx)
+	go w.pollRetries(ctx)
+	go w.pollSchedule(ctx)
+	// Cancellations must reach builds still draining after reading stopped
+	go w.watchCancellations(w.buildCtx)
+
+	slots := make(chan struct{}, w.concurrency)
+	var lastReclaim time.Time
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		default:
-			entries, err := w.redisClient.XReadGroup(ctx, &redis.XReadGroupArgs{
-				Group:    "deployment_group",
-				Consumer: "worker-1",
-				Streams:  []string{"deployments_stream", ">"},
-				Count:    1,
-				Block:    0,
-			}).Result()
+		case slots <- struct{}{}:
+		}
+
+		msg, ok := w.next(ctx, time.Since(lastReclaim) >= reclaimInterval)
+		if msg == nil {
+			if ok {
+				lastReclaim = time.Now()
+			}
+			<-slots
+			continue
+		}
+
+		w.inFlight.Add(1)
+		go func(msg redis.XMessage) {
+			defer func() {
+				<-slots
+				w.inFlight.Done()
+			}()
+			w.handle(w.buildCtx, msg)
+		}(*msg)
+	}
+}
+
+// next returns the next message to process: a stale pending message when
+// reclaiming is due, otherwise a new one from the stream. The boolean reports
+// whether a reclaim pass finished without finding anything.
+func (w *Worker) next(ctx context.Context, reclaim bool) (*redis.XMessage, bool) {
+	if reclaim {
+		if msg := w.reclaimOne(ctx); msg != nil {
+			return msg, false
+		}
+	}
+
+	entries, err := w.redisClient.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    service.DeploymentsGroup,
+		Consumer: w.consumer,
+		Streams:  []string{service.DeploymentsStream, ">"},
+		Count:    1,
+		Block:    readBlock,
+	}).Result()
+	if err != nil {
+		if err != redis.Nil && ctx.Err() == nil {
+			log.Printf("Failed to read from stream: %v", err)
+			time.Sleep(1 * time.Second)
+		}
+		return nil, reclaim
+	}
+
+	for _, entry := range entries {
+		for _, msg := range entry.Messages {
+			return &msg, reclaim
+		}
+	}
+	return nil, reclaim
+}
+
+// handle processes one stream message and settles it: ACK on success,
+// scheduled retry on a transient failure, dead letter otherwise.
+func (w *Worker) handle(ctx context.Context, msg redis.XMessage) {
+	deploymentIDStr, ok := msg.Values["deployment_id"].(string)
+	if !ok {
+		log.Printf("Invalid message format: %v", msg.Values)
+		w.ack(ctx, msg.ID)
+		return
+	}
+
+	deploymentID, err := uuid.Parse(deploymentIDStr)
+	if err != nil {
+		log.Printf("Invalid deployment ID: %s", deploymentIDStr)
+		w.ack(ctx, msg.ID)
+		return
+	}
+
+	attempt := 0
+	if s, ok := msg.Values["attempt"].(string); ok {
+		attempt, _ = strconv.Atoi(s)
+	}
+
+	deployment, err := w.deploymentRepo.GetByID(ctx, deploymentID)
+	if err != nil {
+		w.settleFailure(ctx, msg.ID, deploymentID, attempt+1, err)
+		return
+	}
+	if deployment.Status == "scheduled" {
+		if deployment, err = w.queueScheduled(ctx, deployment); err != nil {
+			w.settleFailure(ctx, msg.ID, deploymentID, attempt+1, err)
+			return
+		}
+	}
+	w.clearRelease(ctx, deployment)
+	if w.finished(ctx, msg.ID, deployment) {
+		return
+	}
+
+	// A newer deployment of the same environment makes this one obsolete
+	if newer, err := w.deploymentRepo.GetNewer(ctx, deployment); err == nil {
+		if err := w.processor.Supersede(ctx, deployment, newer); err != nil {
+			w.settleFailure(ctx, msg.ID, deploymentID, attempt+1, err)
+			return
+		}
+		w.ack(ctx, msg.ID)
+		return
+	}
+
+	// Only one build per site environment runs at a time across all workers;
+	// a busy environment sends the message back to wait without using an attempt.
+	lock, err := w.tryLockSite(ctx, deployment)
+	if err != nil {
+		w.settleFailure(ctx, msg.ID, deploymentID, attempt+1, err)
+		return
+	}
+	if lock == nil {
+		w.enqueueLater(ctx, msg.ID, deploymentID, attempt, lockWaitDelay)
+		return
+	}
+	defer func() {
+		if err := lock.Release(); err != nil {
+			log.Printf("Failed to release site lock of deployment %s: %v", deploymentID, err)
+		}
+	}()
+
+	// Registered before the status is read again so that a cancel signal sent
+	// in between is not missed
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	w.track(deploymentID, cancel)
+	defer w.untrack(deploymentID)
 
+	// Another delivery may have finished the deployment while we waited for the lock
+	if deployment, err = w.deploymentRepo.GetByID(ctx, deploymentID); err != nil {
+		w.settleFailure(ctx, msg.ID, deploymentID, attempt+1, err)
+		return
+	}
+	if w.finished(ctx, msg.ID, deployment) {
+		return
+	}
+
+	stopHeartbeat := w.heartbeat(ctx, msg.ID, lock)
+	err = w.processor.Process(ctx, deploymentID)
+	stopHeartbeat()
+
+	if err == nil || errors.Is(err, errCancelled) {
+		w.ack(ctx, msg.ID)
+		return
+	}
+	w.settleFailure(ctx, msg.ID, deploymentID, attempt+1, err)
+}
+
+func (w *Worker) track(id uuid.UUID, cancel context.CancelCauseFunc) {
+	w.runningMu.Lock()
+	w.running[id] = cancel
+	w.runningMu.Unlock()
+}
+
+func (w *Worker) untrack(id uuid.UUID) {
+	w.runningMu.Lock()
+	delete(w.running, id)
+	w.runningMu.Unlock()
+}
+
+// watchCancellations aborts builds of this worker whose deployment was
+// cancelled. It runs until the builds are done, past the end of the read loop.
+func (w *Worker) watchCancellations(ctx context.Context) {
+	sub := w.redisClient.Subscribe(ctx, service.CancelChannel)
+	defer sub.Close()
+
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			id, err := uuid.Parse(msg.Payload)
 			if err != nil {
-				log.Printf("Failed to read from stream: %v", err)
-				time.Sleep(1 * time.Second)
 				continue
 			}
+			w.runningMu.Lock()
+			cancel, ok := w.running[id]
+			w.runningMu.Unlock()
+			if ok {
+				log.Printf("Cancelling build of deployment %s", id)
+				cancel(errCancelled)
+			}
+		}
+	}
+}
+
+// finished ACKs and skips a message whose deployment already reached a final status
+func (w *Worker) finished(ctx context.Context, msgID string, d *domain.Deployment) bool {
+	if !d.IsFinished() {
+		return false
+	}
+	log.Printf("Deployment %s is already %s, skipping", d.ID, d.Status)
+	w.ack(ctx, msgID)
+	return true
+}
+
+// settleFailure retries a failed attempt later or dead-letters it.
+// Failures caused by a shutdown leave the message un-ACKed for another worker.
+func (w *Worker) settleFailure(ctx context.Context, msgID string, deploymentID uuid.UUID, attempt int, err error) {
+	if errors.Is(err, errInterrupted) || ctx.Err() != nil {
+		log.Printf("Deployment %s interrupted by shutdown, leaving message %s for another worker", deploymentID, msgID)
+		return
+	}
+	log.Printf("Failed to process deployment %s (attempt %d/%d): %v", deploymentID, attempt, w.maxAttempts, err)
+	if isPermanent(err) || attempt >= w.maxAttempts {
+		w.deadLetter(ctx, msgID, deploymentID, attempt, err)
+		return
+	}
+	w.scheduleRetry(ctx, msgID, deploymentID, attempt)
+}
+
+// isPermanent reports errors that a retry cannot fix
+func isPermanent(err error) bool {
+	return errors.Is(err, domain.ErrNotFound) || errors.Is(err, domain.ErrInvalidInput)
+}
+
+// retryDelay is the exponential backoff before the given attempt is retried
+func retryDelay(attempt int) time.Duration {
+	delay := retryBaseDelay
+	for i := 1; i < attempt && delay < retryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+	return delay
+}
+
+func (w *Worker) scheduleRetry(ctx context.Context, msgID string, deploymentID uuid.UUID, attempt int) {
+	delay := retryDelay(attempt)
+	if !w.enqueueLater(ctx, msgID, deploymentID, attempt, delay) {
+		return
+	}
 
-			for _, entry := range entries {
-				for _, msg := range entry.Messages {
-					deploymentIDStr, ok := msg.Values["deployment_id"].(string)
-					if !ok {
-						log.Printf("Invalid message format: %v", msg.Values)
-						w.ack(ctx, msg.ID)
-						continue
-					}
-
-					deploymentID, err := uuid.Parse(deploymentIDStr)
-					if err != nil {
-						log.Printf("Invalid deployment ID: %s", deploymentIDStr)
-						w.ack(ctx, msg.ID)
-						continue
-					}
-
-					if err := w.processor.Process(ctx, deploymentID); err != nil {
-						log.Printf("Failed to process deployment %s: %v", deploymentID, err)
-						// Don't ACK on failure to allow retry
-					} else {
-						w.ack(ctx, msg.ID)
-					}
+	if err := w.deploymentRepo.UpdateStatus(ctx, deploymentID, "pending"); err != nil {
+		log.Printf("Failed to reset deployment %s to pending: %v", deploymentID, err)
+	}
+	log.Printf("Deployment %s will be retried in %s", deploymentID, delay)
+}
+
+// enqueueLater ACKs a message and schedules it back onto the stream after
+// delay, carrying the given attempt count
+func (w *Worker) enqueueLater(ctx context.Context, msgID string, deploymentID uuid.UUID, attempt int, delay time.Duration) bool {
+	member := fmt.Sprintf(`{"deployment_id":%q,"attempt":%d,"message_id":%q}`, deploymentID, attempt, msgID)
+
+	pipe := w.redisClient.TxPipeline()
+	pipe.ZAdd(ctx, service.RetrySet, redis.Z{Score: float64(time.Now().Add(delay).Unix()), Member: member})
+	pipe.XAck(ctx, service.DeploymentsStream, service.DeploymentsGroup, msgID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Failed to requeue deployment %s: %v", deploymentID, err)
+		return false
+	}
+	return true
+}
+
+// deadLetter gives up on a deployment: it is marked failed, and its message
+// is moved to the dead letter stream
+func (w *Worker) deadLetter(ctx context.Context, msgID string, deploymentID uuid.UUID, attempts int, cause error) {
+	if err := w.processor.Fail(ctx, deploymentID, cause); err != nil {
+		log.Printf("Failed to mark deployment %s failed: %v", deploymentID, err)
+	}
+
+	pipe := w.redisClient.TxPipeline()
+	pipe.XAdd(ctx, &redis.XAddArgs{
+		Stream: service.DeadLetterStream,
+		Values: map[string]interface{}{
+			"deployment_id": deploymentID.String(),
+			"attempts":      attempts,
+			"error":         cause.Error(),
+			"consumer":      w.consumer,
+			"failed_at":     time.Now().UTC().Format(time.RFC3339),
+			"message_id":    msgID,
+		},
+	})
+	pipe.XAck(ctx, service.DeploymentsStream, service.DeploymentsGroup, msgID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Failed to dead-letter deployment %s: %v", deploymentID, err)
+		return
+	}
+	log.Printf("Deployment %s moved to %s after %d attempts", deploymentID, service.DeadLetterStream, attempts)
+}
+
+// heartbeat keeps claiming the message and the site lock for this consumer
+// while it is being processed, so a long build is not mistaken for a crashed worker.
+func (w *Worker) heartbeat(ctx context.Context, msgID string, lock *service.SiteLock) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		ticker := time.NewTicker(heartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				err := w.redisClient.XClaimJustID(ctx, &redis.XClaimArgs{
+					Stream:   service.DeploymentsStream,
+					Group:    service.DeploymentsGroup,
+					Consumer: w.consumer,
+					MinIdle:  0,
+					Messages: []string{msgID},
+				}).Err()
+				if err != nil && ctx.Err() == nil {
+					log.Printf("Failed to refresh claim on message %s: %v", msgID, err)
 				}
+				if err := lock.Refresh(ctx); err != nil && ctx.Err() == nil {
+					log.Printf("Failed to refresh site lock for message %s: %v", msgID, err)
+				}
+			}
+		}
+	}()
+	return cancel
+}
+
+// reclaimOne takes over a message left pending by a worker that died
+// mid-build. Messages delivered more than maxAttempts times are dead-lettered
+// instead of being returned.
+func (w *Worker) reclaimOne(ctx context.Context) *redis.XMessage {
+	for {
+		msgs, next, err := w.redisClient.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   service.DeploymentsStream,
+			Group:    service.DeploymentsGroup,
+			Consumer: w.consumer,
+			MinIdle:  claimIdle,
+			Start:    w.reclaimCursor,
+			Count:    1,
+		}).Result()
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Failed to reclaim pending messages: %v", err)
+			}
+			return nil
+		}
+		if next == "" {
+			next = "0-0"
+		}
+		w.reclaimCursor = next
+
+		if len(msgs) == 0 {
+			return nil
+		}
+		msg := msgs[0]
+		log.Printf("Reclaimed stale message %s", msg.ID)
+		if w.deliveryCount(ctx, msg.ID) > int64(w.maxAttempts) {
+			deploymentID, _ := uuid.Parse(fmt.Sprint(msg.Values["deployment_id"]))
+			w.deadLetter(ctx, msg.ID, deploymentID, w.maxAttempts, fmt.Errorf("worker stopped while processing the deployment"))
+			continue
+		}
+		return &msg
+	}
+}
+
+func (w *Worker) deliveryCount(ctx context.Context, msgID string) int64 {
+	pending, err := w.redisClient.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: service.DeploymentsStream,
+		Group:  service.DeploymentsGroup,
+		Start:  msgID,
+		End:    msgID,
+		Count:  1,
+	}).Result()
+	if err != nil || len(pending) == 0 {
+		return 0
+	}
+	return pending[0].RetryCount
+}
+
+// pollRetries moves retries whose backoff elapsed back onto the stream.
+// The move runs as a Lua script so each retry is enqueued exactly once even
+// with many workers polling.
+func (w *Worker) pollRetries(ctx context.Context) {
+	ticker := time.NewTicker(retryPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			now := strconv.FormatInt(time.Now().Unix(), 10)
+			err := requeueDueRetries.Run(ctx, w.redisClient, []string{service.RetrySet, service.DeploymentsStream}, now).Err()
+			if err != nil && ctx.Err() == nil {
+				log.Printf("Failed to requeue due retries: %v", err)
 			}
 		}
 	}
 }
 
+// ack settles a message even when the build context was cancelled
 func (w *Worker) ack(ctx context.Context, msgID string) {
-	w.redisClient.XAck(ctx, "deployments_stream", "deployment_group", msgID)
+	w.redisClient.XAck(context.WithoutCancel(ctx), service.DeploymentsStream, service.DeploymentsGroup, msgID)
 }
 
+// recoverInterrupted requeues deployments left in building by a worker that
+// died without cleaning up. A deployment still holding its environment lock
+// is being built by a live worker and is left alone.
+func (w *Worker) recoverInterrupted(ctx context.Context) {
+	deployments, err := w.deploymentRepo.ListByStatus(ctx, "building")
+	if err != nil {
+		log.Printf("Failed to list building deployments: %v", err)
+		return
+	}
+
+	for _, d := range deployments {
+		locked, err := w.siteLockedBy(ctx, d)
+		if err != nil {
+			log.Printf("Failed to check deployment %s: %v", d.ID, err)
+			continue
+		}
+		if locked {
+			continue
+		}
+
+		blog := newBuildLog(d, w.deploymentRepo, w.processor.logStream)
+		blog.Warnf(ctx, "Build was interrupted, requeued by worker %s", w.consumer)
+		blog.Flush(ctx)
+		if err := w.deploymentRepo.UpdateStatus(ctx, d.ID, "pending"); err != nil {
+			log.Printf("Failed to reset deployment %s: %v", d.ID, err)
+			continue
+		}
+		err = w.redisClient.XAdd(ctx, &redis.XAddArgs{
+			Stream: service.DeploymentsStream,
+			Values: map[string]interface{}{"deployment_id": d.ID.String(), "attempt": 0},
+		}).Err()
+		if err != nil {
+			log.Printf("Failed to requeue deployment %s: %v", d.ID, err)
+			continue
+		}
+		log.Printf("Requeued interrupted deployment %s", d.ID)
+	}
+}
+
+// Stop stops reading new messages and waits for in-flight builds until ctx
+// expires. Builds still running then are interrupted: their deployments go
+// back to pending and their messages stay pending for another worker.
 func (w *Worker) Stop(ctx context.Context) error {
 	log.Println("Worker stopping...")
-	return w.redisClient.Close()
+	w.stopOnce.Do(func() { close(w.quit) })
+
+	// No build may be started once we begin waiting for the in-flight ones
+	select {
+	case <-w.loopDone:
+	case <-ctx.Done():
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		w.inFlight.Wait()
+		close(drained)
+	}()
+
+	var err error
+	select {
+	case <-drained:
+		w.cancelBuilds()
+	case <-ctx.Done():
+		log.Println("Shutdown deadline reached, interrupting in-flight builds")
+		w.cancelBuilds()
+		select {
+		case <-drained:
+		case <-time.After(interruptTimeout):
+			err = fmt.Errorf("in-flight builds did not stop in time")
+		}
+	}
+
+	if closeErr := w.redisClient.Close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	return err
 }
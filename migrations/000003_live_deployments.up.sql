@@ -0,0 +1,2 @@
+-- Live pointer: the deployment currently served by each environment
+ALTER TABLE environments ADD COLUMN IF NOT EXISTS live_deployment_id UUID REFERENCES deployments(id);
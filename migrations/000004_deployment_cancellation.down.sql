@@ -0,0 +1,4 @@
+UPDATE deployments SET status = 'failed' WHERE status = 'cancelled';
+ALTER TABLE deployments DROP CONSTRAINT IF EXISTS deployments_status_check;
+ALTER TABLE deployments ADD CONSTRAINT deployments_status_check
+    CHECK (status IN ('pending', 'building', 'success', 'failed'));
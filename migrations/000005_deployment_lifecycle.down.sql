@@ -0,0 +1,5 @@
+ALTER TABLE deployments ALTER COLUMN url TYPE VARCHAR(255);
+ALTER TABLE deployments ALTER COLUMN storage_path TYPE VARCHAR(255);
+ALTER TABLE deployments DROP COLUMN IF EXISTS error_message;
+ALTER TABLE deployments DROP COLUMN IF EXISTS started_at;
+ALTER TABLE deployments DROP COLUMN IF EXISTS queued_at;
@@ -0,0 +1,8 @@
+-- Lifecycle timestamps and the error of the last failed build
+ALTER TABLE deployments ADD COLUMN IF NOT EXISTS queued_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE deployments ADD COLUMN IF NOT EXISTS started_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE deployments ADD COLUMN IF NOT EXISTS error_message TEXT;
+ALTER TABLE deployments ALTER COLUMN storage_path TYPE TEXT;
+ALTER TABLE deployments ALTER COLUMN url TYPE TEXT;
+
+UPDATE deployments SET queued_at = created_at WHERE queued_at IS NULL;
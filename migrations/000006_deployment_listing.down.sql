@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_deployments_workspace_created;
@@ -0,0 +1,2 @@
+-- Keyset pagination of a workspace's deployment history
+CREATE INDEX IF NOT EXISTS idx_deployments_workspace_created ON deployments(workspace_id, created_at DESC, id DESC);
@@ -0,0 +1,13 @@
+DROP INDEX IF EXISTS idx_environments_active_previews;
+
+UPDATE environments SET live_deployment_id = NULL WHERE is_preview;
+DELETE FROM deployments WHERE environment_id IN (SELECT id FROM environments WHERE is_preview);
+DELETE FROM environments WHERE is_preview OR branch_id IS NULL;
+
+ALTER TABLE environments DROP CONSTRAINT IF EXISTS environments_branch_id_fkey;
+ALTER TABLE environments ADD CONSTRAINT environments_branch_id_fkey
+    FOREIGN KEY (branch_id) REFERENCES branches(id);
+ALTER TABLE environments ALTER COLUMN branch_id SET NOT NULL;
+ALTER TABLE environments DROP COLUMN IF EXISTS last_activity_at;
+ALTER TABLE environments DROP COLUMN IF EXISTS is_preview;
+ALTER TABLE environments ALTER COLUMN name TYPE VARCHAR(50);
@@ -0,0 +1,12 @@
+-- Preview environments: one per branch, expired when the branch is deleted
+-- or inactive. A preview keeps its row after its branch is gone, so the
+-- branch reference becomes optional.
+ALTER TABLE environments ALTER COLUMN name TYPE VARCHAR(255);
+ALTER TABLE environments ADD COLUMN IF NOT EXISTS is_preview BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE environments ADD COLUMN IF NOT EXISTS last_activity_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE environments ALTER COLUMN branch_id DROP NOT NULL;
+ALTER TABLE environments DROP CONSTRAINT IF EXISTS environments_branch_id_fkey;
+ALTER TABLE environments ADD CONSTRAINT environments_branch_id_fkey
+    FOREIGN KEY (branch_id) REFERENCES branches(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_environments_active_previews ON environments(last_activity_at) WHERE is_preview AND is_active;
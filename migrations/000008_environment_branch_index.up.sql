@@ -0,0 +1,3 @@
+-- Auto-deploy looks up the active environments tracking a branch on every
+-- branch head move
+CREATE INDEX IF NOT EXISTS idx_environments_branch ON environments(branch_id) WHERE is_active;
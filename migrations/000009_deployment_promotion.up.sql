@@ -0,0 +1,2 @@
+-- Promotions publish the output of another deployment instead of building
+ALTER TABLE deployments ADD COLUMN IF NOT EXISTS source_deployment_id UUID REFERENCES deployments(id) ON DELETE SET NULL;
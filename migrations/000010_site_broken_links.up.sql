@@ -0,0 +1,3 @@
+-- Whether broken internal links only warn in the build log or fail the deployment
+ALTER TABLE sites ADD COLUMN IF NOT EXISTS broken_links VARCHAR(10) NOT NULL DEFAULT 'warn'
+    CHECK (broken_links IN ('warn', 'fail'));
@@ -0,0 +1,5 @@
+UPDATE deployments SET status = 'cancelled', finished_at = NOW() WHERE status = 'scheduled';
+ALTER TABLE deployments DROP CONSTRAINT IF EXISTS deployments_status_check;
+ALTER TABLE deployments ADD CONSTRAINT deployments_status_check
+    CHECK (status IN ('pending', 'building', 'success', 'failed', 'cancelled'));
+ALTER TABLE deployments DROP COLUMN IF EXISTS scheduled_at;
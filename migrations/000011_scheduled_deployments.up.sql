@@ -0,0 +1,5 @@
+-- Deployments can wait in scheduled until their publishing time
+ALTER TABLE deployments ADD COLUMN IF NOT EXISTS scheduled_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE deployments DROP CONSTRAINT IF EXISTS deployments_status_check;
+ALTER TABLE deployments ADD CONSTRAINT deployments_status_check
+    CHECK (status IN ('scheduled', 'pending', 'building', 'success', 'failed', 'cancelled'));
@@ -0,0 +1,3 @@
+-- Whether builds publish a "What's new" page listing the changes since the
+-- previous deployment of the environment
+ALTER TABLE sites ADD COLUMN IF NOT EXISTS whats_new BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_sites_workspace_slug;
+ALTER TABLE sites ADD CONSTRAINT sites_workspace_id_slug_key UNIQUE (workspace_id, slug);
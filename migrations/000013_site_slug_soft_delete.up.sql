@@ -0,0 +1,4 @@
+-- Slugs are unique among the live sites of a workspace, so the slug of a
+-- deleted site can be reused
+ALTER TABLE sites DROP CONSTRAINT IF EXISTS sites_workspace_id_slug_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sites_workspace_slug ON sites(workspace_id, slug) WHERE deleted_at IS NULL;
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_domains_checked_at;
+DROP INDEX IF EXISTS idx_domains_lower_domain;
+
+ALTER TABLE domains
+    DROP COLUMN IF EXISTS checked_at,
+    DROP COLUMN IF EXISTS verified_at,
+    DROP COLUMN IF EXISTS verification_error;
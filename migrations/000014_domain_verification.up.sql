@@ -0,0 +1,11 @@
+ALTER TABLE domains
+    ADD COLUMN IF NOT EXISTS verification_error TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS verified_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS checked_at TIMESTAMP WITH TIME ZONE;
+
+UPDATE domains SET status = 'pending' WHERE status IS NULL;
+UPDATE domains SET verification_token = '' WHERE verification_token IS NULL;
+
+-- Domains are looked up case-insensitively and stored lower-cased
+CREATE INDEX IF NOT EXISTS idx_domains_lower_domain ON domains(lower(domain));
+CREATE INDEX IF NOT EXISTS idx_domains_checked_at ON domains(checked_at);
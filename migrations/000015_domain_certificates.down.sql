@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS acme_challenges;
+DROP TABLE IF EXISTS acme_accounts;
+DROP TABLE IF EXISTS certificates;
+
+ALTER TABLE domains
+    DROP COLUMN IF EXISTS ssl_expires_at,
+    DROP COLUMN IF EXISTS ssl_checked_at,
+    DROP COLUMN IF EXISTS ssl_error;
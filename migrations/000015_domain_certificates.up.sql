@@ -0,0 +1,28 @@
+ALTER TABLE domains
+    ADD COLUMN IF NOT EXISTS ssl_error TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS ssl_checked_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS ssl_expires_at TIMESTAMP WITH TIME ZONE;
+
+UPDATE domains SET ssl_status = 'none' WHERE ssl_status IS NULL;
+
+-- Certificate chains and private keys, encrypted with CERT_ENCRYPTION_KEY
+CREATE TABLE IF NOT EXISTS certificates (
+    domain_id UUID PRIMARY KEY REFERENCES domains(id) ON DELETE CASCADE,
+    data BYTEA NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- ACME account keys per directory, encrypted with CERT_ENCRYPTION_KEY
+CREATE TABLE IF NOT EXISTS acme_accounts (
+    directory_url TEXT PRIMARY KEY,
+    key_data BYTEA NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Pending HTTP-01 challenges, answered by the site server
+CREATE TABLE IF NOT EXISTS acme_challenges (
+    token VARCHAR(255) PRIMARY KEY,
+    key_authorization TEXT NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_domains_host;
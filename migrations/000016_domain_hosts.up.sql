@@ -0,0 +1,2 @@
+-- Subdirectory domains are stored as host/path and looked up by their host
+CREATE INDEX IF NOT EXISTS idx_domains_host ON domains(lower(split_part(domain, '/', 1)));
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_domains_active_domain;
+DROP INDEX IF EXISTS idx_domains_workspace_domain;
+
+ALTER TABLE domains ADD CONSTRAINT domains_domain_key UNIQUE (domain);
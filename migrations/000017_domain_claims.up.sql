@@ -0,0 +1,7 @@
+-- A domain name is only reserved once verified: any workspace may claim a
+-- name, and the one proving ownership through DNS gets it. A workspace
+-- claims a name once.
+ALTER TABLE domains DROP CONSTRAINT IF EXISTS domains_domain_key;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_domains_workspace_domain ON domains(workspace_id, lower(domain));
+CREATE UNIQUE INDEX IF NOT EXISTS idx_domains_active_domain ON domains(lower(domain)) WHERE status = 'active';
@@ -0,0 +1,14 @@
+-- Preview hosts carry a hash of the site ID since site slugs are only unique
+-- within a workspace. Of the active previews that shared a host, all but the
+-- oldest, which was the one served, are deactivated; the next commit to their
+-- branch reactivates them under their new host.
+UPDATE environments e SET is_active = FALSE
+WHERE e.is_preview AND e.is_active AND e.url IS NOT NULL
+  AND EXISTS (
+    SELECT 1 FROM environments o
+    WHERE o.is_preview AND o.is_active AND o.id <> e.id
+      AND lower(o.url) = lower(e.url)
+      AND (o.created_at, o.id) < (e.created_at, e.id)
+  );
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_environments_preview_host ON environments(lower(url)) WHERE is_preview AND is_active;